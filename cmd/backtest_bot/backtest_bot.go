@@ -2,15 +2,28 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"os"
+	"os/exec"
 	"os/signal"
 	"syscall"
 
 	backtest "trading_bot/internal/backtest"
+	"trading_bot/internal/backtest/optimize"
+	"trading_bot/internal/backtest/report"
+	"trading_bot/internal/calendar"
 	"trading_bot/internal/clients/postgres"
 	"trading_bot/internal/clients/t_api"
 	"trading_bot/internal/config"
@@ -24,8 +37,54 @@ import (
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
 )
 
+const (
+	optimizeCommand    = "optimize"
+	walkForwardCommand = "walk-forward"
+	portfolioCommand   = "portfolio"
+	compareCommand     = "compare"
+)
+
+// portfolioStrategy is a strategy of saved run of the whole portfolio, its config is a list of traders configs
+const portfolioStrategy = "portfolio"
+
+type options struct {
+	format    string
+	objective string
+	parallel  int
+	exportDir string
+}
+
 func main() {
+	reportFormat := flag.String("report", report.FormatTable, "format of results: table, json or csv")
+	reportPath := flag.String("report-file", "", "path to write results instead of stdout")
+	objective := flag.String("objective", optimize.ObjectiveSharpe, "metric to rank optimization results by")
+	parallel := flag.Int("parallel", runtime.NumCPU(), "max number of backtests running at a time in optimization")
+	exportDir := flag.String("export", "", "directory to write equity and trades csv and html report of every backtest")
+	save := flag.Bool("save", false, "save results of backtests to backtest_runs table")
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if !slices.Contains([]string{"", optimizeCommand, walkForwardCommand, portfolioCommand, compareCommand}, command) {
+		fmt.Printf("unknown command '%s', expected no command, '%s', '%s', '%s' or '%s'\n",
+			command, optimizeCommand, walkForwardCommand, portfolioCommand, compareCommand)
+		return
+	}
+
 	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer cancelCtx()
+
+	if command == compareCommand {
+		differ, err := compareRuns(ctx, flag.Arg(1), flag.Arg(2))
+		if err != nil {
+			panic(err)
+		}
+		// differences fail the command to catch regressions in scripts
+		if differ {
+			cancelCtx()
+			os.Exit(1)
+		}
+		return
+	}
 
 	envCfg, err := config.GetEnvCfg()
 	if err != nil {
@@ -53,102 +112,737 @@ func main() {
 
 	startTime := time.Now()
 
-	results := make([]string, len(envCfg.Backtester))
-	var wg sync.WaitGroup
-	for i, test := range envCfg.Backtester {
-
-		from, err := supports.ParseDate(test.From)
+	out := os.Stdout
+	if *reportPath != "" {
+		out, err = os.Create(*reportPath)
 		if err != nil {
 			panic(err)
 		}
-		to, err := supports.ParseDate(test.To)
+		defer out.Close()
+	}
+
+	r := &runner{investClient: investClient, logger: logger}
+	if *save {
+		r.db, err = postgres.NewClient(ctx)
 		if err != nil {
 			panic(err)
 		}
+	}
+	opts := &options{format: *reportFormat, objective: *objective, parallel: *parallel, exportDir: *exportDir}
+
+	switch command {
+	case optimizeCommand:
+		err = r.runOptimization(ctx, envCfg.Backtester, out, opts)
+	case walkForwardCommand:
+		err = r.runWalkForward(ctx, envCfg.Backtester, out, opts)
+	case portfolioCommand:
+		err = r.runPortfolios(ctx, envCfg.Backtester, out, opts)
+	default:
+		err = r.runBacktests(ctx, envCfg.Backtester, out, opts)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("Time:", time.Since(startTime))
+}
 
-		dbClient, err := postgres.NewClient(ctx)
+func (r *runner) runBacktests(ctx context.Context, tests []*config.BacktesterCfg, out io.Writer, opts *options) error {
+	results := make([]*report.Report, len(tests))
+	datas := make([]*backtestData, len(tests))
+	errs := make([]error, len(tests))
+	var wg sync.WaitGroup
+	for i, test := range tests {
+		data, err := r.load(ctx, test)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		datas[i] = data
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			storage, err := r.run(ctx, data, test.StrategyCfg, test.UniqueTraderId)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = storage.Report(test.UniqueTraderId, data.baseCurrency)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		if err := export(opts.exportDir, result, datas[i].candles); err != nil {
+			return err
 		}
+		if err := r.save(datas[i], result); err != nil {
+			return err
+		}
+	}
 
-		ctx, cancel := context.WithCancel(ctx)
+	return report.Write(out, opts.format, results)
+}
 
-		instrInfo, err := investClient.FindInstrument(test.Uid)
+func (r *runner) runOptimization(ctx context.Context, tests []*config.BacktesterCfg, out io.Writer, opts *options) error {
+	for _, test := range tests {
+		data, err := r.load(ctx, test)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		dbId, err := dbClient.AddInstrumentInfo(instrInfo)
+		results, err := r.optimize(ctx, data, test.UniqueTraderId, opts)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		instrInfo.Id = dbId
 
-		if test.UniqueTraderId == "" {
-			test.UniqueTraderId = uuid.NewString()
+		if err := optimize.Write(out, opts.format, optimize.Swept(test.StrategyCfg), results); err != nil {
+			return err
 		}
 
-		interval, ok := datastruct.CandleIntervalFromString(test.Interval)
-		if !ok {
-			panic("incorrect interval value")
+		// only the best combination is saved, it is stored with its own parameters
+		if len(results) > 0 {
+			if err := r.save(data.withParams(results[0].Params), results[0].Report); err != nil {
+				return err
+			}
 		}
+	}
+
+	return nil
+}
 
-		doneCh := make(chan string)
+// runWalkForward optimizes parameters on every in sample part and backtests the best ones
+// on the following out of sample part, out of sample runs are joined into one report
+func (r *runner) runWalkForward(ctx context.Context, tests []*config.BacktesterCfg, out io.Writer, opts *options) error {
+	var reports []*report.Report
+	for _, test := range tests {
+		if test.WalkForward == nil {
+			return fmt.Errorf("walk_forward is not configured for %s", test.UniqueTraderId)
+		}
 
-		candles, err := dbClient.GetCandles(instrInfo, interval, from, to)
+		data, err := r.load(ctx, test)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		backtestStorage := backtest.NewBacktestStorage(*instrInfo, candles)
+		windows, err := optimize.Windows(data.from, data.to,
+			time.Hour*24*time.Duration(test.WalkForward.InSampleDays), time.Hour*24*time.Duration(test.WalkForward.OutOfSampleDays))
+		if err != nil {
+			return err
+		}
 
-		backtestBroker := backtest.NewBacktestBroker(test.StartDeposit, test.CommissionPercent/100, from, to, interval, doneCh, backtestStorage, logger, test.UniqueTraderId)
+		var curves [][]report.EquityPoint
+		var fills [][]*report.Fill
+		var rejections int
+		var interest float64
+		for i, w := range windows {
+			id := fmt.Sprintf("%s-w%d", test.UniqueTraderId, i)
 
-		wg.Add(1)
-		go func(ctx context.Context, i int, doneCh chan string, b *backtest.BacktestBroker, s *backtest.BacktestStorage, t *config.BacktesterCfg) {
-			defer wg.Done()
-			defer cancel()
+			results, err := r.optimize(ctx, data.window(w.InSampleFrom, w.InSampleTo), id, opts)
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				return fmt.Errorf("no results of optimization on in sample of window %d of %s", i, test.UniqueTraderId)
+			}
+			best := results[0]
 
-			select {
-			case <-ctx.Done():
-			case <-doneCh:
+			storage, err := r.runComplete(ctx, data.window(w.OutOfSampleFrom, w.OutOfSampleTo), best.Params, id+"-oos")
+			if err != nil {
+				return err
 			}
+			oos := storage.Report(id, data.baseCurrency)
+
+			fmt.Printf("Window %d: in sample %s - %s, out of sample %s - %s, params: %v, in sample %s: %.4f, out of sample return: %.4f\n",
+				i, w.InSampleFrom.Format(time.DateOnly), w.InSampleTo.Format(time.DateOnly),
+				w.OutOfSampleFrom.Format(time.DateOnly), w.OutOfSampleTo.Format(time.DateOnly),
+				best.Params, opts.objective, best.Score, oos.TotalReturn)
 
-			inInstr := s.GetInInstrumentsSum()
-			acc := b.GetAccoount()
-			total := inInstr + acc
-			results[i] = fmt.Sprintf("Result for %s. account: %.2f; max: %.2f; min: %.2f; in instr: %.2f; rate: %.2f; total: %.2f; total rate: %.2f;",
-				t.UniqueTraderId, acc, b.GetMaxAccoount(), b.GetMinAccoount(), inInstr, acc/t.StartDeposit*100, total, total/t.StartDeposit*100.0)
+			curves = append(curves, storage.Equity())
+			fills = append(fills, storage.Fills())
+			rejections += len(storage.Rejections())
+			interest += storage.Interest()
+		}
+
+		stitched := report.NewStitched(test.UniqueTraderId, data.baseCurrency, curves, fills)
+		stitched.Rejections, stitched.Interest = rejections, datastruct.NewMoney(interest, data.baseCurrency)
+		if data.tax != nil {
+			stitched.ApplyTax(*data.tax)
+		}
+		reports = append(reports, stitched)
 
-		}(ctx, i, doneCh, backtestBroker, backtestStorage, test)
+		if err := export(opts.exportDir, stitched, data.candles); err != nil {
+			return err
+		}
+		if err := r.save(data, stitched); err != nil {
+			return err
+		}
+	}
 
-		strategyResolver := strategy.NewStrategy()
+	return report.Write(out, opts.format, reports)
+}
 
-		strategyInstance, err := strategyResolver.ResolveStrategy(test.StrategyCfg, backtestStorage, investClient, test.UniqueTraderId)
+// runPortfolios backtests entries with the same portfolio on one account, deposits of the entries are put together
+func (r *runner) runPortfolios(ctx context.Context, tests []*config.BacktesterCfg, out io.Writer, opts *options) error {
+	var names []string
+	portfolios := make(map[string][]*config.BacktesterCfg)
+	for _, test := range tests {
+		if test.Portfolio == "" {
+			continue
+		}
+		if _, ok := portfolios[test.Portfolio]; !ok {
+			names = append(names, test.Portfolio)
+		}
+		portfolios[test.Portfolio] = append(portfolios[test.Portfolio], test)
+	}
+
+	if len(names) == 0 {
+		return fmt.Errorf("no BACKTESTER entries with portfolio")
+	}
+
+	var reports []*report.Report
+	for _, name := range names {
+		portfolioReports, err := r.runPortfolio(ctx, name, portfolios[name], opts)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		reports = append(reports, portfolioReports...)
+	}
+
+	return report.Write(out, opts.format, reports)
+}
 
-		trCfg := &trader.TraderCfg{
-			InstrInfo:                   instrInfo,
-			TraderId:                    test.UniqueTraderId,
-			TradingDelay:                0,
-			OnTradingErrorDelay:         time.Second * 1,
-			OnOrdersOperatingErrorDelay: time.Second * 1,
+// runPortfolio returns reports of every trader and of the whole portfolio at the end,
+// margin and tax of the portfolio are taken from its first entry
+func (r *runner) runPortfolio(ctx context.Context, name string, tests []*config.BacktesterCfg, opts *options) ([]*report.Report, error) {
+	// deposits of traders are put together, they must be in one base currency
+	var deposit datastruct.Money
+	datas := make([]*backtestData, len(tests))
+	for i, test := range tests {
+		if test.AllocationPercent < 0 || test.AllocationPercent > 100 {
+			return nil, fmt.Errorf("allocation_percent of %s must be from 0 to 100", test.UniqueTraderId)
 		}
 
-		trader, _ := trader.NewTraderService(ctx, backtestBroker, logger, strategyInstance, backtestStorage, &backtest.BacktestHystory{}, trCfg)
+		data, err := r.load(ctx, test)
+		if err != nil {
+			return nil, err
+		}
+		datas[i] = data
 
-		fmt.Printf("Start backtest on %s for %s - %s with interval '%s'\n",
-			test.UniqueTraderId, from.Format(time.DateOnly), to.Format(time.DateOnly), test.Interval)
+		if i == 0 {
+			deposit = data.deposit
+			continue
+		}
+		if deposit, err = deposit.Add(data.deposit); err != nil {
+			return nil, fmt.Errorf("failed making deposit of portfolio %s: %s", name, err.Error())
+		}
+	}
+	currency, tax := deposit.Currency, datas[0].tax
 
-		go trader.RunTrading()
+	account := backtest.NewAccount(deposit.ToFloat64())
+	if m := tests[0].Margin; m != nil {
+		account.SetMargin(m.Leverage, m.InterestPercent)
 	}
-	wg.Wait()
-	cancelCtx()
+	portfolio := backtest.NewPortfolio(account)
 
-	for _, res := range results {
-		fmt.Println(res)
+	storages := make([]*backtest.BacktestStorage, len(tests))
+	for i, test := range tests {
+		engine, storage, err := r.newEngine(datas[i], test.StrategyCfg, test.UniqueTraderId)
+		if err != nil {
+			return nil, err
+		}
+		portfolio.Add(engine, test.AllocationPercent/100)
+		storages[i] = storage
 	}
-	fmt.Println("Time:", time.Since(startTime))
+
+	fmt.Printf("Start portfolio backtest %s with %d traders\n", name, len(tests))
+
+	// interrupted backtest still has results till the moment
+	if err := portfolio.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	reports := make([]*report.Report, 0, len(tests)+1)
+	fills := make([][]*report.Fill, 0, len(tests))
+	var rejections int
+	for i, storage := range storages {
+		traderReport := storage.Report(tests[i].UniqueTraderId, currency)
+		if err := export(opts.exportDir, traderReport, datas[i].candles); err != nil {
+			return nil, err
+		}
+		if err := r.save(datas[i], traderReport); err != nil {
+			return nil, err
+		}
+		reports = append(reports, traderReport)
+		fills = append(fills, storage.Fills())
+		rejections += len(storage.Rejections())
+	}
+
+	total := report.NewPortfolio(name, currency, portfolio.Equity(), fills)
+	total.Rejections, total.Interest = rejections, datastruct.NewMoney(account.Interest(), currency)
+	if tax != nil {
+		total.ApplyTax(*tax)
+	}
+	if err := export(opts.exportDir, total, nil); err != nil {
+		return nil, err
+	}
+	if err := r.savePortfolio(tests, datas, total); err != nil {
+		return nil, err
+	}
+
+	return append(reports, total), nil
+}
+
+// save puts results of backtest with its config to backtest_runs if saving is on
+func (r *runner) save(data *backtestData, result *report.Report) error {
+	strategyName, _ := data.test.StrategyCfg["name"].(string)
+	return r.saveRun(data.test, strategyName, data.from, data.to, result)
+}
+
+// savePortfolio puts results of the whole portfolio with configs of all its traders
+func (r *runner) savePortfolio(tests []*config.BacktesterCfg, datas []*backtestData, result *report.Report) error {
+	from, to := datas[0].from, datas[0].to
+	for _, data := range datas[1:] {
+		if data.from.Before(from) {
+			from = data.from
+		}
+		if data.to.After(to) {
+			to = data.to
+		}
+	}
+
+	return r.saveRun(tests, portfolioStrategy, from, to, result)
+}
+
+func (r *runner) saveRun(test any, strategyName string, from, to time.Time, result *report.Report) error {
+	if r.db == nil {
+		return nil
+	}
+
+	cfg, err := json.Marshal(test)
+	if err != nil {
+		return err
+	}
+	metrics, err := json.Marshal(result.Values())
+	if err != nil {
+		return err
+	}
+	trades, err := json.Marshal(result.TradeLog())
+	if err != nil {
+		return err
+	}
+
+	run := &datastruct.BacktestRun{
+		Id:        uuid.NewString(),
+		GitCommit: gitCommit(),
+		TraderId:  result.Name,
+		Strategy:  strategyName,
+		Config:    cfg,
+		From:      from,
+		To:        to,
+		Metrics:   metrics,
+		Trades:    trades,
+	}
+	if err := r.db.PutBacktestRun(run); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved run %s of %s\n", run.Id, result.Name)
+	return nil
+}
+
+// gitCommit returns commit the binary is built from, dirty tree is marked
+func gitCommit() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		var revision string
+		var modified bool
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if revision != "" {
+			if modified {
+				revision += "-dirty"
+			}
+			return revision
+		}
+	}
+
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// compareRuns prints metrics and trades of two saved runs, true is returned when they differ
+func compareRuns(ctx context.Context, oldId, newId string) (bool, error) {
+	if oldId == "" || newId == "" {
+		return false, fmt.Errorf("expected two run ids: %s <run1> <run2>", compareCommand)
+	}
+
+	db, err := postgres.NewClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var metrics [2]map[string]any
+	var trades [2][]*report.Trade
+	for i, id := range []string{oldId, newId} {
+		run, err := db.GetBacktestRun(id)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("Run %s: %s, strategy %s, commit %s, %s - %s, saved at %s\n", run.Id, run.TraderId, run.Strategy,
+			run.GitCommit, run.From.Format(time.DateOnly), run.To.Format(time.DateOnly), run.CreatedAt.Format(time.DateTime))
+
+		if err := json.Unmarshal(run.Metrics, &metrics[i]); err != nil {
+			return false, fmt.Errorf("failed decoding metrics of run %s: %s", id, err.Error())
+		}
+		if err := json.Unmarshal(run.Trades, &trades[i]); err != nil {
+			return false, fmt.Errorf("failed decoding trades of run %s: %s", id, err.Error())
+		}
+	}
+	fmt.Println()
+
+	metricDiffs := report.CompareMetrics(metrics[0], metrics[1])
+	tradeDiffs := report.DiffTrades(trades[0], trades[1])
+	if err := report.WriteComparison(os.Stdout, oldId, newId, metricDiffs, tradeDiffs, 50); err != nil {
+		return false, err
+	}
+
+	differ := len(tradeDiffs) > 0
+	for _, m := range metricDiffs {
+		// runs of different traders can be compared
+		if m.Changed && m.Name != "name" {
+			differ = true
+		}
+	}
+
+	return differ, nil
+}
+
+// export writes equity and trades csv and html report to the directory if it is set
+func export(dir string, r *report.Report, candles []*datastruct.Candle) error {
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	prices := make([]report.PricePoint, 0, len(candles))
+	for _, c := range candles {
+		prices = append(prices, report.PricePoint{Time: c.Timestamp, Price: c.Close.ToFloat64()})
+	}
+
+	name := strings.ReplaceAll(r.Name, string(os.PathSeparator), "_")
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{name + "_equity.csv", func(w io.Writer) error { return report.WriteEquityCSV(w, r) }},
+		{name + "_trades.csv", func(w io.Writer) error { return report.WriteTradesCSV(w, r) }},
+		{name + ".html", func(w io.Writer) error { return report.WriteHTML(w, r, prices) }},
+	}
+
+	for _, f := range files {
+		if err := writeFile(filepath.Join(dir, f.name), f.write); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// optimize backtests every combination of strategy parameters and ranks results
+func (r *runner) optimize(ctx context.Context, data *backtestData, id string, opts *options) ([]*optimize.Result, error) {
+	combos, err := optimize.Expand(data.test.StrategyCfg)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Start optimization on %s with %d combinations\n", id, len(combos))
+
+	results, err := optimize.Run(ctx, combos, opts.parallel, func(ctx context.Context, i int, params map[string]any) (*report.Report, error) {
+		traderId := fmt.Sprintf("%s-%d", id, i)
+		storage, err := r.runComplete(ctx, data, params, traderId)
+		if err != nil {
+			return nil, err
+		}
+		return storage.Report(traderId, data.baseCurrency), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := optimize.Rank(results, opts.objective); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+type runner struct {
+	investClient *t_api.Client
+	logger       *logger.Logger
+	// db is set when results are saved
+	db *postgres.Client
+}
+
+// backtestData is loaded once and shared by runs with different strategy parameters
+type backtestData struct {
+	test         *config.BacktesterCfg
+	instrInfo    *datastruct.InstrumentInfo
+	candles      []*datastruct.Candle
+	interval     datastruct.CandleInterval
+	from, to     time.Time
+	sessions     []datastruct.TradingSession
+	cal          backtest.ICalendar
+	baseCurrency string
+	deposit      datastruct.Money
+	rates        datastruct.RateHistory
+	fill         backtest.FillCfg
+	fees         backtest.FeeCfg
+	tax          *report.TaxCfg
+}
+
+// window returns data with candles of the part of period
+func (d *backtestData) window(from, to time.Time) *backtestData {
+	w := *d
+	w.from, w.to = from, to
+	w.candles = nil
+	for _, c := range d.candles {
+		if !c.Timestamp.Before(from) && c.Timestamp.Before(to) {
+			w.candles = append(w.candles, c)
+		}
+	}
+
+	return &w
+}
+
+// withParams returns data with strategy config of the parameters
+func (d *backtestData) withParams(params map[string]any) *backtestData {
+	test := *d.test
+	test.StrategyCfg = params
+
+	w := *d
+	w.test = &test
+	return &w
+}
+
+func (r *runner) load(ctx context.Context, test *config.BacktesterCfg) (*backtestData, error) {
+	from, err := supports.ParseDate(test.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := supports.ParseDate(test.To)
+	if err != nil {
+		return nil, err
+	}
+
+	dbClient, err := postgres.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instrInfo, err := r.investClient.FindInstrument(test.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	dbId, err := dbClient.AddInstrumentInfo(instrInfo)
+	if err != nil {
+		return nil, err
+	}
+	instrInfo.Id = dbId
+
+	if test.UniqueTraderId == "" {
+		test.UniqueTraderId = uuid.NewString()
+	}
+
+	interval, ok := datastruct.CandleIntervalFromString(test.Interval)
+	if !ok {
+		return nil, fmt.Errorf("incorrect interval value")
+	}
+
+	candles, err := dbClient.GetCandles(instrInfo, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var cal backtest.ICalendar
+	if test.ReplaySchedule {
+		c := calendar.NewCalendar(backtest.NewScheduleSource(r.investClient), r.logger, backtest.ScheduleStatusTTL)
+		if err := c.LoadSchedules(instrInfo.Exchange, from.Add(-time.Hour*24), to.Add(time.Hour*24)); err != nil {
+			return nil, err
+		}
+		cal = c
+	}
+
+	sessions, err := datastruct.TradingSessionsFromStrings(test.Sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	// deposit and results are in base currency, money of instrument is converted with rates of the tested days.
+	// Rates of the week before cover the start of the test on weekends and holidays
+	baseCurrency := datastruct.NormalizeCurrency(test.BaseCurrency)
+	histories, err := r.investClient.GetExchangeRateHistory(from.Add(-time.Hour*24*7), to, instrInfo.Currency, baseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := histories.Rate(instrInfo.Currency, baseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	var fill backtest.FillCfg
+	if test.Fill != nil {
+		fill = backtest.FillCfg{
+			Model:              test.Fill.Model,
+			SlippagePercent:    test.Fill.SlippagePercent,
+			VolatilitySlippage: test.Fill.VolatilitySlippage,
+			SpreadPercent:      test.Fill.SpreadPercent,
+			MaxVolumePercent:   test.Fill.MaxVolumePercent,
+		}
+	}
+	if err := fill.Validate(); err != nil {
+		return nil, err
+	}
+
+	if m := test.Margin; m != nil && (m.Leverage < 1 || m.InterestPercent < 0) {
+		return nil, fmt.Errorf("margin leverage must be at least 1 and interest must not be negative")
+	}
+
+	var fees backtest.FeeCfg
+	if test.Fees != nil {
+		fees.MinPerOrder = test.Fees.MinPerOrder
+		fees.ExchangePercent = test.Fees.ExchangePercent
+		for _, tier := range test.Fees.Tiers {
+			fees.Tiers = append(fees.Tiers, backtest.FeeTier{Turnover: tier.Turnover, Percent: tier.Percent})
+		}
+	}
+	if err := fees.Validate(); err != nil {
+		return nil, err
+	}
+
+	// empty tax config is NDFL
+	var tax *report.TaxCfg
+	if test.Tax != nil {
+		t := report.NDFL
+		if test.Tax.Percent > 0 {
+			t.Percent = test.Tax.Percent
+		}
+		if test.Tax.HighPercent > 0 {
+			t.HighPercent = test.Tax.HighPercent
+		}
+		if test.Tax.Threshold > 0 {
+			t.Threshold = test.Tax.Threshold
+		}
+		tax = &t
+	}
+
+	return &backtestData{
+		test:         test,
+		instrInfo:    instrInfo,
+		candles:      candles,
+		interval:     interval,
+		from:         from,
+		to:           to,
+		sessions:     sessions,
+		cal:          cal,
+		baseCurrency: baseCurrency,
+		deposit:      datastruct.NewMoney(test.StartDeposit, baseCurrency),
+		rates:        rates,
+		fill:         fill,
+		fees:         fees,
+		tax:          tax,
+	}, nil
+}
+
+// run backtests strategy with parameters till the end of candles
+func (r *runner) run(ctx context.Context, data *backtestData, strategyCfg map[string]any, traderId string) (*backtest.BacktestStorage, error) {
+	engine, backtestStorage, err := r.newEngine(data, strategyCfg, traderId)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Start backtest on %s for %s - %s with interval '%s'\n",
+		traderId, data.from.Format(time.DateOnly), data.to.Format(time.DateOnly), data.test.Interval)
+
+	// interrupted backtest still has results till the moment
+	if err := engine.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	return backtestStorage, nil
+}
+
+// runComplete runs backtest as run, but interrupted backtest is an error,
+// its results must not be compared with complete ones
+func (r *runner) runComplete(ctx context.Context, data *backtestData, strategyCfg map[string]any, traderId string) (*backtest.BacktestStorage, error) {
+	storage, err := r.run(ctx, data, strategyCfg, traderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// newEngine makes storage, broker and engine of one trader
+func (r *runner) newEngine(data *backtestData, strategyCfg map[string]any, traderId string) (*backtest.Engine, *backtest.BacktestStorage, error) {
+	instrInfo := *data.instrInfo
+
+	// candles are shared, clipping makes appends of storage copy them
+	backtestStorage := backtest.NewBacktestStorage(instrInfo, slices.Clip(data.candles))
+
+	backtestBroker := backtest.NewBacktestBroker(data.deposit.ToFloat64(), data.test.CommissionPercent/100, data.from, data.to,
+		data.interval, backtestStorage, r.logger, traderId, data.cal)
+	backtestBroker.SetExchangeRates(data.rates)
+	backtestBroker.SetFillCfg(data.fill)
+	backtestBroker.SetFeeCfg(data.fees)
+	backtestStorage.SetTax(data.tax)
+	if m := data.test.Margin; m != nil {
+		backtestBroker.SetMargin(m.Leverage, m.InterestPercent)
+	}
+
+	strategyInstance, err := strategy.NewStrategy().ResolveStrategy(strategyCfg, backtestStorage, r.investClient, traderId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	engine := backtest.NewEngine(backtestBroker, strategyInstance, r.logger, &trader.TraderCfg{
+		InstrInfo: &instrInfo,
+		TraderId:  traderId,
+		Sessions:  data.sessions,
+	})
+
+	return engine, backtestStorage, nil
 }
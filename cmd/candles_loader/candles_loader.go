@@ -16,7 +16,6 @@ import (
 	"trading_bot/internal/supports"
 
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
-	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
 )
 
 func main() {
@@ -67,107 +66,77 @@ func main() {
 		pool <- struct{}{}
 		go func() {
 			defer wg.Done()
+			defer func() { <-pool }()
 
-			instrInfo, err := investClient.FindInstrument(instr.UID)
-			if err != nil {
-				panic(err)
+			if err := loadInstrument(ctx, investClient, dbClient, instr, msgCh); err != nil {
+				msgCh <- fmt.Sprintf("Failed loading [%s]: %s", instr.Ticker, err.Error())
 			}
+		}()
 
-			dbId, err := dbClient.AddInstrumentInfo(instrInfo)
-			if err != nil {
-				panic(err)
-			}
-			instrInfo.Id = dbId
+	}
 
-			from, err := supports.ParseDate(instr.From)
-			if err != nil {
-				panic(err)
-			}
-			to, err := supports.ParseDate(instr.To)
-			if err != nil {
-				panic(err)
-			}
+	wg.Wait()
+	close(msgCh)
+	close(pool)
+}
 
-			interval, ok := ds.CandleIntervalFromString(instr.Interval)
-			if !ok {
-				panic("incorrect interval value")
-			}
+func loadInstrument(ctx context.Context, c *t_api.Client, db *postgres.Client, instr *config.CandlesLoaderCfg, ch chan string) error {
+	instrInfo, err := c.FindInstrument(instr.UID)
+	if err != nil {
+		return err
+	}
 
-			if from.Before(instrInfo.FirstCandleDate) {
-				from = instrInfo.FirstCandleDate
-			}
+	dbId, err := db.AddInstrumentInfo(instrInfo)
+	if err != nil {
+		return err
+	}
+	instrInfo.Id = dbId
 
-			fmt.Printf("Start loading: %s\n", instr.Ticker)
-			loadCandlesToDB(ctx, investClient, dbClient, instrInfo, from, to, interval, msgCh)
+	from, err := supports.ParseDate(instr.From)
+	if err != nil {
+		return err
+	}
+	to, err := supports.ParseDate(instr.To)
+	if err != nil {
+		return err
+	}
 
-			<-pool
-		}()
+	interval, ok := ds.CandleIntervalFromString(instr.Interval)
+	if !ok {
+		return fmt.Errorf("incorrect interval value: %s", instr.Interval)
+	}
 
+	if from.Before(instrInfo.FirstCandleDate) {
+		from = instrInfo.FirstCandleDate
 	}
 
-	wg.Wait()
-	close(msgCh)
-	close(pool)
+	ch <- fmt.Sprintf("Start loading: %s", instr.Ticker)
+
+	return loadCandlesToDB(ctx, c, db, instrInfo, from, to, interval, ch)
 }
 
 func loadCandlesToDB(ctx context.Context, c *t_api.Client, db *postgres.Client,
-	instrInfo *ds.InstrumentInfo, from, to time.Time, interval ds.CandleInterval, ch chan string) {
-	tick := time.NewTicker(time.Second * 2)
-
+	instrInfo *ds.InstrumentInfo, from, to time.Time, interval ds.CandleInterval, ch chan string) error {
 	const stepMonths = 2
 	for t := from; t.Before(to); t = t.AddDate(0, stepMonths, 0) {
+		end := t.AddDate(0, stepMonths, 0)
+		if end.After(to) {
+			end = to
+		}
 
-		candles, err := getCandles(c, t, t.AddDate(0, stepMonths, 0), interval, instrInfo.Uid)
+		candles, err := c.GetHistoricCandles(instrInfo, interval, t, end)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		err = db.AddCandles(ctx, instrInfo, candles, interval)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		ch <- fmt.Sprintf("Loaded: %d candles for [%s] with interval '%s' for: %s - %s",
-			len(candles), instrInfo.Ticker, interval.ToString(), t.Format(time.DateOnly), t.AddDate(0, stepMonths, 0).Format(time.DateOnly))
-
-		<-tick.C
-	}
-}
-
-func getCandles(c *t_api.Client, from, to time.Time, interval ds.CandleInterval, instr string) ([]*ds.Candle, error) {
-	hist, err := c.NewMarketDataServiceClient().GetHistoricCandles(&investgo.GetHistoricCandlesRequest{
-		Instrument: instr,
-		Interval:   t_api.ResolveIntoPbInterval(interval),
-		From:       from,
-		To:         to,
-		Source:     investapi.GetCandlesRequest_CANDLE_SOURCE_EXCHANGE,
-	})
-	if err != nil {
-		return nil, err
-	}
-	candles := make([]*ds.Candle, 0, len(hist))
-	for _, v := range hist {
-		candles = append(candles, &ds.Candle{
-			Open: ds.Quotation{
-				Units: v.Open.Units,
-				Nano:  v.Open.Nano,
-			},
-			Close: ds.Quotation{
-				Units: v.Close.Units,
-				Nano:  v.Close.Nano,
-			},
-			High: ds.Quotation{
-				Units: v.High.Units,
-				Nano:  v.High.Nano,
-			},
-			Low: ds.Quotation{
-				Units: v.Low.Units,
-				Nano:  v.Low.Nano,
-			},
-			Volume:    v.Volume,
-			Timestamp: v.Time.AsTime(),
-		})
+			len(candles), instrInfo.Ticker, interval.ToString(), t.Format(time.DateOnly), end.Format(time.DateOnly))
 	}
 
-	return candles, nil
+	return nil
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	faketinvest "trading_bot/internal/fake_tinvest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	addr := flag.String("addr", "localhost:8443", "address to listen")
+	scriptPath := flag.String("script", "", "path to yaml script with instruments and prices")
+	certPath := flag.String("cert", "fake_tinvest.crt", "path to write self-signed certificate for clients")
+	flag.Parse()
+
+	if *scriptPath == "" {
+		fmt.Println("script is required")
+		os.Exit(1)
+	}
+
+	script, err := faketinvest.LoadScript(*scriptPath)
+	if err != nil {
+		panic(err)
+	}
+
+	host, _, err := net.SplitHostPort(*addr)
+	if err != nil {
+		panic(err)
+	}
+
+	cert, err := selfSignedCert(host, *certPath)
+	if err != nil {
+		panic(err)
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		panic(err)
+	}
+
+	market := faketinvest.NewMarket(script)
+	go market.Run(ctx)
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(cert)))
+	faketinvest.Register(server, market)
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	fmt.Printf("Fake T-Invest listens on %s, certificate written to %s\n", *addr, *certPath)
+	if err := server.Serve(lis); err != nil {
+		panic(err)
+	}
+}
+
+// selfSignedCert makes certificate for host and writes it in PEM,
+// so clients could trust it through SSL_CERT_FILE
+func selfSignedCert(host, path string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "fake_tinvest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if host != "" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, certPem, 0o644); err != nil {
+		return nil, fmt.Errorf("failed writing certificate: %s", err.Error())
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
@@ -11,11 +11,13 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"trading_bot/internal/clients/postgres"
 	"trading_bot/internal/clients/t_api"
 	"trading_bot/internal/config"
 	"trading_bot/internal/logger"
 	"trading_bot/internal/service/datastruct"
 
+	"github.com/google/uuid"
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
 	pb "github.com/russianinvestments/invest-api-go-sdk/proto"
 	"google.golang.org/grpc/metadata"
@@ -38,6 +40,8 @@ const (
 	buyCommand                  = "buy"
 	createSandboxAccountCommand = "create-sandbox-account"
 	closeSandboxAccountCommand  = "close-sandbox-account"
+	auditInstrumentsCommand     = "audit-instruments"
+	repairInstrumentsCommand    = "repair-instruments"
 )
 
 var (
@@ -50,6 +54,8 @@ var (
 		buyCommand:                  buy,
 		createSandboxAccountCommand: createSandboxAccount,
 		closeSandboxAccountCommand:  closeSandboxAccount,
+		auditInstrumentsCommand:     auditInstruments,
+		repairInstrumentsCommand:    repairInstruments,
 	}
 )
 
@@ -129,12 +135,17 @@ func sell(args []string) {
 	wg.Add(1)
 	go listenOrders(c, accountId, &wg)
 
-	orderResp, err := c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
-		InstrumentId: instrumentUID,
-		Quantity:     int64(lots),
-		Direction:    pb.OrderDirection_ORDER_DIRECTION_SELL,
-		AccountId:    accountId,
-		OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
+	// the same order id makes retries of the order idempotent
+	orderId := uuid.NewString()
+	orderResp, err := t_api.Invoke(c, t_api.QuotaOrders, func() (*investgo.PostOrderResponse, error) {
+		return c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
+			InstrumentId: instrumentUID,
+			Quantity:     int64(lots),
+			Direction:    pb.OrderDirection_ORDER_DIRECTION_SELL,
+			AccountId:    accountId,
+			OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
+			OrderId:      orderId,
+		})
 	})
 
 	if err != nil {
@@ -160,12 +171,17 @@ func buy(args []string) {
 	wg.Add(1)
 	go listenOrders(c, accountId, &wg)
 
-	orderResp, err := c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
-		InstrumentId: instrumentUID,
-		Quantity:     int64(lots),
-		Direction:    pb.OrderDirection_ORDER_DIRECTION_BUY,
-		AccountId:    accountId,
-		OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
+	// the same order id makes retries of the order idempotent
+	orderId := uuid.NewString()
+	orderResp, err := t_api.Invoke(c, t_api.QuotaOrders, func() (*investgo.PostOrderResponse, error) {
+		return c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
+			InstrumentId: instrumentUID,
+			Quantity:     int64(lots),
+			Direction:    pb.OrderDirection_ORDER_DIRECTION_BUY,
+			AccountId:    accountId,
+			OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
+			OrderId:      orderId,
+		})
 	})
 
 	if err != nil {
@@ -230,7 +246,9 @@ func getAccounts(args []string) {
 	}
 	c := getBrokerClient()
 
-	r, err := c.NewUsersServiceClient().GetAccounts(pb.AccountStatus_ACCOUNT_STATUS_ALL.Enum())
+	r, err := t_api.Invoke(c, t_api.QuotaUsers, func() (*investgo.GetAccountsResponse, error) {
+		return c.NewUsersServiceClient().GetAccounts(pb.AccountStatus_ACCOUNT_STATUS_ALL.Enum())
+	})
 	if err != nil {
 		fatalMsg(err, r)
 	}
@@ -242,7 +260,9 @@ func getAccounts(args []string) {
 			continue
 		}
 
-		pos, err := c.NewOperationsServiceClient().GetPositions(acc.Id)
+		pos, err := t_api.Invoke(c, t_api.QuotaOperations, func() (*investgo.PositionsResponse, error) {
+			return c.NewOperationsServiceClient().GetPositions(acc.Id)
+		})
 		var positions []*Position
 		if err == nil {
 			for _, p := range pos.Money {
@@ -286,7 +306,9 @@ func getInstruments(args []string) {
 }
 
 func getShares(c *t_api.Client, filePath string) {
-	resp, err := c.NewInstrumentsServiceClient().Shares(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := t_api.Invoke(c, t_api.QuotaInstruments, func() (*investgo.SharesResponse, error) {
+		return c.NewInstrumentsServiceClient().Shares(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		fatalMsg(err, resp)
 	}
@@ -299,7 +321,9 @@ func getShares(c *t_api.Client, filePath string) {
 }
 
 func getEtfs(c *t_api.Client, filePath string) {
-	resp, err := c.NewInstrumentsServiceClient().Etfs(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := t_api.Invoke(c, t_api.QuotaInstruments, func() (*investgo.EtfsResponse, error) {
+		return c.NewInstrumentsServiceClient().Etfs(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		fatalMsg(err, resp)
 	}
@@ -312,7 +336,9 @@ func getEtfs(c *t_api.Client, filePath string) {
 }
 
 func getBonds(c *t_api.Client, filePath string) {
-	resp, err := c.NewInstrumentsServiceClient().Bonds(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := t_api.Invoke(c, t_api.QuotaInstruments, func() (*investgo.BondsResponse, error) {
+		return c.NewInstrumentsServiceClient().Bonds(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		fatalMsg(err, resp)
 	}
@@ -325,7 +351,9 @@ func getBonds(c *t_api.Client, filePath string) {
 }
 
 func getCurrencies(c *t_api.Client, filePath string) {
-	resp, err := c.NewInstrumentsServiceClient().Currencies(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := t_api.Invoke(c, t_api.QuotaInstruments, func() (*investgo.CurrenciesResponse, error) {
+		return c.NewInstrumentsServiceClient().Currencies(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		msg := err.Error()
 		if resp != nil {
@@ -345,77 +373,92 @@ func getCurrencies(c *t_api.Client, filePath string) {
 
 func topUpSandboxAccount(args []string) {
 	if len(args) < 2 {
-		log.Fatalf("account id and value required: ./tool %s, <account id> <value>", topupSandboxAccountCommand)
+		log.Fatalf("account id and value required: ./tool %s, <account id> <value> [currency]", topupSandboxAccountCommand)
 	}
 	accId := args[0]
 	value, err := strconv.ParseFloat(args[1], 64)
 	if err != nil {
 		log.Fatal(err)
 	}
+	m := datastruct.NewMoney(value, sandboxCurrency(args))
 	c := getBrokerClient()
-	q := datastruct.Quotation{}
-	q.FromFloat64(value)
-
-	res, err := c.NewSandboxServiceClient().SandboxPayIn(&investgo.SandboxPayInRequest{
-		AccountId: accId,
-		Currency:  "rub",
-		Unit:      q.Units,
-		Nano:      q.Nano,
+
+	res, err := t_api.InvokeOnce(c, t_api.QuotaSandbox, func() (*investgo.SandboxPayInResponse, error) {
+		return c.NewSandboxServiceClient().SandboxPayIn(&investgo.SandboxPayInRequest{
+			AccountId: accId,
+			Currency:  m.Currency,
+			Unit:      m.Amount.Units,
+			Nano:      m.Amount.Nano,
+		})
 	})
 	if err != nil {
 		fatalMsg(err, res)
 	}
 
-	fmt.Printf("top up: %f; Balance: %d.%d %s\n", value, res.Balance.Units, res.Balance.Nano, res.Balance.Currency)
+	fmt.Printf("top up: %s; Balance: %d.%d %s\n", m.ToString(), res.Balance.Units, res.Balance.Nano, res.Balance.Currency)
 }
 
 func setUpSandboxAccount(args []string) {
 	if len(args) < 2 {
-		log.Fatalf("account id and value required: ./tool %s, <account id> <value>", setupSandboxAccountCommand)
+		log.Fatalf("account id and value required: ./tool %s, <account id> <value> [currency]", setupSandboxAccountCommand)
 	}
 	accId := args[0]
 	value, err := strconv.ParseFloat(args[1], 64)
 	if err != nil {
 		log.Fatal(err)
 	}
+	m := datastruct.NewMoney(value, sandboxCurrency(args))
 
 	c := getBrokerClient()
 	ssc := c.NewSandboxServiceClient()
 
-	res, err := ssc.SandboxPayIn(&investgo.SandboxPayInRequest{
-		AccountId: accId,
-		Currency:  "rub",
-		Unit:      0,
-		Nano:      0,
+	res, err := t_api.InvokeOnce(c, t_api.QuotaSandbox, func() (*investgo.SandboxPayInResponse, error) {
+		return ssc.SandboxPayIn(&investgo.SandboxPayInRequest{
+			AccountId: accId,
+			Currency:  m.Currency,
+			Unit:      0,
+			Nano:      0,
+		})
 	})
 	if err != nil {
 		fatalMsg(err, res)
 	}
 
-	res, err = ssc.SandboxPayIn(&investgo.SandboxPayInRequest{
-		AccountId: accId,
-		Currency:  "rub",
-		Unit:      -res.Balance.Units,
-		Nano:      -res.Balance.Nano,
+	balance := res.Balance
+	res, err = t_api.InvokeOnce(c, t_api.QuotaSandbox, func() (*investgo.SandboxPayInResponse, error) {
+		return ssc.SandboxPayIn(&investgo.SandboxPayInRequest{
+			AccountId: accId,
+			Currency:  m.Currency,
+			Unit:      -balance.Units,
+			Nano:      -balance.Nano,
+		})
 	})
 	if err != nil {
 		fatalMsg(err, res)
 	}
 
-	q := datastruct.Quotation{}
-	q.FromFloat64(value)
-
-	res, err = ssc.SandboxPayIn(&investgo.SandboxPayInRequest{
-		AccountId: accId,
-		Currency:  "rub",
-		Unit:      q.Units,
-		Nano:      q.Nano,
+	res, err = t_api.InvokeOnce(c, t_api.QuotaSandbox, func() (*investgo.SandboxPayInResponse, error) {
+		return ssc.SandboxPayIn(&investgo.SandboxPayInRequest{
+			AccountId: accId,
+			Currency:  m.Currency,
+			Unit:      m.Amount.Units,
+			Nano:      m.Amount.Nano,
+		})
 	})
 	if err != nil {
 		fatalMsg(err, res)
 	}
 
-	fmt.Printf("set up to: %f; Balance: %d.%d %s\n", value, res.Balance.Units, res.Balance.Nano, res.Balance.Currency)
+	fmt.Printf("set up to: %s; Balance: %d.%d %s\n", m.ToString(), res.Balance.Units, res.Balance.Nano, res.Balance.Currency)
+}
+
+// sandboxCurrency is the optional third argument, rub by default
+func sandboxCurrency(args []string) string {
+	if len(args) < 3 {
+		return datastruct.CurrencyRub
+	}
+
+	return datastruct.NormalizeCurrency(args[2])
 }
 
 func fatalMsg(err error, h IGetterHeader) {
@@ -452,7 +495,9 @@ func writeInstruments(instr []IInstrumentInfo, filePath string) {
 
 func createSandboxAccount(_ []string) {
 	c := getBrokerClient()
-	res, err := c.NewSandboxServiceClient().OpenSandboxAccount()
+	res, err := t_api.InvokeOnce(c, t_api.QuotaSandbox, func() (*investgo.OpenSandboxAccountResponse, error) {
+		return c.NewSandboxServiceClient().OpenSandboxAccount()
+	})
 	if err != nil {
 		fatalMsg(err, res)
 	}
@@ -466,10 +511,72 @@ func closeSandboxAccount(args []string) {
 	}
 
 	c := getBrokerClient()
-	res, err := c.NewSandboxServiceClient().CloseSandboxAccount(args[0])
+	res, err := t_api.Invoke(c, t_api.QuotaSandbox, func() (*investgo.CloseSandboxAccountResponse, error) {
+		return c.NewSandboxServiceClient().CloseSandboxAccount(args[0])
+	})
 	if err != nil {
 		fatalMsg(err, res)
 	}
 
 	fmt.Printf("Closed account: %s\n", args[0])
 }
+
+func getDBClient() *postgres.Client {
+	dbClient, err := postgres.NewClient(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return dbClient
+}
+
+func auditInstruments(_ []string) {
+	splits, err := getDBClient().FindInstrumentSplits()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(splits) == 0 {
+		fmt.Println("No split instruments")
+		return
+	}
+
+	for _, split := range splits {
+		fmt.Println("Split instrument:")
+		for _, instr := range split.Instruments {
+			fmt.Printf("  id: %d, uid: %s, ticker: %s, class code: %s, isin: %s, figi: %s\n",
+				instr.Id, instr.Uid, instr.Ticker, instr.ClassCode, instr.Isin, instr.Figi)
+		}
+	}
+	fmt.Printf("Found %d split instruments. Run '%s' to relink them\n", len(splits), repairInstrumentsCommand)
+}
+
+func repairInstruments(_ []string) {
+	db := getDBClient()
+	splits, err := db.FindInstrumentSplits()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c := getBrokerClient()
+	for _, split := range splits {
+		// the newest row is the closest to the actual instrument if broker doesn't know it
+		actual := split.Instruments[len(split.Instruments)-1]
+		for _, identifier := range []string{actual.Uid,
+			datastruct.JoinInstrumentIdentifier(actual.Isin, actual.ClassCode),
+			datastruct.JoinInstrumentIdentifier(actual.Ticker, actual.ClassCode)} {
+			found, err := c.FindInstrument(identifier)
+			if err == nil && found.SameInstrument(actual) {
+				actual = found
+				break
+			}
+		}
+
+		dbId, oldUids, err := db.ResolveInstrument(actual)
+		if err != nil {
+			log.Fatalf("failed relinking %s: %s", actual.Ticker, err.Error())
+		}
+		fmt.Printf("Relinked %s to id: %d, uid: %s, old uids: %v\n", actual.Ticker, dbId, actual.Uid, oldUids)
+	}
+	fmt.Printf("Repaired %d split instruments\n", len(splits))
+}
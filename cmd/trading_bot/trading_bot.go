@@ -15,6 +15,8 @@ import (
 	"trading_bot/internal/clients/t_api"
 	"trading_bot/internal/config"
 	lg "trading_bot/internal/logger"
+	"trading_bot/internal/paper"
+	"trading_bot/internal/record"
 	ds "trading_bot/internal/service/datastruct"
 	"trading_bot/internal/service/trader"
 	tradermanager "trading_bot/internal/service/trader_manager"
@@ -27,6 +29,9 @@ import (
 const (
 	waitOnPanic = time.Second * 10
 
+	streamPoolStatsDelay = time.Minute
+	futuresRollingDelay  = time.Hour
+
 	brokerLogFilePath = "invest.log"
 	brokerLogPrefix   = "INVEST_API"
 
@@ -34,6 +39,8 @@ const (
 	managerLogPrefix   = "TRADING_MANAGER"
 
 	traderLogPrefix = "TRADER"
+
+	paperSchema = "paper"
 )
 
 func main() {
@@ -77,27 +84,92 @@ func main() {
 		panic("no traders specified in config")
 	}
 
-	dbClient, err := postgres.NewClient(ctx)
+	// replayed orders must not get to live tables as well as paper ones
+	dbSchema := ""
+	if envCfg.Trader.Paper != nil || envCfg.Trader.Replay != nil {
+		dbSchema = paperSchema
+	}
+
+	dbClient, err := postgres.NewClientWithSchema(ctx, dbSchema)
 	if err != nil {
 		panic(err)
 	}
 
-	investCfg := investgo.Config{
-		AppName:   envCfg.AppName,
-		EndPoint:  envCfg.TInvestAddress,
-		Token:     envCfg.TInvestToken,
-		AccountId: envCfg.TInvestAccountID,
+	var broker trader.IBroker
+	var replayBroker *record.ReplayBroker
+	if replayCfg := envCfg.Trader.Replay; replayCfg != nil {
+		replayBroker, err = record.NewReplayBroker(replayCfg.Path, investLogger, &record.ReplayCfg{
+			Speed:             replayCfg.Speed,
+			CommissionPercent: replayCfg.CommissionPercent,
+			ReplayOrders:      replayCfg.ReplayOrders,
+		})
+		if err != nil {
+			panic(err)
+		}
+		broker = replayBroker
+		traderLogger.Infof("Replay of %s enabled", replayCfg.Path)
+	} else {
+		investCfg := investgo.Config{
+			AppName:   envCfg.AppName,
+			EndPoint:  envCfg.TInvestAddress,
+			Token:     envCfg.TInvestToken,
+			AccountId: envCfg.TInvestAccountID,
+		}
+
+		investClient, err := t_api.NewClient(ctx, investCfg, investLogger)
+		if err != nil {
+			panic(err)
+		}
+
+		investClient.SetAsyncOrders(envCfg.Trader.AsyncOrders)
+		if lookupCfg := envCfg.Trader.InstrumentLookup; lookupCfg != nil {
+			investClient.SetInstrumentLookup(&ds.InstrumentLookup{
+				ClassCodes: lookupCfg.ClassCodes,
+				Types:      lookupCfg.InstrumentTypes,
+			})
+		}
+
+		go logStreamPoolStats(ctx, investClient, investLogger)
+
+		broker = investClient
+	}
+
+	if recordCfg := envCfg.Trader.Record; recordCfg != nil {
+		w, err := record.NewWriter(recordCfg.Path)
+		if err != nil {
+			panic(err)
+		}
+		recorder := record.NewRecorder(broker, w, investLogger)
+		defer recorder.Close()
+
+		broker = recorder
+		traderLogger.Infof("Recording market data to %s", recordCfg.Path)
 	}
 
-	investClient, err := t_api.NewClient(ctx, investCfg, investLogger)
-	if err != nil {
-		panic(err)
+	if paperCfg := envCfg.Trader.Paper; paperCfg != nil {
+		broker = paper.NewPaperBroker(ctx, broker, dbClient, traderLogger, &paper.PaperCfg{
+			SlippagePercent:   paperCfg.SlippagePercent,
+			CommissionPercent: paperCfg.CommissionPercent,
+			Latency:           paperCfg.Latency,
+			OrderBookDepth:    paperCfg.OrderBookDepth,
+			BaseCurrency:      envCfg.Trader.BaseCurrency,
+		})
+		traderLogger.Infof("Paper trading enabled")
 	}
 
 	strategyResolver := strategy.NewStrategy()
-	traderManager := tradermanager.NewTraderManager(ctx, waitOnPanic, investClient, dbClient, tradingManagerLogger, traderLogger, strategyResolver, kafkaBroker)
+	traderManager := tradermanager.NewTraderManager(ctx, waitOnPanic, broker, dbClient, tradingManagerLogger, traderLogger, strategyResolver, kafkaBroker)
 
 	traderManager.UpdateTradersWithConfig(envCfg.Trader)
+	go traderManager.RunFuturesRolling(futuresRollingDelay)
+
+	if replayBroker != nil {
+		replayBroker.Start(ctx)
+		go func() {
+			<-replayBroker.Done()
+			cancelCtx()
+		}()
+	}
 
 	sighup := make(chan os.Signal, 1)
 	signal.Notify(sighup, syscall.SIGHUP)
@@ -127,6 +199,19 @@ func main() {
 	traderLogger.Infof("Service stopped")
 }
 
+func logStreamPoolStats(ctx context.Context, c *t_api.Client, l *lg.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(streamPoolStatsDelay):
+			stats := c.GetMarketDataPoolStats()
+			l.InfofKV("market data streams pool", ds.HistoryColStreams, stats.Streams,
+				ds.HistoryColSubscriptions, stats.Subscriptions, ds.HistoryColUtilisation, stats.Utilisation())
+		}
+	}
+}
+
 func openFileForLog(path string) *os.File {
 	if supports.IsInContainer() {
 		return os.Stdout
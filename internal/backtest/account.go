@@ -0,0 +1,88 @@
+package backtest
+
+import "time"
+
+// Account is money shared by brokers of portfolio backtest. Every broker keeps its own account
+// as the trader's part for per trader results.
+type Account struct {
+	cash            float64
+	leverage        float64
+	interestPercent float64
+	interest        float64
+	brokers         []*BacktestBroker
+}
+
+func NewAccount(deposit float64) *Account {
+	return &Account{
+		cash:     deposit,
+		leverage: 1,
+	}
+}
+
+// SetMargin allows to hold positions up to leverage of equity paying interest for borrowed money
+func (a *Account) SetMargin(leverage, interestPercent float64) {
+	a.leverage = leverage
+	a.interestPercent = interestPercent
+}
+
+// Attach makes broker use the account, allocation is a max part of equity in the broker position, 0 is no limit.
+// Margin of the broker is replaced by margin of the account.
+func (a *Account) Attach(broker *BacktestBroker, allocation float64) {
+	broker.shared = a
+	broker.allocation = allocation
+	broker.leverage, broker.interestPercent = 1, 0
+	a.brokers = append(a.brokers, broker)
+}
+
+func (a *Account) Cash() float64 {
+	return a.cash
+}
+
+// Equity is cash with value of positions by last prices
+func (a *Account) Equity() float64 {
+	return a.cash + a.positionsValue()
+}
+
+// Interest returns paid interest for borrowed money
+func (a *Account) Interest() float64 {
+	return a.interest
+}
+
+func (a *Account) positionsValue() float64 {
+	var value float64
+	for _, b := range a.brokers {
+		value += b.positionValue
+	}
+	return value
+}
+
+func (a *Account) buyingPower() float64 {
+	value := a.positionsValue()
+	return (a.cash+value)*a.leverage - value
+}
+
+// chargeInterest takes interest for negative cash between two times. Interest is split
+// between brokers by money they borrowed, so results of traders include their interest.
+func (a *Account) chargeInterest(from, to time.Time) {
+	if a.cash >= 0 || a.interestPercent <= 0 || from.IsZero() {
+		return
+	}
+
+	interest := -a.cash * a.interestPercent / 100 * float64(to.Sub(from)) / float64(time.Hour*24*365)
+	a.cash -= interest
+	a.interest += interest
+
+	var borrowed float64
+	for _, b := range a.brokers {
+		borrowed += max(-b.account, 0)
+	}
+	if borrowed == 0 {
+		return
+	}
+
+	for _, b := range a.brokers {
+		if b.account < 0 {
+			b.payInterest(interest * -b.account / borrowed)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package backtest
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
+	"trading_bot/internal/backtest/report"
 	ds "trading_bot/internal/service/datastruct"
 	"trading_bot/internal/service/trader"
 )
@@ -11,6 +13,33 @@ import (
 type IStorage interface {
 	GetCandleWithOffset(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval, from, to time.Time, offset int64) (*ds.Candle, error)
 	PutOrder(trId string, instrInfo *ds.InstrumentInfo, order *ds.Order) (err error)
+	RemoveOrder(instrInfo *ds.InstrumentInfo, order *ds.Order) error
+	PutFill(fill *report.Fill)
+	PutEquity(point report.EquityPoint)
+	PutRejection(rejection *report.Rejection)
+	PutInterest(amount float64)
+}
+
+type ICalendar interface {
+	GetTradingAvailability(instrInfo *ds.InstrumentInfo, t time.Time) (ds.TradingAvailability, ds.TradingSession, error)
+}
+
+type pendingOrder struct {
+	requestId  string
+	direction  ds.Action
+	lots       int64
+	executed   int64
+	price      float64 // last price when order was made, level of limit and stop orders
+	reserve    float64 // money reserved for buy
+	amount     float64 // sum of fill prices by lots
+	commission float64
+}
+
+func (o *pendingOrder) averagePrice() float64 {
+	if o.executed == 0 {
+		return 0
+	}
+	return o.amount / float64(o.executed)
 }
 
 type BacktestBroker struct {
@@ -19,33 +48,58 @@ type BacktestBroker struct {
 	maxAccount        float64
 	lastPrice         float64
 	commissionPercent float64
+	lots              int64
+	// account is in base currency, money of instrument is converted with exchangeRate
+	// taken from rates at the time of the current candle
+	exchangeRate float64
+	rates        ds.RateHistory
+	fill         FillCfg
+	fees         FeeCfg
+	// turnover of the month in base currency for fee tiers
+	turnover      float64
+	turnoverMonth time.Time
+	// leverage limits value of position by equity, it is 1 without margin.
+	// Interest is paid for negative account by annual interestPercent
+	leverage        float64
+	interestPercent float64
+	// pending orders wait for the next candle to be filled
+	pending []*pendingOrder
+	// shared account of portfolio limits buying with own account kept as trader's part,
+	// allocation is a max part of portfolio equity in position
+	shared        *Account
+	allocation    float64
+	positionValue float64
 
 	candleHistoryOffset int64
+	candleEmittedOffset int64
+	currentCandle       *ds.Candle
 	from, to            time.Time
-	testingTerminate    chan string
-	ordersCh            chan ds.Order
 	trId                string
 	interval            ds.CandleInterval
 
-	storage IStorage
-	logger  trader.ILogger
-	timer   time.Time
+	storage  IStorage
+	logger   trader.ILogger
+	calendar ICalendar
+	// timer is a simulated clock, it is moved to every candle and a bit further by every order
+	timer     time.Time
+	priceTime time.Time
 }
 
-func NewBacktestBroker(account, commision float64, from, to time.Time, interval ds.CandleInterval, terminator chan string, storage IStorage, l trader.ILogger, trId string) *BacktestBroker {
+func NewBacktestBroker(account, commision float64, from, to time.Time, interval ds.CandleInterval, storage IStorage, l trader.ILogger, trId string, cal ICalendar) *BacktestBroker {
 	return &BacktestBroker{
 		account:           account,
 		minAccount:        account,
 		maxAccount:        account,
 		commissionPercent: commision,
+		exchangeRate:      1,
+		leverage:          1,
 		from:              from,
 		to:                to,
 		interval:          interval,
-		testingTerminate:  terminator,
 		trId:              trId,
 		storage:           storage,
 		logger:            l,
-		ordersCh:          make(chan ds.Order),
+		calendar:          cal,
 	}
 }
 
@@ -53,6 +107,10 @@ func (c *BacktestBroker) FindInstrument(identifier string) (*ds.InstrumentInfo,
 	return nil, nil
 }
 
+func (c *BacktestBroker) FindFutures(basicAsset string) ([]*ds.InstrumentInfo, error) {
+	return nil, nil
+}
+
 func (c *BacktestBroker) UnregisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
 	return nil
 }
@@ -61,6 +119,40 @@ func (c *BacktestBroker) UnregisterLastPriceRecipient(instrInfo *ds.InstrumentIn
 	return nil
 }
 
+// SetExchangeRates sets history of how much of base currency one unit of instrument currency costs
+func (c *BacktestBroker) SetExchangeRates(rates ds.RateHistory) {
+	c.rates = rates
+
+	t := c.priceTime
+	if t.IsZero() {
+		t = c.from
+	}
+	if rate, ok := rates.At(t); ok {
+		c.exchangeRate = rate
+	}
+}
+
+// SetFillCfg sets how orders are filled, by default they are filled at close of the current candle
+func (c *BacktestBroker) SetFillCfg(cfg FillCfg) {
+	c.fill = cfg
+}
+
+// SetFeeCfg sets tariff of broker and exchange, commission percent is used below its tiers
+func (c *BacktestBroker) SetFeeCfg(cfg FeeCfg) {
+	c.fees = cfg
+}
+
+// SetMargin allows to hold position up to leverage of equity paying interest for borrowed money
+func (c *BacktestBroker) SetMargin(leverage, interestPercent float64) {
+	c.leverage = leverage
+	c.interestPercent = interestPercent
+}
+
+// Now returns time of the current candle
+func (c *BacktestBroker) Now() time.Time {
+	return c.priceTime
+}
+
 func (c *BacktestBroker) GetAccoountId() string {
 	return "TEST_ACCOUNT"
 }
@@ -92,20 +184,11 @@ func (c *BacktestBroker) GetInstrumentInfo(uid string) (*ds.InstrumentInfo, erro
 }
 
 func (c *BacktestBroker) RecieveLastPrice(_ context.Context, instrInfo *ds.InstrumentInfo) (*ds.LastPrice, error) {
-	c.candleHistoryOffset++
-
-	candle, err := c.storage.GetCandleWithOffset(instrInfo, c.interval, c.from, c.to, c.candleHistoryOffset)
+	candle, err := c.nextCandle(instrInfo)
 	if err != nil {
-		select {
-		case c.testingTerminate <- err.Error():
-			close(c.testingTerminate)
-		default:
-		}
 		return nil, err
 	}
 
-	c.lastPrice = candle.Close.ToFloat64()
-
 	return &ds.LastPrice{
 		Figi: instrInfo.Figi,
 		Uid:  instrInfo.Uid,
@@ -117,96 +200,397 @@ func (c *BacktestBroker) RecieveLastPrice(_ context.Context, instrInfo *ds.Instr
 	}, nil
 }
 
+// RecieveCandle gives the candle of the last price if it was not given yet,
+// otherwise moves to the next candle as well as RecieveLastPrice
+func (c *BacktestBroker) RecieveCandle(_ context.Context, instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) (*ds.Candle, error) {
+	if interval != c.interval {
+		return nil, fmt.Errorf("backtest has candles only with interval %s", c.interval.ToString())
+	}
+
+	if c.currentCandle != nil && c.candleEmittedOffset < c.candleHistoryOffset {
+		c.candleEmittedOffset = c.candleHistoryOffset
+		return c.currentCandle, nil
+	}
+
+	candle, err := c.nextCandle(instrInfo)
+	if err != nil {
+		return nil, err
+	}
+	c.candleEmittedOffset = c.candleHistoryOffset
+
+	return candle, nil
+}
+
+func (c *BacktestBroker) nextCandle(instrInfo *ds.InstrumentInfo) (*ds.Candle, error) {
+	c.candleHistoryOffset++
+
+	candle, err := c.storage.GetCandleWithOffset(instrInfo, c.interval, c.from, c.to, c.candleHistoryOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	if rate, ok := c.rates.At(candle.Timestamp); ok {
+		c.exchangeRate = rate
+	}
+	c.settleBond(instrInfo, c.priceTime, candle.Timestamp)
+	c.chargeInterest(c.priceTime, candle.Timestamp)
+
+	c.currentCandle = candle
+	c.lastPrice = candle.Close.ToFloat64()
+	c.priceTime = candle.Timestamp
+	if c.timer.Before(candle.Timestamp) {
+		c.timer = candle.Timestamp
+	}
+	c.fillPending(instrInfo, candle)
+	c.revalue(instrInfo)
+
+	c.storage.PutEquity(report.EquityPoint{
+		Time:   c.priceTime,
+		Equity: c.account + c.positionValue,
+		Lots:   c.lots,
+	})
+
+	return candle, nil
+}
+
+// NextTime returns time of the next candle, false when candles are over
+func (c *BacktestBroker) NextTime(instrInfo *ds.InstrumentInfo) (time.Time, bool) {
+	candle, err := c.storage.GetCandleWithOffset(instrInfo, c.interval, c.from, c.to, c.candleHistoryOffset+1)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return candle.Timestamp, true
+}
+
+func (c *BacktestBroker) revalue(instrInfo *ds.InstrumentInfo) {
+	c.positionValue = instrInfo.LotsCost(c.lastPrice, c.lots) * c.exchangeRate
+}
+
+// addCash changes own account and shared account of portfolio
+func (c *BacktestBroker) addCash(amount float64) {
+	c.account += amount
+	c.minAccount = min(c.minAccount, c.account)
+	c.maxAccount = max(c.maxAccount, c.account)
+	if c.shared != nil {
+		c.shared.cash += amount
+	}
+}
+
+// chargeInterest takes interest for borrowed money between two prices
+func (c *BacktestBroker) chargeInterest(from, to time.Time) {
+	if c.account >= 0 || c.interestPercent <= 0 || from.IsZero() {
+		return
+	}
+
+	interest := -c.account * c.interestPercent / 100 * float64(to.Sub(from)) / float64(time.Hour*24*365)
+	c.addCash(-interest)
+	c.storage.PutInterest(interest)
+}
+
+// payInterest takes part of interest charged by shared account from own account of the broker
+func (c *BacktestBroker) payInterest(interest float64) {
+	c.account -= interest
+	c.minAccount = min(c.minAccount, c.account)
+	c.storage.PutInterest(interest)
+}
+
+// settleBond pays coupons and redemption of held bonds between two prices.
+// Orders waiting at maturity are cancelled as the bond is not traded anymore.
+func (c *BacktestBroker) settleBond(instrInfo *ds.InstrumentInfo, from, to time.Time) {
+	if !instrInfo.IsBond() || from.IsZero() {
+		return
+	}
+
+	bonds := float64(c.lots) * float64(instrInfo.Lot)
+	for _, coupon := range instrInfo.Coupons {
+		if coupon.Date.After(from) && !coupon.Date.After(to) {
+			c.addCash(coupon.Amount.ToFloat64() * bonds * c.exchangeRate)
+		}
+	}
+
+	if m := instrInfo.MaturityDate; m != nil && m.After(from) && !m.After(to) {
+		c.addCash(instrInfo.Nominal.ToFloat64() * bonds * c.exchangeRate)
+		c.lots = 0
+
+		for _, order := range c.pending {
+			c.cancelOrder(instrInfo, order)
+		}
+		c.pending = nil
+	}
+}
+
 func (c *BacktestBroker) MakeBuyOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, _ string) (*ds.PostOrderResult, error) {
 
 	if lots < 1 {
 		return nil, fmt.Errorf("invalid buy lots amount. lots: %d", lots)
 	}
 
-	price := c.lastPrice * float64(lots) * float64(instrInfo.Lot)
+	return c.placeOrder(instrInfo, ds.Buy, lots, requestId)
+}
 
-	commission := price * c.commissionPercent
-	c.account -= (price + commission)
-	if c.account < c.minAccount {
-		c.minAccount = c.account
+func (c *BacktestBroker) MakeSellOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, _ string) (*ds.PostOrderResult, error) {
+	if lots < 1 {
+		return nil, fmt.Errorf("invalid lots amount. lots: %d", lots)
 	}
 
-	t := c.timer
-	c.timer = c.timer.Add(time.Second)
+	return c.placeOrder(instrInfo, ds.Sell, lots, requestId)
+}
 
-	orderPrice := ds.Quotation{}
-	orderPrice.FromFloat64(c.lastPrice)
+// placeOrder fills order on the current candle with close model, otherwise order waits for the next candle
+func (c *BacktestBroker) placeOrder(instrInfo *ds.InstrumentInfo, direction ds.Action, lots int64, requestId string) (*ds.PostOrderResult, error) {
+	if c.currentCandle == nil {
+		return nil, fmt.Errorf("no candle to make order on")
+	}
 
-	c.storage.PutOrder(c.trId, instrInfo, &ds.Order{
-		CreatedAt:             &t,
-		CompletionTime:        &t,
-		OrderId:               requestId,
-		Direction:             "BUY",
-		ExecutionReportStatus: "FILL",
-		OrderPrice:            orderPrice,
-		LotsRequested:         lots,
-		LotsExecuted:          lots,
-	})
+	if err := c.checkOrder(instrInfo, direction, lots); err != nil {
+		c.reject(direction, lots, err)
+		return nil, err
+	}
+
+	order := &pendingOrder{
+		requestId: requestId,
+		direction: direction,
+		lots:      lots,
+		price:     c.lastPrice,
+	}
+	if direction == ds.Buy {
+		order.reserve = c.orderCost(instrInfo, c.lastPrice, lots)
+	}
+
+	if c.fill.immediate() {
+		if err := c.fillOrder(instrInfo, order, c.currentCandle); err != nil {
+			return nil, err
+		}
+	}
+
+	status := ds.Fill
+	if order.executed < order.lots {
+		c.pending = append(c.pending, order)
+		status = ds.New
+		if order.executed > 0 {
+			status = ds.PartiallyFill
+		}
+	}
+
+	orderPrice := ds.Quotation{}
+	orderPrice.FromFloat64(order.averagePrice())
 
 	commissionQuotation := ds.Quotation{}
-	commissionQuotation.FromFloat64(commission)
+	commissionQuotation.FromFloat64(order.commission)
 
 	return &ds.PostOrderResult{
 		ExecutedOrderPrice:    orderPrice,
-		LotsExecuted:          lots,
+		LotsExecuted:          order.executed,
 		ExecutedCommission:    commissionQuotation,
 		InstrumentUid:         instrInfo.Uid,
-		ExecutionReportStatus: "success",
+		ExecutionReportStatus: status.ToString(),
 		OrderId:               requestId,
 	}, nil
 }
 
-func (c *BacktestBroker) MakeSellOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, _ string) (*ds.PostOrderResult, error) {
-	if lots < 1 {
-		return nil, fmt.Errorf("invalid lots amount. lots: %d", lots)
+// checkOrder rejects buy when its cost is over buying power and sell of more lots than held,
+// lots and money of waiting orders are reserved
+func (c *BacktestBroker) checkOrder(instrInfo *ds.InstrumentInfo, direction ds.Action, lots int64) error {
+	var pendingSell int64
+	for _, o := range c.pending {
+		if o.direction == ds.Sell {
+			pendingSell += o.lots - o.executed
+		}
+	}
+
+	if direction == ds.Sell {
+		if held := c.lots - pendingSell; lots > held {
+			return fmt.Errorf("not enough lots to sell: %d, held: %d", lots, held)
+		}
+		return nil
 	}
 
-	price := c.lastPrice * float64(lots) * float64(instrInfo.Lot)
+	required := c.orderCost(instrInfo, c.lastPrice, lots)
+	if available := c.buyingPower(instrInfo) - c.reserved(); required > available {
+		return fmt.Errorf("not enough buying power: %.2f, required: %.2f", available, required)
+	}
+
+	return nil
+}
 
-	commission := price * c.commissionPercent
-	c.account += (price - commission)
-	if c.account > c.maxAccount {
-		c.maxAccount = c.account
+// buyingPower is money which can be spent on buying, held position with it is not over leverage of equity.
+// In portfolio it is limited by shared account and by allocation of the trader.
+func (c *BacktestBroker) buyingPower(instrInfo *ds.InstrumentInfo) float64 {
+	if c.shared == nil {
+		value := instrInfo.LotsCost(c.lastPrice, c.lots) * c.exchangeRate
+		return (c.account+value)*c.leverage - value
+	}
+
+	power := c.shared.buyingPower()
+	if c.allocation > 0 {
+		power = min(power, c.shared.Equity()*c.allocation-c.positionValue)
+	}
+	return power
+}
+
+// reserved is money of waiting buy orders, in portfolio of all its brokers
+func (c *BacktestBroker) reserved() float64 {
+	if c.shared == nil {
+		return c.pendingBuyCost()
+	}
+
+	var sum float64
+	for _, b := range c.shared.brokers {
+		sum += b.pendingBuyCost()
+	}
+	return sum
+}
+
+func (c *BacktestBroker) pendingBuyCost() float64 {
+	var sum float64
+	for _, o := range c.pending {
+		if o.direction == ds.Buy {
+			sum += o.reserve * float64(o.lots-o.executed) / float64(o.lots)
+		}
+	}
+	return sum
+}
+
+// orderCost is money in base currency to buy lots at price with fees and accrued interest
+func (c *BacktestBroker) orderCost(instrInfo *ds.InstrumentInfo, price float64, lots int64) float64 {
+	amount := instrInfo.LotsCost(price, lots) * c.exchangeRate
+	aci := instrInfo.AccruedInterest(c.priceTime) * float64(lots) * float64(instrInfo.Lot) * c.exchangeRate
+	return amount + aci + c.fees.fee(amount, c.turnover, c.commissionPercent)
+}
+
+// commission is fee in instrument currency for order amount in it, turnover of the month grows by the order
+func (c *BacktestBroker) commission(amount float64) float64 {
+	month := time.Date(c.priceTime.Year(), c.priceTime.Month(), 1, 0, 0, 0, 0, c.priceTime.Location())
+	if !month.Equal(c.turnoverMonth) {
+		c.turnover = 0
+		c.turnoverMonth = month
+	}
+
+	base := amount * c.exchangeRate
+	fee := c.fees.fee(base, c.turnover, c.commissionPercent)
+	c.turnover += base
+
+	return fee / c.exchangeRate
+}
+
+func (c *BacktestBroker) reject(direction ds.Action, lots int64, err error) {
+	c.storage.PutRejection(&report.Rejection{Time: c.priceTime, Direction: direction, Lots: lots, Reason: err.Error()})
+}
+
+// fillPending tries to fill waiting orders on the new candle, limit and stop orders
+// which are not reached by the candle are cancelled
+func (c *BacktestBroker) fillPending(instrInfo *ds.InstrumentInfo, candle *ds.Candle) {
+	pending := c.pending[:0]
+	for _, order := range c.pending {
+		if err := c.fillOrder(instrInfo, order, candle); err != nil {
+			c.cancelOrder(instrInfo, order)
+			continue
+		}
+
+		if order.executed < order.lots {
+			pending = append(pending, order)
+		}
+	}
+	c.pending = pending
+}
+
+// fillOrder executes lots of order allowed by the candle volume and buying power, error is returned
+// when the candle does not reach price of the order or nothing can be bought or sold
+func (c *BacktestBroker) fillOrder(instrInfo *ds.InstrumentInfo, order *pendingOrder, candle *ds.Candle) error {
+	fillPrice, ok := c.fill.price(order.direction, order.price, candle)
+	if !ok {
+		return fmt.Errorf("price %.4f of order is not reached by candle", order.price)
+	}
+
+	lots := c.fill.lots(order.lots-order.executed, candle)
+	if order.direction == ds.Buy {
+		power := c.buyingPower(instrInfo)
+		affordable := int64(sort.Search(int(lots), func(i int) bool {
+			return c.orderCost(instrInfo, fillPrice, int64(i+1)) > power
+		}))
+		if affordable < 1 && lots > 0 {
+			err := fmt.Errorf("not enough buying power to fill order")
+			c.reject(order.direction, order.lots-order.executed, err)
+			return err
+		}
+		lots = affordable
+	} else {
+		if c.lots < 1 && lots > 0 {
+			err := fmt.Errorf("no lots to sell")
+			c.reject(order.direction, order.lots-order.executed, err)
+			return err
+		}
+		lots = min(lots, c.lots)
+	}
+	if lots <= 0 {
+		return nil
 	}
 
+	price := instrInfo.LotsCost(fillPrice, lots)
+	aci := instrInfo.AccruedInterest(c.priceTime) * float64(lots) * float64(instrInfo.Lot)
+	commission := c.commission(price)
+
+	if order.direction == ds.Buy {
+		c.addCash(-(price + commission + aci) * c.exchangeRate)
+		c.lots += lots
+	} else {
+		c.addCash((price - commission + aci) * c.exchangeRate)
+		c.lots -= lots
+	}
+	c.revalue(instrInfo)
+
+	c.storage.PutFill(&report.Fill{Time: c.priceTime, Direction: order.direction, Lots: lots, Price: fillPrice,
+		Amount: price * c.exchangeRate, Commission: commission * c.exchangeRate})
+
+	order.executed += lots
+	order.amount += fillPrice * float64(lots)
+	order.commission += commission
+
+	status := ds.Fill
+	if order.executed < order.lots {
+		status = ds.PartiallyFill
+	}
+	c.putOrder(instrInfo, order, status)
+
+	return nil
+}
+
+// cancelOrder removes order without fills, partially filled order stays with its executed lots
+func (c *BacktestBroker) cancelOrder(instrInfo *ds.InstrumentInfo, order *pendingOrder) {
+	if order.executed > 0 {
+		c.putOrder(instrInfo, order, ds.Fill)
+		return
+	}
+
+	if err := c.storage.RemoveOrder(instrInfo, &ds.Order{OrderId: order.requestId}); err != nil {
+		c.logger.ErrorfKV("failed removing cancelled order",
+			ds.HistoryColOrderId, order.requestId, ds.HistoryColError, err.Error())
+	}
+}
+
+func (c *BacktestBroker) putOrder(instrInfo *ds.InstrumentInfo, order *pendingOrder, status ds.OrderStatus) {
 	t := c.timer
-	c.timer = c.timer.Add(time.Second)
+	c.timer = c.timer.Add(time.Millisecond)
 
 	orderPrice := ds.Quotation{}
-	orderPrice.FromFloat64(c.lastPrice)
+	orderPrice.FromFloat64(order.averagePrice())
 
 	c.storage.PutOrder(c.trId, instrInfo, &ds.Order{
 		CreatedAt:             &t,
 		CompletionTime:        &t,
-		OrderId:               requestId,
-		Direction:             "SELL",
-		ExecutionReportStatus: "FILL",
+		OrderId:               order.requestId,
+		Direction:             order.direction.ToString(),
+		ExecutionReportStatus: status.ToString(),
 		OrderPrice:            orderPrice,
-		LotsRequested:         lots,
-		LotsExecuted:          lots,
+		LotsRequested:         order.lots,
+		LotsExecuted:          order.executed,
 	})
-
-	commissionQuotation := ds.Quotation{}
-	commissionQuotation.FromFloat64(commission)
-
-	return &ds.PostOrderResult{
-		ExecutedOrderPrice:    orderPrice,
-		LotsExecuted:          lots,
-		ExecutedCommission:    commissionQuotation,
-		InstrumentUid:         instrInfo.Uid,
-		ExecutionReportStatus: "success",
-		OrderId:               requestId,
-	}, nil
 }
 
-func (c *BacktestBroker) RecieveOrdersUpdate(_ context.Context, instrInfo *ds.InstrumentInfo, _ string) (*ds.Order, error) {
-	v := <-c.ordersCh
-	return &v, nil
+// RecieveOrdersUpdate has nothing to give because broker puts orders to storage itself, it waits for the end of context
+func (c *BacktestBroker) RecieveOrdersUpdate(ctx context.Context, instrInfo *ds.InstrumentInfo, _ string) (*ds.Order, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
 }
 
 func (c *BacktestBroker) RegisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
@@ -218,5 +602,63 @@ func (c *BacktestBroker) RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo
 }
 
 func (c *BacktestBroker) GetTradingAvailability(instrInfo *ds.InstrumentInfo) (ds.TradingAvailability, error) {
-	return ds.Available, nil
+	if c.calendar == nil {
+		return ds.Available, nil
+	}
+
+	availability, _, err := c.calendar.GetTradingAvailability(instrInfo, c.priceTime)
+	return availability, err
+}
+
+func (c *BacktestBroker) GetTradingSession(instrInfo *ds.InstrumentInfo) (ds.TradingSession, error) {
+	if c.calendar == nil {
+		return ds.SessionMain, nil
+	}
+
+	_, session, err := c.calendar.GetTradingAvailability(instrInfo, c.priceTime)
+	return session, err
+}
+
+func (c *BacktestBroker) RegisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error {
+	if interval != c.interval {
+		return fmt.Errorf("backtest has candles only with interval %s", c.interval.ToString())
+	}
+
+	return nil
+}
+
+func (c *BacktestBroker) UnregisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error {
+	return nil
+}
+
+func (c *BacktestBroker) RegisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error {
+	return nil
+}
+
+func (c *BacktestBroker) UnregisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error {
+	return nil
+}
+
+// RecieveOrderBook gives order book of one level on both sides made of the last candle,
+// because history of order books is not stored. Bid and ask are spread and slippage of fill
+// model around close, so the book has zero spread when they are not configured
+func (c *BacktestBroker) RecieveOrderBook(_ context.Context, instrInfo *ds.InstrumentInfo, depth int32) (*ds.OrderBook, error) {
+	if c.currentCandle == nil {
+		return nil, fmt.Errorf("no candles for order book of %s yet", instrInfo.Ticker)
+	}
+
+	bidPrice, askPrice, quantity := c.fill.quote(c.currentCandle)
+	bid, ask := ds.OrderBookLevel{Quantity: quantity}, ds.OrderBookLevel{Quantity: quantity}
+	bid.Price.FromFloat64(bidPrice)
+	ask.Price.FromFloat64(askPrice)
+
+	return &ds.OrderBook{
+		Figi:         instrInfo.Figi,
+		Uid:          instrInfo.Uid,
+		Depth:        depth,
+		IsConsistent: true,
+		Bids:         []ds.OrderBookLevel{bid},
+		Asks:         []ds.OrderBookLevel{ask},
+		Time:         c.priceTime,
+	}, nil
 }
@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+	"trading_bot/internal/logger"
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerConstraints(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	step := time.Hour * 24 * 365 / 100
+	// the first candle is skipped by broker
+	candles := []*ds.Candle{
+		testCandle(start, 100, 100, 100, 100, 100),
+		testCandle(start.Add(step), 100, 100, 100, 100, 100),
+		testCandle(start.Add(step*2), 100, 100, 100, 100, 100),
+	}
+	instrInfo := ds.InstrumentInfo{Uid: "uid", Lot: 1}
+
+	newBroker := func() (*BacktestBroker, *BacktestStorage) {
+		storage := NewBacktestStorage(instrInfo, candles)
+		broker := NewBacktestBroker(1000, 0, start, start.Add(step*10), ds.Interval_Day, storage,
+			logger.NewLogger(io.Discard, "TEST", nil), "trader", nil)
+		_, err := broker.RecieveLastPrice(context.Background(), &instrInfo)
+		require.NoError(t, err)
+		return broker, storage
+	}
+
+	t.Run("cash", func(t *testing.T) {
+		t.Parallel()
+
+		broker, storage := newBroker()
+
+		_, err := broker.MakeBuyOrder(&instrInfo, 11, "buy", "")
+		require.Error(t, err)
+		_, err = broker.MakeBuyOrder(&instrInfo, 10, "buy", "")
+		require.NoError(t, err)
+		require.InDelta(t, 0.0, broker.GetAccoount(), 1e-9)
+
+		_, err = broker.MakeSellOrder(&instrInfo, 11, "sell", "")
+		require.Error(t, err)
+		_, err = broker.MakeSellOrder(&instrInfo, 10, "sell", "")
+		require.NoError(t, err)
+
+		r := storage.Report("test", ds.CurrencyRub)
+		require.Equal(t, 2, r.Rejections)
+		require.Equal(t, 2, len(storage.Rejections()))
+	})
+
+	t.Run("fees", func(t *testing.T) {
+		t.Parallel()
+
+		broker, storage := newBroker()
+		broker.SetFeeCfg(FeeCfg{
+			Tiers:           []FeeTier{{Turnover: 0, Percent: 1}, {Turnover: 500, Percent: 0.5}},
+			MinPerOrder:     2,
+			ExchangePercent: 0.1,
+		})
+
+		// minimal fee is taken for the small order
+		_, err := broker.MakeBuyOrder(&instrInfo, 1, "buy1", "")
+		require.NoError(t, err)
+		require.InDelta(t, 1000-100-2-0.1, broker.GetAccoount(), 1e-9)
+
+		_, err = broker.MakeBuyOrder(&instrInfo, 5, "buy2", "")
+		require.NoError(t, err)
+		_, err = broker.MakeSellOrder(&instrInfo, 2, "sell", "")
+		require.NoError(t, err)
+
+		fills := storage.Fills()
+		require.Len(t, fills, 3)
+		require.InDelta(t, 5+0.5, fills[1].Commission, 1e-9)
+		// turnover is over 500 after the second order
+		require.InDelta(t, 2+0.2, fills[2].Commission, 1e-9)
+
+		require.Error(t, (&FeeCfg{Tiers: []FeeTier{{Turnover: 10}, {Turnover: 5}}}).Validate())
+	})
+
+	t.Run("margin", func(t *testing.T) {
+		t.Parallel()
+
+		broker, storage := newBroker()
+		broker.SetMargin(2, 10)
+
+		_, err := broker.MakeBuyOrder(&instrInfo, 21, "buy", "")
+		require.Error(t, err)
+		_, err = broker.MakeBuyOrder(&instrInfo, 20, "buy", "")
+		require.NoError(t, err)
+		require.InDelta(t, -1000.0, broker.GetAccoount(), 1e-9)
+
+		// interest of 10% a year for a hundredth of a year
+		_, err = broker.RecieveLastPrice(context.Background(), &instrInfo)
+		require.NoError(t, err)
+		require.InDelta(t, 1.0, storage.Interest(), 1e-9)
+		require.InDelta(t, -1001.0, broker.GetAccoount(), 1e-9)
+	})
+
+	t.Run("exchange rates", func(t *testing.T) {
+		t.Parallel()
+
+		broker, storage := newBroker()
+		broker.SetExchangeRates(ds.RateHistory{{Time: start, Rate: 2}, {Time: start.Add(step * 2), Rate: 3}})
+
+		// rate of the current candle is applied at once
+		_, err := broker.MakeBuyOrder(&instrInfo, 5, "buy", "")
+		require.NoError(t, err)
+		require.InDelta(t, 0.0, broker.GetAccoount(), 1e-9)
+
+		_, err = broker.RecieveLastPrice(context.Background(), &instrInfo)
+		require.NoError(t, err)
+
+		equity := storage.Equity()
+		require.InDelta(t, 1500.0, equity[len(equity)-1].Equity, 1e-9)
+	})
+
+	t.Run("fill error", func(t *testing.T) {
+		t.Parallel()
+
+		broker, _ := newBroker()
+		broker.SetFillCfg(FillCfg{Model: FillModelLimit})
+
+		// the cause of not filled order is returned, not buying power
+		err := broker.fillOrder(&instrInfo, &pendingOrder{requestId: "buy", direction: ds.Buy, lots: 1, price: 50}, candles[1])
+		require.ErrorContains(t, err, "not reached")
+		err = broker.fillOrder(&instrInfo, &pendingOrder{requestId: "sell", direction: ds.Sell, lots: 1, price: 100}, candles[1])
+		require.ErrorContains(t, err, "no lots to sell")
+	})
+
+	t.Run("bond maturity", func(t *testing.T) {
+		t.Parallel()
+
+		maturity := start.Add(step * 5 / 2)
+		bond := ds.InstrumentInfo{Uid: "bond", Lot: 1, Type: ds.InstrumentTypeBond, MaturityDate: &maturity}
+		bond.Nominal.FromFloat64(100)
+		storage := NewBacktestStorage(bond, append(candles, testCandle(start.Add(step*3), 100, 100, 100, 100, 100)))
+		broker := NewBacktestBroker(1000, 0, start, start.Add(step*10), ds.Interval_Day, storage,
+			logger.NewLogger(io.Discard, "TEST", nil), "trader", nil)
+		// one lot is filled on every candle
+		broker.SetFillCfg(FillCfg{Model: FillModelNextOpen, MaxVolumePercent: 1})
+
+		_, err := broker.RecieveLastPrice(context.Background(), &bond)
+		require.NoError(t, err)
+		res, err := broker.MakeBuyOrder(&bond, 5, "buy", "")
+		require.NoError(t, err)
+		require.Equal(t, ds.New.ToString(), res.ExecutionReportStatus)
+
+		_, err = broker.RecieveLastPrice(context.Background(), &bond)
+		require.NoError(t, err)
+		require.Len(t, broker.pending, 1)
+
+		// waiting order is cancelled at maturity and the held lot is redeemed
+		_, err = broker.RecieveLastPrice(context.Background(), &bond)
+		require.NoError(t, err)
+		require.Empty(t, broker.pending)
+		require.Equal(t, int64(0), broker.lots)
+		require.InDelta(t, 1000.0, broker.GetAccoount(), 1e-9)
+		require.Equal(t, int64(1), storage.orders["buy"].LotsExecuted)
+		require.Equal(t, ds.Fill.ToString(), storage.orders["buy"].ExecutionReportStatus)
+	})
+
+	t.Run("order book", func(t *testing.T) {
+		t.Parallel()
+
+		broker, _ := newBroker()
+
+		// without spread and slippage the book has zero spread
+		book, err := broker.RecieveOrderBook(context.Background(), &instrInfo, 1)
+		require.NoError(t, err)
+		require.Equal(t, book.Bids[0].Price, book.Asks[0].Price)
+		require.Equal(t, int64(100), book.Bids[0].Quantity)
+
+		broker.SetFillCfg(FillCfg{SpreadPercent: 2, SlippagePercent: 0.5, MaxVolumePercent: 10})
+		book, err = broker.RecieveOrderBook(context.Background(), &instrInfo, 1)
+		require.NoError(t, err)
+		require.InDelta(t, 98.5, book.Bids[0].Price.ToFloat64(), 1e-9)
+		require.InDelta(t, 101.5, book.Asks[0].Price.ToFloat64(), 1e-9)
+		require.Equal(t, int64(10), book.Asks[0].Quantity)
+	})
+}
@@ -0,0 +1,127 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+)
+
+// Engine backtests strategy in one goroutine. Every step moves the broker to the next candle,
+// asks strategy for decision on its close price and passes orders to broker, which fills them
+// with its fill model, so runs on the same candles are reproducible.
+type Engine struct {
+	broker   *BacktestBroker
+	strategy trader.IStrategy
+	logger   trader.ILogger
+	cfg      *trader.TraderCfg
+	steps    int64
+}
+
+func NewEngine(broker *BacktestBroker, strategy trader.IStrategy, l trader.ILogger, cfg *trader.TraderCfg) *Engine {
+	return &Engine{
+		broker:   broker,
+		strategy: strategy,
+		logger:   l,
+		cfg:      cfg,
+	}
+}
+
+// Run steps till the end of candles or context
+func (e *Engine) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ok, err := e.Step(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// Step processes one candle, false is returned when candles are over.
+// Errors of strategy and orders are logged and skip the candle as trader does.
+func (e *Engine) Step(ctx context.Context) (bool, error) {
+	instrInfo := e.cfg.InstrInfo
+
+	lastPrice, err := e.broker.RecieveLastPrice(ctx, instrInfo)
+	if errors.Is(err, ErrNoMoreCandles) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.steps++
+
+	if !e.tradable(instrInfo) {
+		return true, nil
+	}
+
+	actions, err := e.strategy.GetActionDecision(ctx, e.cfg.TraderId, instrInfo, lastPrice)
+	if err != nil {
+		e.logger.ErrorfKV("failed getting action decision",
+			ds.HistoryColInstrumentUID, instrInfo.Uid, ds.HistoryColError, err.Error())
+		return true, nil
+	}
+
+	for _, action := range actions {
+		switch action.Action {
+		case ds.Buy:
+			_, err = e.broker.MakeBuyOrder(instrInfo, action.Lots, action.RequestId, e.cfg.AccountId)
+		case ds.Sell:
+			_, err = e.broker.MakeSellOrder(instrInfo, action.Lots, action.RequestId, e.cfg.AccountId)
+		default:
+			continue
+		}
+
+		if err != nil {
+			e.logger.ErrorfKV("failed executing action",
+				ds.HistoryColAction, action.Action.ToString(), ds.HistoryColLots, action.Lots,
+				ds.HistoryColTicker, instrInfo.Ticker, ds.HistoryColError, err.Error())
+			if action.OnErrorFunc != nil {
+				if err := action.OnErrorFunc(); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Steps returns count of processed candles
+func (e *Engine) Steps() int64 {
+	return e.steps
+}
+
+func (e *Engine) tradable(instrInfo *ds.InstrumentInfo) bool {
+	status, err := e.broker.GetTradingAvailability(instrInfo)
+	if err != nil {
+		e.logger.ErrorfKV("failed getting trading availability",
+			ds.HistoryColInstrumentUID, instrInfo.Uid, ds.HistoryColError, err.Error())
+		return false
+	}
+
+	if status == ds.NotAvailableViaAPI {
+		return false
+	}
+
+	if len(e.cfg.Sessions) > 0 {
+		session, err := e.broker.GetTradingSession(instrInfo)
+		if err != nil {
+			e.logger.ErrorfKV("failed getting trading session",
+				ds.HistoryColInstrumentUID, instrInfo.Uid, ds.HistoryColError, err.Error())
+			return false
+		}
+		return slices.Contains(e.cfg.Sessions, session)
+	}
+
+	return status != ds.NotAvailableNow
+}
@@ -0,0 +1,150 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+	"trading_bot/internal/logger"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+
+	"github.com/stretchr/testify/require"
+)
+
+// swingStrategy buys below 100 and sells above it, its orders may call on error function
+type swingStrategy struct {
+	lots      int64
+	held      bool
+	orders    int
+	decisions []time.Time
+	onError   func() error
+}
+
+func (s *swingStrategy) GetActionDecision(_ context.Context, _ string, _ *ds.InstrumentInfo, lp *ds.LastPrice) ([]*ds.StrategyAction, error) {
+	s.decisions = append(s.decisions, lp.Time)
+
+	price := lp.Price.ToFloat64()
+	action := &ds.StrategyAction{Lots: s.lots, OnErrorFunc: s.onError}
+	switch {
+	case price < 100 && !s.held:
+		action.Action = ds.Buy
+	case price > 100 && s.held:
+		action.Action = ds.Sell
+	default:
+		return nil, nil
+	}
+
+	s.held = !s.held
+	s.orders++
+	action.RequestId = fmt.Sprintf("order-%d", s.orders)
+	return []*ds.StrategyAction{action}, nil
+}
+
+func (s *swingStrategy) GetName() string {
+	return "swing"
+}
+
+func (s *swingStrategy) UpdateConfig(map[string]any) error {
+	return nil
+}
+
+// testCalendar closes trading at the hours and gives session of the rest
+type testCalendar struct {
+	closed  map[int]bool
+	session func(t time.Time) ds.TradingSession
+}
+
+func (c *testCalendar) GetTradingAvailability(_ *ds.InstrumentInfo, t time.Time) (ds.TradingAvailability, ds.TradingSession, error) {
+	if c.closed[t.Hour()] {
+		return ds.NotAvailableNow, ds.SessionClosed, nil
+	}
+	return ds.Available, c.session(t), nil
+}
+
+func TestEngine(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	l := logger.NewLogger(io.Discard, "TEST", nil)
+	instrInfo := ds.InstrumentInfo{Uid: "uid", Lot: 1}
+
+	newEngine := func(strategy *swingStrategy, cal ICalendar, sessions []ds.TradingSession) (*Engine, *BacktestStorage) {
+		// the first candle is skipped by broker
+		var candles []*ds.Candle
+		for i, price := range []float64{100, 98, 102, 97, 103, 99, 101, 96} {
+			candles = append(candles, testCandle(start.Add(time.Hour*time.Duration(i)), price, price+1, price-1, price, 100))
+		}
+		storage := NewBacktestStorage(instrInfo, candles)
+		broker := NewBacktestBroker(1000, 0.001, start, start.Add(time.Hour*24), ds.Interval_Hour, storage, l, "trader", cal)
+		broker.SetFillCfg(FillCfg{Model: FillModelNextOpen, SlippagePercent: 0.1, VolatilitySlippage: 0.1})
+		return NewEngine(broker, strategy, l, &trader.TraderCfg{InstrInfo: &instrInfo, TraderId: "trader", Sessions: sessions}), storage
+	}
+
+	t.Run("reproducible", func(t *testing.T) {
+		t.Parallel()
+
+		first, firstStorage := newEngine(&swingStrategy{lots: 5}, nil, nil)
+		require.NoError(t, first.Run(context.Background()))
+		second, secondStorage := newEngine(&swingStrategy{lots: 5}, nil, nil)
+		require.NoError(t, second.Run(context.Background()))
+
+		require.Equal(t, int64(7), first.Steps())
+		require.Len(t, firstStorage.Fills(), 6)
+		require.Equal(t, firstStorage.Fills(), secondStorage.Fills())
+		require.Equal(t, firstStorage.Equity(), secondStorage.Equity())
+	})
+
+	t.Run("on error function", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int
+		strategy := &swingStrategy{lots: 20, onError: func() error {
+			calls++
+			return nil
+		}}
+		engine, storage := newEngine(strategy, nil, nil)
+
+		// buying over deposit is rejected and the candle is skipped
+		ok, err := engine.Step(context.Background())
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, 1, calls)
+		require.Len(t, storage.Rejections(), 1)
+
+		strategy.held = false
+		strategy.onError = func() error { return errors.New("on error failed") }
+		// price of the next candle is over 100, there are no orders
+		_, err = engine.Step(context.Background())
+		require.NoError(t, err)
+		_, err = engine.Step(context.Background())
+		require.Error(t, err)
+	})
+
+	t.Run("skips closed trading and other sessions", func(t *testing.T) {
+		t.Parallel()
+
+		cal := &testCalendar{
+			closed: map[int]bool{12: true},
+			session: func(t time.Time) ds.TradingSession {
+				if t.Hour() >= 15 {
+					return ds.SessionEvening
+				}
+				return ds.SessionMain
+			},
+		}
+
+		strategy := &swingStrategy{lots: 1}
+		engine, _ := newEngine(strategy, cal, nil)
+		require.NoError(t, engine.Run(context.Background()))
+		require.Len(t, strategy.decisions, 6)
+		require.NotContains(t, strategy.decisions, start.Add(time.Hour*2))
+
+		strategy = &swingStrategy{lots: 1}
+		engine, _ = newEngine(strategy, cal, []ds.TradingSession{ds.SessionMain})
+		require.NoError(t, engine.Run(context.Background()))
+		require.Equal(t, []time.Time{start.Add(time.Hour), start.Add(time.Hour * 3), start.Add(time.Hour * 4)}, strategy.decisions)
+	})
+}
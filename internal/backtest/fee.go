@@ -0,0 +1,46 @@
+package backtest
+
+import "fmt"
+
+// FeeTier sets broker fee percent from turnover of the month
+type FeeTier struct {
+	Turnover float64
+	Percent  float64
+}
+
+// FeeCfg is a tariff of broker and exchange. Broker fee is percent of the highest tier reached by
+// turnover of the month but not less than MinPerOrder, exchange fee is added to it.
+// Money is in base currency.
+type FeeCfg struct {
+	Tiers           []FeeTier
+	MinPerOrder     float64
+	ExchangePercent float64
+}
+
+func (f *FeeCfg) Validate() error {
+	for i, tier := range f.Tiers {
+		if tier.Percent < 0 || tier.Turnover < 0 {
+			return fmt.Errorf("fee tier must not be negative")
+		}
+		if i > 0 && tier.Turnover <= f.Tiers[i-1].Turnover {
+			return fmt.Errorf("fee tiers must be sorted by turnover")
+		}
+	}
+
+	if f.MinPerOrder < 0 || f.ExchangePercent < 0 {
+		return fmt.Errorf("min fee and exchange percent must not be negative")
+	}
+
+	return nil
+}
+
+// fee returns fee for order amount, rate is a fraction used below the first tier
+func (f *FeeCfg) fee(amount, turnover, rate float64) float64 {
+	for _, tier := range f.Tiers {
+		if turnover >= tier.Turnover {
+			rate = tier.Percent / 100
+		}
+	}
+
+	return max(amount*rate, f.MinPerOrder) + amount*f.ExchangePercent/100
+}
@@ -0,0 +1,124 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	ds "trading_bot/internal/service/datastruct"
+)
+
+const (
+	// FillModelClose fills orders at close of the candle the decision is made on
+	FillModelClose = "close"
+	// FillModelNextOpen fills orders at open of the next candle
+	FillModelNextOpen = "next_open"
+	// FillModelLimit places limit orders at the decision price, they are filled when the next candle reaches it
+	FillModelLimit = "limit"
+	// FillModelStop places stop orders at the decision price, they are filled when the next candle crosses it
+	FillModelStop = "stop"
+)
+
+// FillCfg describes how orders of backtest are filled. Spread and slippage move price against
+// the order, volatility slippage is a part of candle range (high - low).
+// MaxVolumePercent limits lots filled on one candle by its volume, the rest waits for the next candles.
+type FillCfg struct {
+	Model              string
+	SlippagePercent    float64
+	VolatilitySlippage float64
+	SpreadPercent      float64
+	MaxVolumePercent   float64
+}
+
+func (f *FillCfg) Validate() error {
+	switch f.Model {
+	case "", FillModelClose, FillModelNextOpen, FillModelLimit, FillModelStop:
+	default:
+		return fmt.Errorf("unknown fill model '%s'", f.Model)
+	}
+
+	if f.SlippagePercent < 0 || f.VolatilitySlippage < 0 || f.SpreadPercent < 0 || f.MaxVolumePercent < 0 {
+		return fmt.Errorf("fill slippage, spread and volume percent must not be negative")
+	}
+
+	return nil
+}
+
+// immediate tells if order is tried to be filled on the candle it is made on
+func (f *FillCfg) immediate() bool {
+	return f.Model == "" || f.Model == FillModelClose
+}
+
+// price returns price of order filled on candle, false is returned when candle does not reach
+// price of limit or stop order
+func (f *FillCfg) price(direction ds.Action, orderPrice float64, candle *ds.Candle) (float64, bool) {
+	open, low, high := candle.Open.ToFloat64(), candle.Low.ToFloat64(), candle.High.ToFloat64()
+
+	var base float64
+	switch f.Model {
+	case FillModelNextOpen:
+		base = open
+	case FillModelLimit:
+		if direction == ds.Buy {
+			if low > orderPrice {
+				return 0, false
+			}
+			base = min(open, orderPrice)
+		} else {
+			if high < orderPrice {
+				return 0, false
+			}
+			base = max(open, orderPrice)
+		}
+	case FillModelStop:
+		if direction == ds.Buy {
+			if high < orderPrice {
+				return 0, false
+			}
+			base = max(open, orderPrice)
+		} else {
+			if low > orderPrice {
+				return 0, false
+			}
+			base = min(open, orderPrice)
+		}
+	default:
+		base = candle.Close.ToFloat64()
+	}
+
+	cost := f.cost(base, candle)
+	if direction == ds.Buy {
+		price := base + cost
+		if f.Model == FillModelLimit {
+			price = min(price, orderPrice)
+		}
+		return price, true
+	}
+
+	price := base - cost
+	if f.Model == FillModelLimit {
+		price = max(price, orderPrice)
+	}
+	return price, true
+}
+
+// cost returns how much spread and slippage move price from base against order
+func (f *FillCfg) cost(base float64, candle *ds.Candle) float64 {
+	return base*(f.SpreadPercent/2+f.SlippagePercent)/100 + (candle.High.ToFloat64()-candle.Low.ToFloat64())*f.VolatilitySlippage
+}
+
+// quote returns best bid and ask around close of candle, they are prices market orders
+// would be filled at by close model, and quantity the candle can fill on each side
+func (f *FillCfg) quote(candle *ds.Candle) (bid, ask float64, quantity int64) {
+	base := candle.Close.ToFloat64()
+	cost := f.cost(base, candle)
+
+	return base - cost, base + cost, f.lots(candle.Volume, candle)
+}
+
+// lots returns how many of lots can be filled on candle
+func (f *FillCfg) lots(lots int64, candle *ds.Candle) int64 {
+	if f.MaxVolumePercent <= 0 {
+		return lots
+	}
+
+	return min(lots, int64(math.Floor(float64(candle.Volume)*f.MaxVolumePercent/100)))
+}
@@ -0,0 +1,116 @@
+package backtest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+	"trading_bot/internal/logger"
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testCandle(t time.Time, open, high, low, close float64, volume int64) *ds.Candle {
+	c := &ds.Candle{Timestamp: t, Volume: volume}
+	c.Open.FromFloat64(open)
+	c.High.FromFloat64(high)
+	c.Low.FromFloat64(low)
+	c.Close.FromFloat64(close)
+	return c
+}
+
+func TestFillPrice(t *testing.T) {
+	t.Parallel()
+
+	candle := testCandle(time.Time{}, 100, 104, 96, 102, 1000)
+
+	cases := []struct {
+		name      string
+		cfg       FillCfg
+		direction ds.Action
+		price     float64
+		expected  float64
+		filled    bool
+	}{
+		{"close", FillCfg{}, ds.Buy, 101, 102, true},
+		{"next open", FillCfg{Model: FillModelNextOpen}, ds.Sell, 101, 100, true},
+		{"limit buy reached", FillCfg{Model: FillModelLimit}, ds.Buy, 98, 98, true},
+		{"limit buy below open", FillCfg{Model: FillModelLimit}, ds.Buy, 101, 100, true},
+		{"limit buy not reached", FillCfg{Model: FillModelLimit}, ds.Buy, 95, 0, false},
+		{"limit sell reached", FillCfg{Model: FillModelLimit}, ds.Sell, 103, 103, true},
+		{"stop buy reached", FillCfg{Model: FillModelStop}, ds.Buy, 103, 103, true},
+		{"stop sell gap", FillCfg{Model: FillModelStop}, ds.Sell, 101, 100, true},
+		{"stop sell not reached", FillCfg{Model: FillModelStop}, ds.Sell, 95, 0, false},
+		{"spread and slippage", FillCfg{SpreadPercent: 2, SlippagePercent: 1}, ds.Buy, 0, 102 * 1.02, true},
+		{"volatility slippage", FillCfg{Model: FillModelNextOpen, VolatilitySlippage: 0.25}, ds.Sell, 0, 98, true},
+		{"limit is not worse with slippage", FillCfg{Model: FillModelLimit, SlippagePercent: 1}, ds.Buy, 98, 98, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			price, ok := c.cfg.price(c.direction, c.price, candle)
+			require.Equal(t, c.filled, ok)
+			require.InDelta(t, c.expected, price, 1e-9)
+		})
+	}
+
+	require.Equal(t, int64(5), (&FillCfg{}).lots(5, candle))
+	require.Equal(t, int64(3), (&FillCfg{MaxVolumePercent: 0.3}).lots(5, candle))
+	require.Error(t, (&FillCfg{Model: "vwap"}).Validate())
+	require.Error(t, (&FillCfg{SpreadPercent: -1}).Validate())
+	require.NoError(t, (&FillCfg{Model: FillModelStop}).Validate())
+}
+
+func TestBrokerPendingOrders(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	// the first candle is skipped by broker
+	candles := []*ds.Candle{
+		testCandle(start, 100, 100, 100, 100, 10),
+		testCandle(start.Add(time.Minute), 100, 101, 99, 100, 10),
+		testCandle(start.Add(time.Minute*2), 99, 100, 98, 99, 10),
+		testCandle(start.Add(time.Minute*3), 101, 102, 100.5, 101, 10),
+		testCandle(start.Add(time.Minute*4), 103, 104, 102, 103, 10),
+	}
+	instrInfo := ds.InstrumentInfo{Uid: "uid", Lot: 1}
+	storage := NewBacktestStorage(instrInfo, candles)
+
+	broker := NewBacktestBroker(1000, 0, start, start.Add(time.Hour), ds.Interval_1_Min, storage,
+		logger.NewLogger(io.Discard, "TEST", nil), "trader", nil)
+	broker.SetFillCfg(FillCfg{Model: FillModelLimit, MaxVolumePercent: 20})
+
+	ctx := context.Background()
+	_, err := broker.RecieveLastPrice(ctx, &instrInfo)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.MakeNewOrder(&instrInfo, &ds.Order{OrderId: "buy", Direction: ds.Buy.ToString(), ExecutionReportStatus: ds.New.ToString()}))
+	res, err := broker.MakeBuyOrder(&instrInfo, 3, "buy", "")
+	require.NoError(t, err)
+	require.Equal(t, ds.New.ToString(), res.ExecutionReportStatus)
+	require.InDelta(t, 1000.0, broker.GetAccoount(), 1e-9)
+
+	// limit 100 is reached at open 99, volume allows 2 lots
+	_, err = broker.RecieveLastPrice(ctx, &instrInfo)
+	require.NoError(t, err)
+	require.InDelta(t, 1000.0-2*99, broker.GetAccoount(), 1e-9)
+	require.Equal(t, ds.PartiallyFill.ToString(), storage.orders["buy"].ExecutionReportStatus)
+
+	// the candle does not fall to 100 again, the rest is cancelled
+	_, err = broker.RecieveLastPrice(ctx, &instrInfo)
+	require.NoError(t, err)
+	require.Equal(t, ds.Fill.ToString(), storage.orders["buy"].ExecutionReportStatus)
+	require.Equal(t, int64(2), storage.orders["buy"].LotsExecuted)
+	require.Len(t, storage.Fills(), 1)
+
+	// the order without fills is removed
+	require.NoError(t, storage.MakeNewOrder(&instrInfo, &ds.Order{OrderId: "buy2", Direction: ds.Buy.ToString(), ExecutionReportStatus: ds.New.ToString()}))
+	_, err = broker.MakeBuyOrder(&instrInfo, 1, "buy2", "")
+	require.NoError(t, err)
+	_, err = broker.RecieveLastPrice(ctx, &instrInfo)
+	require.NoError(t, err)
+	require.NotContains(t, storage.orders, "buy2")
+}
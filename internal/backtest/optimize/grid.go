@@ -0,0 +1,142 @@
+package optimize
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var intRange = regexp.MustCompile(`^\[?\s*(-?\d+)\s*\.\.\s*(-?\d+)\s*\]?$`)
+
+// SweepKey marks values of parameters which are swept in optimization like {sweep: 3..8}
+const SweepKey = "sweep"
+
+// ParseValues returns values which parameter takes in optimization. Only values marked with
+// SweepKey are swept: '[3..8]' or '3..8' is integers from 3 to 8 inclusive, 'from:to:step'
+// is numbers from 'from' to 'to' inclusive, a list is its items.
+// Other values are taken as is, so times like '09:30:15' and lists stay fixed.
+func ParseValues(v any) ([]any, error) {
+	sweep, ok := sweepOf(v)
+	if !ok {
+		return []any{v}, nil
+	}
+
+	switch sweep := sweep.(type) {
+	case string:
+		return parseRange(sweep)
+	case []any:
+		// yaml reads [3..8] as a list with one string
+		if len(sweep) == 1 {
+			if s, ok := sweep[0].(string); ok && intRange.MatchString(s) {
+				return parseRange(s)
+			}
+		}
+		if len(sweep) == 0 {
+			return nil, fmt.Errorf("empty list to sweep")
+		}
+		return sweep, nil
+	}
+
+	return nil, fmt.Errorf("expected range or list to sweep, got '%v'", sweep)
+}
+
+func sweepOf(v any) (any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+
+	sweep, ok := m[SweepKey]
+	return sweep, ok
+}
+
+func parseRange(s string) ([]any, error) {
+	s = strings.TrimSpace(s)
+
+	if m := intRange.FindStringSubmatch(s); m != nil {
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		if to < from {
+			return nil, fmt.Errorf("empty range '%s'", s)
+		}
+
+		values := make([]any, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			values = append(values, i)
+		}
+		return values, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid range '%s', expected 'from..to' or 'from:to:step'", s)
+	}
+
+	var bounds [3]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range '%s': %s", s, err.Error())
+		}
+		bounds[i] = f
+	}
+
+	from, to, step := bounds[0], bounds[1], bounds[2]
+	if step <= 0 || to < from {
+		return nil, fmt.Errorf("invalid range '%s', expected 'from:to:step'", s)
+	}
+
+	var values []any
+	for i := 0; ; i++ {
+		v := from + float64(i)*step
+		if v > to+step*1e-9 {
+			break
+		}
+		values = append(values, math.Round(v*1e9)/1e9)
+	}
+
+	return values, nil
+}
+
+// Expand returns the Cartesian product of parameter values. Combinations are ordered
+// by parameter names with the last name changing first.
+func Expand(params map[string]any) ([]map[string]any, error) {
+	names := slices.Sorted(maps.Keys(params))
+
+	combos := []map[string]any{{}}
+	for _, name := range names {
+		values, err := ParseValues(params[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing parameter %s: %s", name, err.Error())
+		}
+
+		next := make([]map[string]any, 0, len(combos)*len(values))
+		for _, combo := range combos {
+			for _, v := range values {
+				c := maps.Clone(combo)
+				c[name] = v
+				next = append(next, c)
+			}
+		}
+		combos = next
+	}
+
+	return combos, nil
+}
+
+// Swept returns sorted names of parameters which take more than one value
+func Swept(params map[string]any) []string {
+	var names []string
+	for name, v := range params {
+		if values, err := ParseValues(v); err == nil && len(values) > 1 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,202 @@
+package optimize
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"trading_bot/internal/backtest/report"
+)
+
+const (
+	ObjectiveSharpe       = "sharpe"
+	ObjectiveSortino      = "sortino"
+	ObjectiveCalmar       = "calmar"
+	ObjectiveCAGR         = "cagr"
+	ObjectiveTotalReturn  = "total_return"
+	ObjectiveProfitFactor = "profit_factor"
+	ObjectiveMaxDrawdown  = "max_drawdown"
+)
+
+// objectives are maximized, drawdown is negated to prefer the smallest one
+var objectives = map[string]func(r *report.Report) float64{
+	ObjectiveSharpe:       func(r *report.Report) float64 { return r.Sharpe },
+	ObjectiveSortino:      func(r *report.Report) float64 { return r.Sortino },
+	ObjectiveCalmar:       func(r *report.Report) float64 { return r.Calmar },
+	ObjectiveCAGR:         func(r *report.Report) float64 { return r.CAGR },
+	ObjectiveTotalReturn:  func(r *report.Report) float64 { return r.TotalReturn },
+	ObjectiveProfitFactor: func(r *report.Report) float64 { return r.ProfitFactor },
+	ObjectiveMaxDrawdown:  func(r *report.Report) float64 { return -r.MaxDrawdown },
+}
+
+func Objective(name string) (func(r *report.Report) float64, error) {
+	f, ok := objectives[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown objective '%s', expected one of %v", name, slices.Sorted(maps.Keys(objectives)))
+	}
+
+	return f, nil
+}
+
+// Result of backtest with one combination of parameters
+type Result struct {
+	Params map[string]any
+	Report *report.Report
+	Score  float64
+}
+
+// RunFunc runs backtest with strategy parameters, i is a number of combination
+type RunFunc func(ctx context.Context, i int, params map[string]any) (*report.Report, error)
+
+// Run backtests every combination with at most parallel ones at a time.
+// Failed combinations are skipped, the first error is returned if all of them failed.
+// Interrupted run returns context error, results of unfinished combinations are not comparable.
+func Run(ctx context.Context, combos []map[string]any, parallel int, run RunFunc) ([]*Result, error) {
+	parallel = max(parallel, 1)
+
+	results := make([]*Result, len(combos))
+	errs := make([]error, len(combos))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, params := range combos {
+		select {
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			r, err := run(ctx, i, params)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = &Result{Params: params, Report: r}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var done []*Result
+	for _, r := range results {
+		if r != nil {
+			done = append(done, r)
+		}
+	}
+	if len(done) == 0 && len(errs) > 0 {
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return done, nil
+}
+
+// Rank scores results by objective and sorts them from the best one
+func Rank(results []*Result, objective string) error {
+	score, err := Objective(objective)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		r.Score = score(r.Report)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return nil
+}
+
+// Write outputs ranked results with swept parameters as columns, csv is suitable for heatmaps
+func Write(w io.Writer, format string, params []string, results []*Result) error {
+	switch format {
+	case report.FormatTable, "":
+		return writeTable(w, params, results)
+	case report.FormatJSON:
+		return writeJSON(w, results)
+	case report.FormatCSV:
+		return writeCSV(w, params, results)
+	}
+
+	return fmt.Errorf("unknown report format '%s'", format)
+}
+
+func writeTable(w io.Writer, params []string, results []*Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprint(tw, "rank\t")
+	for _, p := range params {
+		fmt.Fprintf(tw, "%s\t", p)
+	}
+	fmt.Fprintln(tw, "score\ttotal_return\tsharpe\tmax_drawdown\ttrades\t")
+
+	for i, r := range results {
+		fmt.Fprintf(tw, "%d\t", i+1)
+		for _, p := range params {
+			fmt.Fprintf(tw, "%v\t", r.Params[p])
+		}
+		fmt.Fprintf(tw, "%.4f\t%.4f\t%.4f\t%.4f\t%d\t\n",
+			r.Score, r.Report.TotalReturn, r.Report.Sharpe, r.Report.MaxDrawdown, r.Report.Trades)
+	}
+
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, results []*Result) error {
+	type jsonResult struct {
+		Params map[string]any `json:"params"`
+		Score  float64        `json:"score"`
+		Report map[string]any `json:"report"`
+	}
+
+	out := make([]jsonResult, 0, len(results))
+	for _, r := range results {
+		out = append(out, jsonResult{Params: r.Params, Score: r.Score, Report: r.Report.Values()})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writeCSV(w io.Writer, params []string, results []*Result) error {
+	cw := csv.NewWriter(w)
+
+	header := append(slices.Clone(params), "score")
+	if err := cw.Write(append(header, report.Header()...)); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		record := make([]string, 0, len(params)+1)
+		for _, p := range params {
+			record = append(record, fmt.Sprint(r.Params[p]))
+		}
+		record = append(record, fmt.Sprintf("%.4f", r.Score))
+		if err := cw.Write(append(record, r.Report.Record()...)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,150 @@
+package optimize
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"testing"
+	"time"
+	"trading_bot/internal/backtest/report"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sweep(v any) map[string]any {
+	return map[string]any{SweepKey: v}
+}
+
+func TestParseValues(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value    any
+		expected []any
+	}{
+		{sweep([]any{"3..5"}), []any{3, 4, 5}},
+		{sweep("[3..5]"), []any{3, 4, 5}},
+		{sweep("0.5:1.25:0.25"), []any{0.5, 0.75, 1.0, 1.25}},
+		{sweep("0.1:0.3:0.1"), []any{0.1, 0.2, 0.3}},
+		{sweep([]any{1, 2.5, 7}), []any{1, 2.5, 7}},
+		{sweep([]any{"09:30:00", "10:00:00"}), []any{"09:30:00", "10:00:00"}},
+		{"btdstf", []any{"btdstf"}},
+		// not marked values are fixed whatever they look like
+		{"09:30:15", []any{"09:30:15"}},
+		{"0.5:1.25:0.25", []any{"0.5:1.25:0.25"}},
+		{"[3..5]", []any{"[3..5]"}},
+		{[]any{1, 2, 5}, []any{[]any{1, 2, 5}}},
+		{map[string]any{"a": 1}, []any{map[string]any{"a": 1}}},
+		{4, []any{4}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.value), func(t *testing.T) {
+			t.Parallel()
+
+			values, err := ParseValues(c.value)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, values)
+		})
+	}
+
+	for _, v := range []any{"5..3", "2:1:0.5", "1:2:0", "09:30:15:00", "btdstf", []any{}, 4} {
+		_, err := ParseValues(sweep(v))
+		require.Error(t, err, v)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	t.Parallel()
+
+	params := map[string]any{
+		"name":                "btdstf",
+		"max_depth":           sweep([]any{"3..4"}),
+		"percent_down_to_buy": sweep("0.5:1.0:0.5"),
+		"start_time":          "09:30:15",
+		"sessions":            []any{"main", "evening"},
+	}
+
+	combos, err := Expand(params)
+	require.NoError(t, err)
+	require.Len(t, combos, 4)
+
+	fixed := map[string]any{"name": "btdstf", "start_time": "09:30:15", "sessions": []any{"main", "evening"}}
+	first := maps.Clone(fixed)
+	first["max_depth"], first["percent_down_to_buy"] = 3, 0.5
+	last := maps.Clone(fixed)
+	last["max_depth"], last["percent_down_to_buy"] = 4, 1.0
+	require.Equal(t, first, combos[0])
+	require.Equal(t, last, combos[3])
+	require.Equal(t, []string{"max_depth", "percent_down_to_buy"}, Swept(params))
+}
+
+func TestRunAndRank(t *testing.T) {
+	t.Parallel()
+
+	combos, err := Expand(map[string]any{"depth": sweep("1..6")})
+	require.NoError(t, err)
+
+	results, err := Run(context.Background(), combos, 3, func(_ context.Context, _ int, params map[string]any) (*report.Report, error) {
+		depth := params["depth"].(int)
+		if depth == 6 {
+			return nil, fmt.Errorf("failed")
+		}
+		// the best total return is in the middle
+		return &report.Report{TotalReturn: -float64((depth - 3) * (depth - 3)), MaxDrawdown: float64(depth)}, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	require.NoError(t, Rank(results, ObjectiveTotalReturn))
+	require.Equal(t, 3, results[0].Params["depth"])
+
+	require.NoError(t, Rank(results, ObjectiveMaxDrawdown))
+	require.Equal(t, 1, results[0].Params["depth"])
+
+	require.Error(t, Rank(results, "luck"))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, report.FormatCSV, []string{"depth"}, results))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	require.Equal(t, []string{"depth", "score"}, records[0][:2])
+	require.Equal(t, "1", records[1][0])
+
+	_, err = Run(context.Background(), combos[5:], 1, func(context.Context, int, map[string]any) (*report.Report, error) {
+		return nil, fmt.Errorf("failed")
+	})
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = Run(ctx, combos, 1, func(_ context.Context, i int, _ map[string]any) (*report.Report, error) {
+		if i == 1 {
+			cancel()
+		}
+		return &report.Report{}, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWindows(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time {
+		return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, d)
+	}
+
+	windows, err := Windows(day(0), day(100), time.Hour*24*60, time.Hour*24*30)
+	require.NoError(t, err)
+	require.Equal(t, []Window{
+		{InSampleFrom: day(0), InSampleTo: day(60), OutOfSampleFrom: day(60), OutOfSampleTo: day(90)},
+		{InSampleFrom: day(30), InSampleTo: day(90), OutOfSampleFrom: day(90), OutOfSampleTo: day(100)},
+	}, windows)
+
+	_, err = Windows(day(0), day(50), time.Hour*24*60, time.Hour*24*30)
+	require.Error(t, err)
+	_, err = Windows(day(0), day(100), time.Hour*24*60, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package optimize
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window of walk-forward analysis, parameters are optimized in sample and tested out of sample
+type Window struct {
+	InSampleFrom, InSampleTo       time.Time
+	OutOfSampleFrom, OutOfSampleTo time.Time
+}
+
+// Windows splits period into rolling windows, every next window is moved by out of sample duration
+// so out of sample parts follow each other. The last out of sample part is cut by the end of period.
+func Windows(from, to time.Time, inSample, outOfSample time.Duration) ([]Window, error) {
+	if inSample <= 0 || outOfSample <= 0 {
+		return nil, fmt.Errorf("in sample and out of sample durations must be positive")
+	}
+
+	var windows []Window
+	for start := from; start.Add(inSample).Before(to); start = start.Add(outOfSample) {
+		split := start.Add(inSample)
+		windows = append(windows, Window{
+			InSampleFrom:    start,
+			InSampleTo:      split,
+			OutOfSampleFrom: split,
+			OutOfSampleTo:   minTime(split.Add(outOfSample), to),
+		})
+	}
+
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("period %s - %s is shorter than in sample duration %s",
+			from.Format(time.DateOnly), to.Format(time.DateOnly), inSample)
+	}
+
+	return windows, nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
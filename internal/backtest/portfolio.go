@@ -0,0 +1,97 @@
+package backtest
+
+import (
+	"context"
+	"slices"
+	"time"
+	"trading_bot/internal/backtest/report"
+)
+
+// Portfolio backtests engines of several traders with one account. Candles of all instruments
+// are merged by time, the engine with the earliest next candle makes a step.
+type Portfolio struct {
+	account *Account
+	engines []*Engine
+	equity  []report.EquityPoint
+	now     time.Time
+}
+
+func NewPortfolio(account *Account) *Portfolio {
+	return &Portfolio{account: account}
+}
+
+// Add attaches broker of engine to the portfolio account, allocation is a max part of equity
+// in position of the trader, 0 is no limit
+func (p *Portfolio) Add(engine *Engine, allocation float64) {
+	p.account.Attach(engine.broker, allocation)
+	p.engines = append(p.engines, engine)
+}
+
+// Run steps engines till the end of all candles or context
+func (p *Portfolio) Run(ctx context.Context) error {
+	active := slices.Clone(p.engines)
+	for len(active) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		i := p.next(active)
+		ok, err := active[i].Step(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			active = slices.Delete(active, i, i+1)
+			continue
+		}
+
+		p.record(active[i].broker.Now())
+	}
+
+	return nil
+}
+
+// next returns index of the engine with the earliest next candle, finished engines go first
+func (p *Portfolio) next(engines []*Engine) int {
+	next := 0
+	var earliest time.Time
+	for i, e := range engines {
+		t, ok := e.broker.NextTime(e.cfg.InstrInfo)
+		if !ok {
+			return i
+		}
+		if i == 0 || t.Before(earliest) {
+			next, earliest = i, t
+		}
+	}
+
+	return next
+}
+
+// record charges interest and puts equity of portfolio, candles of the same time make one point
+func (p *Portfolio) record(t time.Time) {
+	if t.After(p.now) {
+		p.account.chargeInterest(p.now, t)
+		p.now = t
+	}
+
+	var lots int64
+	for _, e := range p.engines {
+		lots += max(e.broker.lots, -e.broker.lots)
+	}
+	point := report.EquityPoint{Time: p.now, Equity: p.account.Equity(), Lots: lots}
+
+	if n := len(p.equity); n > 0 && p.equity[n-1].Time.Equal(point.Time) {
+		p.equity[n-1] = point
+		return
+	}
+	p.equity = append(p.equity, point)
+}
+
+func (p *Portfolio) Account() *Account {
+	return p.account
+}
+
+func (p *Portfolio) Equity() []report.EquityPoint {
+	return p.equity
+}
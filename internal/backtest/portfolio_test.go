@@ -0,0 +1,114 @@
+package backtest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+	"trading_bot/internal/logger"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+
+	"github.com/stretchr/testify/require"
+)
+
+type buyOnceStrategy struct {
+	lots int64
+	done bool
+}
+
+func (s *buyOnceStrategy) GetActionDecision(context.Context, string, *ds.InstrumentInfo, *ds.LastPrice) ([]*ds.StrategyAction, error) {
+	if s.done {
+		return nil, nil
+	}
+	s.done = true
+	return []*ds.StrategyAction{{Action: ds.Buy, Lots: s.lots, RequestId: "buy"}}, nil
+}
+
+func (s *buyOnceStrategy) GetName() string {
+	return "buy_once"
+}
+
+func (s *buyOnceStrategy) UpdateConfig(map[string]any) error {
+	return nil
+}
+
+func TestPortfolio(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	l := logger.NewLogger(io.Discard, "TEST", nil)
+
+	newEngine := func(uid string, shift time.Duration, lots int64) (*Engine, *BacktestStorage) {
+		// the first candle is skipped by broker
+		var candles []*ds.Candle
+		for i := range 4 {
+			candles = append(candles, testCandle(start.Add(time.Hour*time.Duration(i)+shift), 100, 100, 100, 100, 100))
+		}
+		instrInfo := ds.InstrumentInfo{Uid: uid, Lot: 1}
+		storage := NewBacktestStorage(instrInfo, candles)
+		broker := NewBacktestBroker(500, 0, start, start.Add(time.Hour*10), ds.Interval_Hour, storage, l, uid, nil)
+		return NewEngine(broker, &buyOnceStrategy{lots: lots}, l, &trader.TraderCfg{InstrInfo: &instrInfo, TraderId: uid}), storage
+	}
+
+	t.Run("shared cash", func(t *testing.T) {
+		t.Parallel()
+
+		portfolio := NewPortfolio(NewAccount(1000))
+		first, firstStorage := newEngine("first", 0, 8)
+		second, secondStorage := newEngine("second", time.Minute, 8)
+		portfolio.Add(first, 0)
+		portfolio.Add(second, 0)
+
+		require.NoError(t, portfolio.Run(context.Background()))
+
+		require.Len(t, firstStorage.Fills(), 1)
+		require.Empty(t, secondStorage.Fills())
+		require.Len(t, secondStorage.Rejections(), 1)
+		require.InDelta(t, 200.0, portfolio.Account().Cash(), 1e-9)
+
+		equity := portfolio.Equity()
+		require.Len(t, equity, 6)
+		require.True(t, equity[0].Time.Before(equity[1].Time))
+		require.InDelta(t, 1000.0, equity[len(equity)-1].Equity, 1e-9)
+		require.Equal(t, int64(8), equity[len(equity)-1].Lots)
+	})
+
+	t.Run("allocation", func(t *testing.T) {
+		t.Parallel()
+
+		portfolio := NewPortfolio(NewAccount(1000))
+		first, firstStorage := newEngine("first", 0, 6)
+		second, secondStorage := newEngine("second", 0, 4)
+		portfolio.Add(first, 0.5)
+		portfolio.Add(second, 0.5)
+
+		require.NoError(t, portfolio.Run(context.Background()))
+
+		require.Len(t, firstStorage.Rejections(), 1)
+		require.Len(t, secondStorage.Fills(), 1)
+		require.InDelta(t, 600.0, portfolio.Account().Cash(), 1e-9)
+		// the same time of candles makes one point
+		require.Len(t, portfolio.Equity(), 3)
+	})
+
+	t.Run("interest split", func(t *testing.T) {
+		t.Parallel()
+
+		account := NewAccount(1000)
+		account.SetMargin(2, 10)
+		portfolio := NewPortfolio(account)
+		first, firstStorage := newEngine("first", 0, 15)
+		second, secondStorage := newEngine("second", 0, 2)
+		portfolio.Add(first, 0)
+		portfolio.Add(second, 0)
+
+		require.NoError(t, portfolio.Run(context.Background()))
+
+		// only the first trader borrowed money
+		require.Greater(t, account.Interest(), 0.0)
+		require.InDelta(t, account.Interest(), firstStorage.Interest(), 1e-9)
+		require.InDelta(t, 0.0, secondStorage.Interest(), 1e-9)
+		require.InDelta(t, 500-1500-firstStorage.Interest(), first.broker.GetAccoount(), 1e-9)
+	})
+}
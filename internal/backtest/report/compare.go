@@ -0,0 +1,134 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+const compareTolerance = 1e-9
+
+// MetricDiff is a metric of two runs, Delta is set for numbers
+type MetricDiff struct {
+	Name     string
+	Old, New any
+	Delta    float64
+	Changed  bool
+}
+
+// TradeDiff is a trade which differs between two runs, Old or New is nil when the trade is only in one run
+type TradeDiff struct {
+	Index    int
+	Old, New *Trade
+}
+
+// CompareMetrics compares metrics in the order of the report, values are as in Values or decoded from its json
+func CompareMetrics(before, after map[string]any) []*MetricDiff {
+	diffs := make([]*MetricDiff, 0, len(before))
+	for _, name := range Header() {
+		d := &MetricDiff{Name: name, Old: before[name], New: after[name]}
+
+		o, okOld := toFloat(d.Old)
+		n, okNew := toFloat(d.New)
+		if okOld && okNew {
+			d.Delta = n - o
+			d.Changed = math.Abs(d.Delta) > compareTolerance
+		} else {
+			d.Changed = fmt.Sprint(d.Old) != fmt.Sprint(d.New)
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	return diffs
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// DiffTrades compares trades of two runs one by one
+func DiffTrades(before, after []*Trade) []*TradeDiff {
+	var diffs []*TradeDiff
+	for i := range max(len(before), len(after)) {
+		var o, n *Trade
+		if i < len(before) {
+			o = before[i]
+		}
+		if i < len(after) {
+			n = after[i]
+		}
+
+		if o == nil || n == nil || !sameTrade(o, n) {
+			diffs = append(diffs, &TradeDiff{Index: i, Old: o, New: n})
+		}
+	}
+
+	return diffs
+}
+
+func sameTrade(a, b *Trade) bool {
+	return a.Direction == b.Direction && a.Lots == b.Lots &&
+		a.EntryTime.Equal(b.EntryTime) && a.ExitTime.Equal(b.ExitTime) &&
+		math.Abs(a.EntryPrice-b.EntryPrice) <= compareTolerance &&
+		math.Abs(a.ExitPrice-b.ExitPrice) <= compareTolerance &&
+		math.Abs(a.Pnl-b.Pnl) <= compareTolerance
+}
+
+// WriteComparison writes metrics of two runs with changes marked and up to maxTrades differing trades
+func WriteComparison(w io.Writer, oldName, newName string, metrics []*MetricDiff, trades []*TradeDiff, maxTrades int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "metric\t%s\t%s\tdelta\t\n", oldName, newName)
+	for _, m := range metrics {
+		mark := ""
+		if m.Changed {
+			mark = "*"
+		}
+
+		delta := ""
+		if _, ok := toFloat(m.Old); ok && m.Changed {
+			delta = formatValue(m.Delta)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.Name, formatValue(m.Old), formatValue(m.New), delta, mark)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n%d trades differ\n", len(trades))
+	if len(trades) == 0 {
+		return nil
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "#\t%s\t%s\t\n", oldName, newName)
+	for i, t := range trades {
+		if i == maxTrades {
+			fmt.Fprintf(tw, "...\t%d more\t\t\n", len(trades)-maxTrades)
+			break
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t\n", t.Index+1, formatTrade(t.Old), formatTrade(t.New))
+	}
+
+	return tw.Flush()
+}
+
+func formatTrade(t *Trade) string {
+	if t == nil {
+		return "-"
+	}
+
+	return fmt.Sprintf("%s %d lots %s %.4f -> %s %.4f pnl %.2f", t.Direction.ToString(), t.Lots,
+		t.EntryTime.Format(time.DateTime), t.EntryPrice, t.ExitTime.Format(time.DateTime), t.ExitPrice, t.Pnl)
+}
@@ -0,0 +1,67 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+)
+
+// WriteEquityCSV writes equity curve of report with drawdown
+func WriteEquityCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "equity", "drawdown", "lots"}); err != nil {
+		return err
+	}
+
+	drawdowns := Drawdowns(r.equity)
+	for i, p := range r.equity {
+		err := cw.Write([]string{
+			p.Time.Format(time.RFC3339),
+			formatValue(p.Equity),
+			formatValue(drawdowns[i]),
+			strconv.FormatInt(p.Lots, 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTradesCSV writes round trips of report
+func WriteTradesCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	header := []string{"direction", "entry_time", "exit_time", "entry_price", "exit_price", "lots", "pnl", "commission", "holding"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, t := range r.trades {
+		direction := "long"
+		if t.Direction == ds.Sell {
+			direction = "short"
+		}
+
+		err := cw.Write([]string{
+			direction,
+			t.EntryTime.Format(time.RFC3339),
+			t.ExitTime.Format(time.RFC3339),
+			formatValue(t.EntryPrice),
+			formatValue(t.ExitPrice),
+			strconv.FormatInt(t.Lots, 10),
+			formatValue(t.Pnl),
+			formatValue(t.Commission),
+			formatValue(t.Holding()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
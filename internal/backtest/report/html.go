@@ -0,0 +1,219 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+)
+
+// PricePoint is a price of instrument for the chart of HTML report
+type PricePoint struct {
+	Time  time.Time
+	Price float64
+}
+
+const (
+	chartWidth  = 960
+	chartHeight = 240
+	// longer series are thinned out to keep the report small
+	maxChartPoints = 2000
+)
+
+type chartMarker struct {
+	X, Y  float64
+	Color string
+	Title string
+}
+
+type chart struct {
+	Title    string
+	Width    int
+	Height   int
+	Points   string
+	Min, Max string
+	Markers  []*chartMarker
+
+	from, to time.Time
+	min, max float64
+}
+
+func newChart(title string, from, to time.Time, times []time.Time, values []float64, format func(float64) string) *chart {
+	c := &chart{Title: title, Width: chartWidth, Height: chartHeight, from: from, to: to}
+	if len(values) == 0 {
+		return c
+	}
+
+	c.min, c.max = values[0], values[0]
+	for _, v := range values {
+		c.min, c.max = min(c.min, v), max(c.max, v)
+	}
+	if c.max == c.min {
+		c.min, c.max = c.min-1, c.max+1
+	}
+	c.Min, c.Max = format(c.min), format(c.max)
+
+	step := int(math.Ceil(float64(len(values)) / maxChartPoints))
+	var points strings.Builder
+	for i := 0; i < len(values); i += step {
+		x, y := c.position(times[i], values[i])
+		fmt.Fprintf(&points, "%.1f,%.1f ", x, y)
+	}
+	c.Points = strings.TrimSpace(points.String())
+
+	return c
+}
+
+func (c *chart) position(t time.Time, v float64) (float64, float64) {
+	var x float64
+	if total := c.to.Sub(c.from); total > 0 {
+		x = float64(t.Sub(c.from)) / float64(total) * float64(c.Width)
+	}
+	y := float64(c.Height) - (v-c.min)/(c.max-c.min)*float64(c.Height)
+	return x, y
+}
+
+func (c *chart) mark(t time.Time, v float64, color, title string) {
+	x, y := c.position(t, v)
+	c.Markers = append(c.Markers, &chartMarker{X: x, Y: y, Color: color, Title: title})
+}
+
+type htmlMetric struct {
+	Name, Value string
+}
+
+type htmlTrade struct {
+	Direction                string
+	EntryTime, ExitTime      string
+	EntryPrice, ExitPrice    string
+	Lots                     int64
+	Pnl, Commission, Holding string
+	Profitable               bool
+}
+
+type htmlData struct {
+	Name    string
+	Metrics []htmlMetric
+	Charts  []*chart
+	Trades  []htmlTrade
+}
+
+// WriteHTML writes static report with metrics, charts of price with trades, equity and drawdown
+// and the trade log. Charts are inline SVG, so the file needs nothing else to be opened.
+// Price chart is skipped without prices.
+func WriteHTML(w io.Writer, r *Report, prices []PricePoint) error {
+	data := &htmlData{Name: r.Name}
+	for _, m := range r.metrics() {
+		data.Metrics = append(data.Metrics, htmlMetric{Name: m.name, Value: formatValue(m.value)})
+	}
+
+	from, to := r.From, r.To
+	if len(prices) > 0 {
+		if from.IsZero() || prices[0].Time.Before(from) {
+			from = prices[0].Time
+		}
+		if last := prices[len(prices)-1].Time; last.After(to) {
+			to = last
+		}
+	}
+
+	money := func(v float64) string { return fmt.Sprintf("%.2f", v) }
+	percent := func(v float64) string { return fmt.Sprintf("%.2f%%", v) }
+
+	if len(prices) > 0 {
+		times := make([]time.Time, len(prices))
+		values := make([]float64, len(prices))
+		for i, p := range prices {
+			times[i], values[i] = p.Time, p.Price
+		}
+
+		priceChart := newChart("Price and trades", from, to, times, values, money)
+		for _, t := range r.trades {
+			entry, exit := "#2ca02c", "#d62728"
+			if t.Direction == ds.Sell {
+				entry, exit = exit, entry
+			}
+			priceChart.mark(t.EntryTime, t.EntryPrice, entry, fmt.Sprintf("%s %d lots at %.4f", t.EntryTime.Format(time.DateTime), t.Lots, t.EntryPrice))
+			priceChart.mark(t.ExitTime, t.ExitPrice, exit, fmt.Sprintf("%s %d lots at %.4f, pnl %.2f", t.ExitTime.Format(time.DateTime), t.Lots, t.ExitPrice, t.Pnl))
+		}
+		data.Charts = append(data.Charts, priceChart)
+	}
+
+	times := make([]time.Time, len(r.equity))
+	values := make([]float64, len(r.equity))
+	for i, p := range r.equity {
+		times[i], values[i] = p.Time, p.Equity
+	}
+	data.Charts = append(data.Charts, newChart("Equity, "+r.Currency, from, to, times, values, money))
+
+	drawdowns := Drawdowns(r.equity)
+	for i, d := range drawdowns {
+		drawdowns[i] = -d * 100
+	}
+	data.Charts = append(data.Charts, newChart("Drawdown", from, to, times, drawdowns, percent))
+
+	for _, t := range r.trades {
+		direction := "long"
+		if t.Direction == ds.Sell {
+			direction = "short"
+		}
+		data.Trades = append(data.Trades, htmlTrade{
+			Direction:  direction,
+			EntryTime:  t.EntryTime.Format(time.DateTime),
+			ExitTime:   t.ExitTime.Format(time.DateTime),
+			EntryPrice: formatValue(t.EntryPrice),
+			ExitPrice:  formatValue(t.ExitPrice),
+			Lots:       t.Lots,
+			Pnl:        formatValue(t.Pnl),
+			Commission: formatValue(t.Commission),
+			Holding:    t.Holding().String(),
+			Profitable: t.Pnl > 0,
+		})
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Backtest {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+td, th { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+th { background: #f4f4f4; }
+td:first-child { text-align: left; }
+.chart { margin-bottom: 24px; }
+.chart svg { border: 1px solid #ddd; background: #fff; }
+.scale { font-size: 12px; color: #666; }
+.profit { color: #2ca02c; }
+.loss { color: #d62728; }
+</style>
+</head>
+<body>
+<h1>Backtest {{.Name}}</h1>
+<table>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{range .Charts}}<div class="chart">
+<h3>{{.Title}}</h3>
+<div class="scale">max {{.Max}}</div>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<polyline points="{{.Points}}" fill="none" stroke="#1f77b4" stroke-width="1"/>
+{{range .Markers}}<circle cx="{{printf "%.1f" .X}}" cy="{{printf "%.1f" .Y}}" r="3" fill="{{.Color}}"><title>{{.Title}}</title></circle>
+{{end}}</svg>
+<div class="scale">min {{.Min}}</div>
+</div>
+{{end}}<h3>Trades</h3>
+<table>
+<tr><th>direction</th><th>entry time</th><th>exit time</th><th>entry price</th><th>exit price</th><th>lots</th><th>pnl</th><th>commission</th><th>holding</th></tr>
+{{range .Trades}}<tr><td>{{.Direction}}</td><td>{{.EntryTime}}</td><td>{{.ExitTime}}</td><td>{{.EntryPrice}}</td><td>{{.ExitPrice}}</td><td>{{.Lots}}</td><td class="{{if .Profitable}}profit{{else}}loss{{end}}">{{.Pnl}}</td><td>{{.Commission}}</td><td>{{.Holding}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,169 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+type metric struct {
+	name  string
+	value any
+}
+
+// metrics are in the order of table rows and csv columns
+func (r *Report) metrics() []metric {
+	return []metric{
+		{"name", r.Name},
+		{"currency", r.Currency},
+		{"from", r.From.Format(time.DateTime)},
+		{"to", r.To.Format(time.DateTime)},
+		{"start_equity", r.StartEquity},
+		{"final_equity", r.FinalEquity},
+		{"gross_return", r.GrossReturn},
+		{"total_return", r.TotalReturn},
+		{"after_tax_return", r.AfterTaxReturn},
+		{"cagr", r.CAGR},
+		{"sharpe", r.Sharpe},
+		{"sortino", r.Sortino},
+		{"calmar", r.Calmar},
+		{"max_drawdown", r.MaxDrawdown},
+		{"max_drawdown_duration", r.MaxDrawdownDuration},
+		{"exposure", r.Exposure},
+		{"trades", r.Trades},
+		{"win_rate", r.WinRate},
+		{"profit_factor", r.ProfitFactor},
+		{"avg_win", r.AvgWin},
+		{"avg_loss", r.AvgLoss},
+		{"avg_holding", r.AvgHolding},
+		{"commission", r.Commission},
+		{"tax", r.Tax},
+		{"rejections", r.Rejections},
+		{"interest", r.Interest},
+	}
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	case ds.Money:
+		return strconv.FormatFloat(v.ToFloat64(), 'f', 4, 64)
+	case time.Duration:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Write outputs reports as a table with column per report, json array or csv with row per report
+func Write(w io.Writer, format string, reports []*Report) error {
+	switch format {
+	case FormatTable, "":
+		return writeTable(w, reports)
+	case FormatJSON:
+		return writeJSON(w, reports)
+	case FormatCSV:
+		return writeCSV(w, reports)
+	}
+
+	return fmt.Errorf("unknown report format '%s'", format)
+}
+
+func writeTable(w io.Writer, reports []*Report) error {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	rows := make([][]metric, len(reports))
+	for i, r := range reports {
+		rows[i] = r.metrics()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for m := range rows[0] {
+		fmt.Fprintf(tw, "%s\t", rows[0][m].name)
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t", formatValue(row[m].value))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// Values returns metrics by names as they are written in json
+func (r *Report) Values() map[string]any {
+	values := make(map[string]any)
+	for _, m := range r.metrics() {
+		switch v := m.value.(type) {
+		case time.Duration:
+			values[m.name] = v.String()
+			continue
+		case ds.Money:
+			// currency is a metric of its own
+			values[m.name] = v.ToFloat64()
+			continue
+		}
+		values[m.name] = m.value
+	}
+	return values
+}
+
+func writeJSON(w io.Writer, reports []*Report) error {
+	out := make([]map[string]any, 0, len(reports))
+	for _, r := range reports {
+		out = append(out, r.Values())
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// Header returns names of csv columns
+func Header() []string {
+	var header []string
+	for _, m := range (&Report{}).metrics() {
+		header = append(header, m.name)
+	}
+	return header
+}
+
+// Record returns csv columns of report
+func (r *Report) Record() []string {
+	var record []string
+	for _, m := range r.metrics() {
+		record = append(record, formatValue(m.value))
+	}
+	return record
+}
+
+func writeCSV(w io.Writer, reports []*Report) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(Header()); err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		if err := cw.Write(r.Record()); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,263 @@
+package report
+
+import (
+	"math"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+)
+
+// EquityPoint is account with value of held lots, Lots are used for exposure time
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+	Lots   int64
+}
+
+// Report of one backtest run. Returns and drawdown are fractions, ratios are annualized
+// with zero risk free rate. Totals are money in Currency, averages of trades are plain numbers in it.
+// TotalReturn is net of fees, GrossReturn is without them and AfterTaxReturn is net of fees and Tax.
+type Report struct {
+	Name     string
+	Currency string
+	From, To time.Time
+
+	StartEquity    ds.Money
+	FinalEquity    ds.Money
+	GrossReturn    float64
+	TotalReturn    float64
+	AfterTaxReturn float64
+	CAGR           float64
+	Sharpe         float64
+	Sortino        float64
+	Calmar         float64
+
+	MaxDrawdown         float64
+	MaxDrawdownDuration time.Duration
+	Exposure            float64
+
+	Trades       int
+	WinRate      float64
+	ProfitFactor float64 // 0 when there are no losing trades
+	AvgWin       float64
+	AvgLoss      float64
+	AvgHolding   time.Duration
+	Commission   ds.Money
+
+	Tax        ds.Money
+	Rejections int      // orders rejected by broker
+	Interest   ds.Money // paid for borrowed money
+
+	trades []*Trade
+	equity []EquityPoint
+}
+
+const yearDuration = time.Hour * 24 * 365
+
+// stitch joins equity curves of consecutive runs. Every run starts with its own deposit,
+// so its profit is added to the equity where the previous run ended.
+func stitch(curves [][]EquityPoint) []EquityPoint {
+	var stitched []EquityPoint
+	for _, curve := range curves {
+		if len(curve) == 0 {
+			continue
+		}
+
+		offset := 0.0
+		if len(stitched) > 0 {
+			offset = stitched[len(stitched)-1].Equity - curve[0].Equity
+		}
+		for _, p := range curve {
+			p.Equity += offset
+			stitched = append(stitched, p)
+		}
+	}
+
+	return stitched
+}
+
+func New(name, currency string, equity []EquityPoint, fills []*Fill) *Report {
+	return newReport(name, currency, equity, fills, RoundTrips(fills))
+}
+
+// NewStitched makes one report of consecutive runs, trades are matched within every run
+func NewStitched(name, currency string, curves [][]EquityPoint, fills [][]*Fill) *Report {
+	allFills, trades := matchTrades(fills)
+	return newReport(name, currency, stitch(curves), allFills, trades)
+}
+
+// NewPortfolio makes report of portfolio equity, trades are matched within fills of every trader
+func NewPortfolio(name, currency string, equity []EquityPoint, fills [][]*Fill) *Report {
+	allFills, trades := matchTrades(fills)
+	return newReport(name, currency, equity, allFills, trades)
+}
+
+func matchTrades(fills [][]*Fill) ([]*Fill, []*Trade) {
+	var allFills []*Fill
+	var trades []*Trade
+	for _, f := range fills {
+		allFills = append(allFills, f...)
+		trades = append(trades, RoundTrips(f)...)
+	}
+
+	return allFills, trades
+}
+
+func newReport(name, currency string, equity []EquityPoint, fills []*Fill, trades []*Trade) *Report {
+	currency = ds.NormalizeCurrency(currency)
+	r := &Report{Name: name, Currency: currency, trades: trades, equity: equity}
+
+	var commission float64
+	for _, f := range fills {
+		commission += f.Commission
+	}
+	r.Commission = ds.NewMoney(commission, currency)
+	r.Tax, r.Interest = ds.NewMoney(0, currency), ds.NewMoney(0, currency)
+	r.StartEquity, r.FinalEquity = ds.NewMoney(0, currency), ds.NewMoney(0, currency)
+	r.fillTrades(trades)
+
+	if len(equity) == 0 {
+		return r
+	}
+
+	first, last := equity[0], equity[len(equity)-1]
+	r.From, r.To = first.Time, last.Time
+	r.StartEquity, r.FinalEquity = ds.NewMoney(first.Equity, currency), ds.NewMoney(last.Equity, currency)
+	if first.Equity != 0 {
+		r.TotalReturn = last.Equity/first.Equity - 1
+		r.GrossReturn = (last.Equity+commission)/first.Equity - 1
+		r.AfterTaxReturn = r.TotalReturn
+	}
+
+	years := float64(r.To.Sub(r.From)) / float64(yearDuration)
+	if years > 0 && first.Equity > 0 && last.Equity > 0 {
+		r.CAGR = math.Pow(last.Equity/first.Equity, 1/years) - 1
+	}
+
+	r.fillDrawdown(equity)
+	if r.MaxDrawdown > 0 {
+		r.Calmar = r.CAGR / r.MaxDrawdown
+	}
+
+	if years > 0 {
+		r.fillRatios(equity, float64(len(equity)-1)/years)
+	}
+
+	var exposed time.Duration
+	for i := 1; i < len(equity); i++ {
+		if equity[i-1].Lots != 0 {
+			exposed += equity[i].Time.Sub(equity[i-1].Time)
+		}
+	}
+	if total := r.To.Sub(r.From); total > 0 {
+		r.Exposure = float64(exposed) / float64(total)
+	}
+
+	return r
+}
+
+// TradeLog returns round trips of the report
+func (r *Report) TradeLog() []*Trade {
+	return r.trades
+}
+
+// EquityCurve returns equity the report is made of
+func (r *Report) EquityCurve() []EquityPoint {
+	return r.equity
+}
+
+// Drawdowns returns fall of every equity point from the peak before it as a fraction
+func Drawdowns(equity []EquityPoint) []float64 {
+	drawdowns := make([]float64, len(equity))
+	var peak float64
+	for i, p := range equity {
+		peak = max(peak, p.Equity)
+		if peak > 0 {
+			drawdowns[i] = (peak - p.Equity) / peak
+		}
+	}
+	return drawdowns
+}
+
+func (r *Report) fillTrades(trades []*Trade) {
+	r.Trades = len(trades)
+	if r.Trades == 0 {
+		return
+	}
+
+	var wins, losses int
+	var profit, loss float64
+	var holding time.Duration
+	for _, t := range trades {
+		holding += t.Holding()
+		if t.Pnl > 0 {
+			wins++
+			profit += t.Pnl
+		} else if t.Pnl < 0 {
+			losses++
+			loss -= t.Pnl
+		}
+	}
+
+	r.WinRate = float64(wins) / float64(r.Trades)
+	r.AvgHolding = holding / time.Duration(r.Trades)
+	if wins > 0 {
+		r.AvgWin = profit / float64(wins)
+	}
+	if losses > 0 {
+		r.AvgLoss = -loss / float64(losses)
+		r.ProfitFactor = profit / loss
+	}
+}
+
+// fillDrawdown finds the deepest fall from a peak and the longest time spent below a peak
+func (r *Report) fillDrawdown(equity []EquityPoint) {
+	peak := equity[0]
+	for _, p := range equity {
+		if p.Equity >= peak.Equity {
+			peak = p
+			continue
+		}
+
+		if peak.Equity > 0 {
+			r.MaxDrawdown = max(r.MaxDrawdown, (peak.Equity-p.Equity)/peak.Equity)
+		}
+		r.MaxDrawdownDuration = max(r.MaxDrawdownDuration, p.Time.Sub(peak.Time))
+	}
+}
+
+func (r *Report) fillRatios(equity []EquityPoint, periodsPerYear float64) {
+	returns := make([]float64, 0, len(equity)-1)
+	for i := 1; i < len(equity); i++ {
+		if equity[i-1].Equity != 0 {
+			returns = append(returns, equity[i].Equity/equity[i-1].Equity-1)
+		}
+	}
+	if len(returns) < 2 {
+		return
+	}
+
+	var mean float64
+	for _, v := range returns {
+		mean += v
+	}
+	mean /= float64(len(returns))
+
+	var variance, downside float64
+	for _, v := range returns {
+		variance += (v - mean) * (v - mean)
+		if v < 0 {
+			downside += v * v
+		}
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+
+	annualization := math.Sqrt(periodsPerYear)
+	if std > 0 {
+		r.Sharpe = mean / std * annualization
+	}
+	if downsideDev > 0 {
+		r.Sortino = mean / downsideDev * annualization
+	}
+}
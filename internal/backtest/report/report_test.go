@@ -0,0 +1,271 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	fills := []*Fill{
+		{Time: start, Direction: ds.Buy, Lots: 2, Price: 100, Amount: 200, Commission: 2},
+		{Time: start.Add(time.Hour), Direction: ds.Buy, Lots: 1, Price: 110, Amount: 110, Commission: 1},
+		{Time: start.Add(time.Hour * 2), Direction: ds.Sell, Lots: 3, Price: 105, Amount: 315, Commission: 3},
+		{Time: start.Add(time.Hour * 3), Direction: ds.Sell, Lots: 1, Price: 105, Amount: 105, Commission: 1},
+	}
+
+	trades := RoundTrips(fills)
+	require.Len(t, trades, 2)
+
+	require.Equal(t, int64(2), trades[0].Lots)
+	require.InDelta(t, 210.0-200-2-2, trades[0].Pnl, 1e-9)
+	require.Equal(t, time.Hour*2, trades[0].Holding())
+
+	require.Equal(t, int64(1), trades[1].Lots)
+	require.InDelta(t, 105.0-110-1-1, trades[1].Pnl, 1e-9)
+	require.Equal(t, time.Hour, trades[1].Holding())
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return start.Add(time.Hour * 24 * time.Duration(d))
+	}
+	equity := []EquityPoint{
+		{Time: day(0), Equity: 1000},
+		{Time: day(73), Equity: 1100, Lots: 1},
+		{Time: day(146), Equity: 880, Lots: 1},
+		{Time: day(219), Equity: 990},
+		{Time: day(292), Equity: 1210},
+		{Time: day(365), Equity: 1210},
+	}
+	fills := []*Fill{
+		{Time: day(73), Direction: ds.Buy, Lots: 1, Amount: 100, Commission: 1},
+		{Time: day(146), Direction: ds.Sell, Lots: 1, Amount: 80, Commission: 1},
+		{Time: day(219), Direction: ds.Buy, Lots: 1, Amount: 100, Commission: 1},
+		{Time: day(292), Direction: ds.Sell, Lots: 1, Amount: 130, Commission: 1},
+	}
+
+	r := New("test", ds.CurrencyRub, equity, fills)
+
+	require.InDelta(t, 0.21, r.TotalReturn, 1e-9)
+	require.InDelta(t, 0.21, r.CAGR, 1e-9)
+	require.InDelta(t, 0.2, r.MaxDrawdown, 1e-9)
+	require.Equal(t, time.Hour*24*146, r.MaxDrawdownDuration)
+	require.InDelta(t, r.CAGR/r.MaxDrawdown, r.Calmar, 1e-9)
+	require.InDelta(t, 0.4, r.Exposure, 1e-9)
+	require.Greater(t, r.Sharpe, 0.0)
+	require.Greater(t, r.Sortino, r.Sharpe)
+
+	require.Equal(t, 2, r.Trades)
+	require.InDelta(t, 0.5, r.WinRate, 1e-9)
+	require.InDelta(t, 28.0, r.AvgWin, 1e-9)
+	require.InDelta(t, -22.0, r.AvgLoss, 1e-9)
+	require.InDelta(t, 28.0/22, r.ProfitFactor, 1e-9)
+	require.Equal(t, time.Hour*24*73, r.AvgHolding)
+	require.InDelta(t, 4.0, r.Commission.ToFloat64(), 1e-9)
+
+	t.Run("formats", func(t *testing.T) {
+		t.Parallel()
+
+		reports := []*Report{r, New("empty", ds.CurrencyRub, nil, nil)}
+
+		var table bytes.Buffer
+		require.NoError(t, Write(&table, FormatTable, reports))
+		require.Contains(t, table.String(), "max_drawdown")
+
+		var js bytes.Buffer
+		require.NoError(t, Write(&js, FormatJSON, reports))
+		var decoded []map[string]any
+		require.NoError(t, json.Unmarshal(js.Bytes(), &decoded))
+		require.Len(t, decoded, 2)
+		require.Equal(t, "test", decoded[0]["name"])
+		require.InDelta(t, 2.0, decoded[0]["trades"], 1e-9)
+
+		var c bytes.Buffer
+		require.NoError(t, Write(&c, FormatCSV, reports))
+		records, err := csv.NewReader(&c).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, "name", records[0][0])
+
+		require.Error(t, Write(&c, "xml", reports))
+	})
+}
+
+func TestNewStitched(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time {
+		return start.Add(time.Hour * time.Duration(h))
+	}
+
+	curves := [][]EquityPoint{
+		{{Time: hour(0), Equity: 1000}, {Time: hour(1), Equity: 1100, Lots: 1}},
+		{{Time: hour(2), Equity: 1000}, {Time: hour(3), Equity: 950}},
+	}
+	// the first run ends with open lots which are not matched with the second run
+	fills := [][]*Fill{
+		{{Time: hour(0), Direction: ds.Buy, Lots: 1, Amount: 100}},
+		{{Time: hour(2), Direction: ds.Sell, Lots: 1, Amount: 120}, {Time: hour(3), Direction: ds.Buy, Lots: 1, Amount: 170}},
+	}
+
+	r := NewStitched("wf", ds.CurrencyRub, curves, fills)
+	require.InDelta(t, 1000.0, r.StartEquity.ToFloat64(), 1e-9)
+	require.InDelta(t, 1050.0, r.FinalEquity.ToFloat64(), 1e-9)
+	require.InDelta(t, (1100.0-1050)/1100, r.MaxDrawdown, 1e-9)
+	require.Equal(t, 1, r.Trades)
+	require.InDelta(t, -50.0, r.AvgLoss, 1e-9)
+}
+
+func TestTax(t *testing.T) {
+	t.Parallel()
+
+	year := func(y int) time.Time {
+		return time.Date(y, 6, 1, 0, 0, 0, 0, time.UTC)
+	}
+	trades := []*Trade{
+		{ExitTime: year(2024), Pnl: 1000},
+		{ExitTime: year(2024), Pnl: -400},
+		{ExitTime: year(2025), Pnl: -300},
+		{ExitTime: year(2026), Pnl: 3_000_000},
+	}
+
+	tax := Tax(trades, NDFL)
+	require.InDelta(t, 600*0.13+2_400_000*0.13+600_000*0.15, tax, 1e-6)
+
+	// before 2025 the threshold is 5 000 000
+	before := []*Trade{
+		{ExitTime: year(2023), Pnl: 3_000_000},
+		{ExitTime: year(2024), Pnl: 6_000_000},
+	}
+	require.InDelta(t, 3_000_000*0.13+5_000_000*0.13+1_000_000*0.15, Tax(before, NDFL), 1e-6)
+
+	// threshold of config is applied to every year
+	cfg := NDFL
+	cfg.Threshold = 1_000_000
+	require.InDelta(t, 1_000_000*0.13+2_000_000*0.15+1_000_000*0.13+5_000_000*0.15, Tax(before, cfg), 1e-6)
+
+	start := year(2024)
+	equity := []EquityPoint{{Time: start, Equity: 1000}, {Time: start.Add(time.Hour * 24 * 30), Equity: 1090}}
+	fills := []*Fill{
+		{Time: start, Direction: ds.Buy, Lots: 1, Amount: 100, Commission: 5},
+		{Time: start.Add(time.Hour), Direction: ds.Sell, Lots: 1, Amount: 200, Commission: 5},
+	}
+
+	r := New("tax", ds.CurrencyRub, equity, fills)
+	require.InDelta(t, 0.1, r.GrossReturn, 1e-9)
+	require.InDelta(t, 0.09, r.AfterTaxReturn, 1e-9)
+
+	r.ApplyTax(NDFL)
+	require.InDelta(t, 90*0.13, r.Tax.ToFloat64(), 1e-9)
+	require.InDelta(t, (1090-90*0.13)/1000-1, r.AfterTaxReturn, 1e-9)
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time {
+		return start.Add(time.Hour * time.Duration(h))
+	}
+	equity := []EquityPoint{
+		{Time: hour(0), Equity: 1000},
+		{Time: hour(1), Equity: 1100, Lots: 1},
+		{Time: hour(2), Equity: 990},
+	}
+	fills := []*Fill{
+		{Time: hour(0), Direction: ds.Buy, Lots: 1, Price: 100, Amount: 100},
+		{Time: hour(2), Direction: ds.Sell, Lots: 1, Price: 90, Amount: 90},
+	}
+	r := New("export", ds.CurrencyRub, equity, fills)
+
+	var eq bytes.Buffer
+	require.NoError(t, WriteEquityCSV(&eq, r))
+	records, err := csv.NewReader(&eq).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, []string{"time", "equity", "drawdown", "lots"}, records[0])
+	require.Equal(t, "0.1000", records[3][2])
+
+	var tr bytes.Buffer
+	require.NoError(t, WriteTradesCSV(&tr, r))
+	records, err = csv.NewReader(&tr).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, []string{"long", hour(0).Format(time.RFC3339), hour(2).Format(time.RFC3339), "100.0000", "90.0000", "1", "-10.0000", "0.0000", "2h0m0s"}, records[1])
+
+	var html bytes.Buffer
+	require.NoError(t, WriteHTML(&html, r, []PricePoint{{Time: hour(0), Price: 100}, {Time: hour(1), Price: 110}, {Time: hour(2), Price: 90}}))
+	page := html.String()
+	require.Contains(t, page, "Backtest export")
+	require.Equal(t, 3, strings.Count(page, "<polyline"))
+	require.Equal(t, 2, strings.Count(page, "<circle"))
+	require.Contains(t, page, `fill="#2ca02c"`)
+	require.NotContains(t, page, "http")
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	trades := []*Trade{
+		{Direction: ds.Buy, Lots: 1, EntryTime: start, ExitTime: start.Add(time.Hour), EntryPrice: 100, ExitPrice: 110, Pnl: 10},
+		{Direction: ds.Buy, Lots: 2, EntryTime: start.Add(time.Hour * 2), ExitTime: start.Add(time.Hour * 3), EntryPrice: 100, ExitPrice: 90, Pnl: -20},
+	}
+	changed := *trades[1]
+	changed.ExitPrice, changed.Pnl = 95, -10
+
+	diffs := DiffTrades(trades, []*Trade{trades[0], &changed, trades[0]})
+	require.Len(t, diffs, 2)
+	require.Equal(t, 1, diffs[0].Index)
+	require.Nil(t, diffs[1].Old)
+
+	// trades are saved with names of trades csv
+	encoded, err := json.Marshal(trades)
+	require.NoError(t, err)
+	require.Contains(t, string(encoded), `"entry_price":100`)
+	var decoded []*Trade
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	require.Empty(t, DiffTrades(trades, decoded))
+
+	// metrics are compared as they are decoded from json
+	var before, after map[string]any
+	for i, r := range []*Report{{Name: "run", TotalReturn: 0.1, Trades: 2}, {Name: "run", TotalReturn: 0.15, Trades: 2}} {
+		encoded, err := json.Marshal(r.Values())
+		require.NoError(t, err)
+		decoded := map[string]any{}
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+		if i == 0 {
+			before = decoded
+		} else {
+			after = decoded
+		}
+	}
+
+	metrics := CompareMetrics(before, after)
+	require.Len(t, metrics, len(Header()))
+	for _, m := range metrics {
+		require.Equal(t, m.Name == "total_return", m.Changed, m.Name)
+		if m.Changed {
+			require.InDelta(t, 0.05, m.Delta, 1e-9)
+		}
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, WriteComparison(&out, "old", "new", metrics, diffs, 1))
+	require.Contains(t, out.String(), "2 trades differ")
+	require.Contains(t, out.String(), "1 more")
+}
@@ -0,0 +1,70 @@
+package report
+
+import ds "trading_bot/internal/service/datastruct"
+
+// TaxCfg is a tax on realised gains of a year, gain over threshold of the year is taxed by HighPercent.
+// Threshold is applied to every year, without it Thresholds are taken by years.
+type TaxCfg struct {
+	Percent     float64
+	HighPercent float64
+	Threshold   float64
+	Thresholds  []TaxThreshold
+}
+
+// TaxThreshold is applied since the year till the next one, thresholds are ordered by years
+type TaxThreshold struct {
+	FromYear  int
+	Threshold float64
+}
+
+// NDFL is russian personal income tax, the threshold is lowered since 2025
+var NDFL = TaxCfg{Percent: 13, HighPercent: 15, Thresholds: []TaxThreshold{
+	{FromYear: 0, Threshold: 5_000_000},
+	{FromYear: 2025, Threshold: 2_400_000},
+}}
+
+func (c *TaxCfg) threshold(year int) float64 {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+
+	var threshold float64
+	for _, t := range c.Thresholds {
+		if year >= t.FromYear {
+			threshold = t.Threshold
+		}
+	}
+
+	return threshold
+}
+
+// Tax sums tax of every year by gains of trades closed in it, losses of a year are not carried forward
+func Tax(trades []*Trade, cfg TaxCfg) float64 {
+	gains := make(map[int]float64)
+	for _, t := range trades {
+		gains[t.ExitTime.Year()] += t.Pnl
+	}
+
+	var tax float64
+	for year, gain := range gains {
+		if gain <= 0 {
+			continue
+		}
+
+		if threshold := cfg.threshold(year); threshold > 0 && gain > threshold {
+			tax += threshold*cfg.Percent/100 + (gain-threshold)*cfg.HighPercent/100
+			continue
+		}
+		tax += gain * cfg.Percent / 100
+	}
+
+	return tax
+}
+
+// ApplyTax sets tax on trades of report and return after it
+func (r *Report) ApplyTax(cfg TaxCfg) {
+	r.Tax = ds.NewMoney(Tax(r.trades, cfg), r.Currency)
+	if start := r.StartEquity.ToFloat64(); start != 0 {
+		r.AfterTaxReturn = (r.FinalEquity.ToFloat64()-r.Tax.ToFloat64())/start - 1
+	}
+}
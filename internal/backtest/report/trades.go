@@ -0,0 +1,92 @@
+package report
+
+import (
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+)
+
+// Fill is an executed order, Amount and Commission are money in base currency
+type Fill struct {
+	Time       time.Time
+	Direction  ds.Action
+	Lots       int64
+	Price      float64
+	Amount     float64
+	Commission float64
+}
+
+// Rejection is an order rejected by broker, for example for lack of money or lots
+type Rejection struct {
+	Time      time.Time
+	Direction ds.Action
+	Lots      int64
+	Reason    string
+}
+
+// Trade is a round trip from opening lots to closing them, json names are kept in saved runs
+type Trade struct {
+	Direction  ds.Action `json:"direction"`
+	Lots       int64     `json:"lots"`
+	EntryTime  time.Time `json:"entry_time"`
+	ExitTime   time.Time `json:"exit_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitPrice  float64   `json:"exit_price"`
+	Commission float64   `json:"commission"`
+	Pnl        float64   `json:"pnl"`
+}
+
+func (t *Trade) Holding() time.Duration {
+	return t.ExitTime.Sub(t.EntryTime)
+}
+
+type openLots struct {
+	fill *Fill
+	lots int64
+}
+
+// RoundTrips matches fills into trades first in first out, lots left open are not trades yet
+func RoundTrips(fills []*Fill) []*Trade {
+	var trades []*Trade
+	var open []*openLots
+
+	for _, f := range fills {
+		rest := f.Lots
+		for rest > 0 && len(open) > 0 && open[0].fill.Direction != f.Direction {
+			entry := open[0]
+			lots := min(rest, entry.lots)
+
+			entryAmount := entry.fill.Amount * float64(lots) / float64(entry.fill.Lots)
+			exitAmount := f.Amount * float64(lots) / float64(f.Lots)
+			commission := entry.fill.Commission*float64(lots)/float64(entry.fill.Lots) +
+				f.Commission*float64(lots)/float64(f.Lots)
+
+			pnl := exitAmount - entryAmount
+			if entry.fill.Direction == ds.Sell {
+				pnl = -pnl
+			}
+
+			trades = append(trades, &Trade{
+				Direction:  entry.fill.Direction,
+				Lots:       lots,
+				EntryTime:  entry.fill.Time,
+				ExitTime:   f.Time,
+				EntryPrice: entry.fill.Price,
+				ExitPrice:  f.Price,
+				Commission: commission,
+				Pnl:        pnl - commission,
+			})
+
+			rest -= lots
+			entry.lots -= lots
+			if entry.lots == 0 {
+				open = open[1:]
+			}
+		}
+
+		if rest > 0 {
+			open = append(open, &openLots{fill: f, lots: rest})
+		}
+	}
+
+	return trades
+}
@@ -0,0 +1,32 @@
+package backtest
+
+import (
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+)
+
+type ISchedulesGetter interface {
+	GetTradingSchedules(exchange string, from, to time.Time) ([]*ds.TradingDay, error)
+}
+
+// ScheduleStatusTTL makes calendar keep status of instrument for the simulated trading day
+const ScheduleStatusTTL = time.Hour * 24
+
+// ScheduleSource gives historical schedules to calendar. History of instrument
+// status is not available, so instrument is considered tradable all the time.
+type ScheduleSource struct {
+	ISchedulesGetter
+}
+
+func NewScheduleSource(g ISchedulesGetter) *ScheduleSource {
+	return &ScheduleSource{ISchedulesGetter: g}
+}
+
+// GetTradingStatus gives status known since the start of the simulated trading day
+func (s *ScheduleSource) GetTradingStatus(instrInfo *ds.InstrumentInfo, t time.Time) (*ds.TradingStatus, error) {
+	return &ds.TradingStatus{
+		ApiAvailable: true,
+		Session:      ds.SessionMain,
+		UpdatedAt:    t.UTC().Truncate(ScheduleStatusTTL),
+	}, nil
+}
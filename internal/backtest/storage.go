@@ -2,15 +2,26 @@ package backtest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
+	"trading_bot/internal/backtest/report"
 	ds "trading_bot/internal/service/datastruct"
 )
 
+var ErrNoMoreCandles = errors.New("out of buffer")
+
 type BacktestStorage struct {
 	instrument    ds.InstrumentInfo
 	historyBuffer []*ds.Candle
 	orders        map[string]*ds.Order
+
+	// fills and equity are kept for the report, orders are removed by strategies
+	fills      []*report.Fill
+	equity     []report.EquityPoint
+	rejections []*report.Rejection
+	interest   float64
+	tax        *report.TaxCfg
 }
 
 func NewBacktestStorage(i ds.InstrumentInfo, b []*ds.Candle) *BacktestStorage {
@@ -25,12 +36,59 @@ func (bs *BacktestStorage) GetInInstrumentsSum() float64 {
 	summ := float64(0)
 	for _, v := range bs.orders {
 		if v.Direction == ds.Buy.ToString() && v.ExecutionReportStatus == ds.Fill.ToString() && v.OrderIdRef == nil {
-			summ += v.OrderPrice.ToFloat64() * float64(v.LotsExecuted) * float64(bs.instrument.Lot)
+			summ += bs.instrument.LotsCost(v.OrderPrice.ToFloat64(), v.LotsExecuted)
 		}
 	}
 	return summ
 }
 
+func (bs *BacktestStorage) PutFill(fill *report.Fill) {
+	bs.fills = append(bs.fills, fill)
+}
+
+func (bs *BacktestStorage) PutEquity(point report.EquityPoint) {
+	bs.equity = append(bs.equity, point)
+}
+
+func (bs *BacktestStorage) PutRejection(rejection *report.Rejection) {
+	bs.rejections = append(bs.rejections, rejection)
+}
+
+func (bs *BacktestStorage) PutInterest(amount float64) {
+	bs.interest += amount
+}
+
+func (bs *BacktestStorage) Rejections() []*report.Rejection {
+	return bs.rejections
+}
+
+func (bs *BacktestStorage) Interest() float64 {
+	return bs.interest
+}
+
+func (bs *BacktestStorage) Equity() []report.EquityPoint {
+	return bs.equity
+}
+
+func (bs *BacktestStorage) Fills() []*report.Fill {
+	return bs.fills
+}
+
+// SetTax makes reports with tax on realised gains
+func (bs *BacktestStorage) SetTax(cfg *report.TaxCfg) {
+	bs.tax = cfg
+}
+
+func (bs *BacktestStorage) Report(name, currency string) *report.Report {
+	r := report.New(name, currency, bs.equity, bs.fills)
+	r.Rejections = len(bs.rejections)
+	r.Interest = ds.NewMoney(bs.interest, r.Currency)
+	if bs.tax != nil {
+		r.ApplyTax(*bs.tax)
+	}
+	return r
+}
+
 func (bs *BacktestStorage) AddCandles(ctx context.Context, instrInfo *ds.InstrumentInfo, candles []*ds.Candle, interval ds.CandleInterval) (err error) {
 	bs.historyBuffer = append(bs.historyBuffer, candles...)
 	return nil
@@ -43,7 +101,7 @@ func (bs *BacktestStorage) AddInstrumentInfo(instrInfo *ds.InstrumentInfo) (id i
 
 func (bs *BacktestStorage) GetCandleWithOffset(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval, from time.Time, to time.Time, offset int64) (*ds.Candle, error) {
 	if offset >= int64(len(bs.historyBuffer)) {
-		return nil, fmt.Errorf("out of buffer")
+		return nil, ErrNoMoreCandles
 	}
 	return bs.historyBuffer[offset], nil
 }
@@ -193,6 +251,10 @@ func (bs *BacktestStorage) UpdateOrder(trId string, instrInfo *ds.InstrumentInfo
 	return nil
 }
 
+func (bs *BacktestStorage) UpdateOrderLatency(trId string, instrInfo *ds.InstrumentInfo, orderId string, latency *ds.OrderLatency) error {
+	return nil
+}
+
 func (bs *BacktestStorage) MakeNewOrder(instrInfo *ds.InstrumentInfo, order *ds.Order) error {
 	return bs.PutOrder(order.TraderId, instrInfo, order)
 }
@@ -203,12 +265,15 @@ func (bs *BacktestStorage) RemoveOrder(instrInfo *ds.InstrumentInfo, order *ds.O
 	v, ok := bs.orders[order.OrderId]
 
 	if !ok {
-		return fmt.Errorf("not found order", ds.HistoryColOrderId, order.OrderId)
+		return fmt.Errorf("not found order %s", order.OrderId)
 	}
 
-	vRef, ok := bs.orders[*v.OrderIdRef]
-	if ok {
-		vRef.OrderIdRef = nil
+	// buy order is unsold again when its sell order is removed
+	if v.OrderIdRef != nil {
+		vRef, ok := bs.orders[*v.OrderIdRef]
+		if ok {
+			vRef.OrderIdRef = nil
+		}
 	}
 
 	return nil
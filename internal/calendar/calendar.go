@@ -0,0 +1,250 @@
+package calendar
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+)
+
+const (
+	schedulesRequestPeriod = time.Hour * 24 * 7
+	schedulesAhead         = time.Hour * 24 * 7
+	day                    = time.Hour * 24
+)
+
+type IScheduleSource interface {
+	GetTradingSchedules(exchange string, from, to time.Time) ([]*ds.TradingDay, error)
+	// GetTradingStatus returns status of instrument at the moment, UpdatedAt of status
+	// is the moment since which status is known
+	GetTradingStatus(instrInfo *ds.InstrumentInfo, t time.Time) (*ds.TradingStatus, error)
+}
+
+type ILogger interface {
+	ErrorfKV(message string, argsKV ...any)
+}
+
+// Calendar caches exchange schedules and instruments trading statuses
+// to answer trading availability without requests on every price
+type Calendar struct {
+	sync.RWMutex
+
+	source    IScheduleSource
+	logger    ILogger
+	statusTTL time.Duration
+
+	days        map[string]map[string]*ds.TradingDay
+	statuses    map[string]*ds.TradingStatus
+	instruments map[string]*ds.InstrumentInfo
+}
+
+func NewCalendar(source IScheduleSource, logger ILogger, statusTTL time.Duration) *Calendar {
+	return &Calendar{
+		source:      source,
+		logger:      logger,
+		statusTTL:   statusTTL,
+		days:        make(map[string]map[string]*ds.TradingDay),
+		statuses:    make(map[string]*ds.TradingStatus),
+		instruments: make(map[string]*ds.InstrumentInfo),
+	}
+}
+
+// Run refreshes statuses of requested instruments and upcoming schedules of their exchanges
+func (c *Calendar) Run(ctx context.Context, refreshDelay time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(refreshDelay):
+			c.refresh(time.Now())
+		}
+	}
+}
+
+func (c *Calendar) refresh(now time.Time) {
+	c.RLock()
+	instruments := make([]*ds.InstrumentInfo, 0, len(c.instruments))
+	for _, v := range c.instruments {
+		instruments = append(instruments, v)
+	}
+	c.RUnlock()
+
+	exchanges := map[string]struct{}{}
+	for _, instrInfo := range instruments {
+		if _, err := c.loadStatus(instrInfo, now); err != nil {
+			c.logger.ErrorfKV("failed refreshing trading status",
+				ds.HistoryColInstrumentUID, instrInfo.Uid, ds.HistoryColError, err.Error())
+		}
+		if instrInfo.Exchange != "" {
+			exchanges[instrInfo.Exchange] = struct{}{}
+		}
+	}
+
+	for exchange := range exchanges {
+		if c.hasSchedules(exchange, now, now.Add(schedulesAhead)) {
+			continue
+		}
+		if err := c.LoadSchedules(exchange, now.Add(-day), now.Add(schedulesAhead)); err != nil {
+			c.logger.ErrorfKV("failed refreshing trading schedules", ds.HistoryColError, err.Error())
+		}
+	}
+}
+
+// LoadSchedules loads exchange schedules for period into cache
+func (c *Calendar) LoadSchedules(exchange string, from, to time.Time) error {
+	for t := from; t.Before(to); t = t.Add(schedulesRequestPeriod) {
+		end := t.Add(schedulesRequestPeriod)
+		if end.After(to) {
+			end = to
+		}
+
+		days, err := c.source.GetTradingSchedules(exchange, t, end)
+		if err != nil {
+			return err
+		}
+
+		c.putDays(days)
+	}
+
+	return nil
+}
+
+func (c *Calendar) putDays(days []*ds.TradingDay) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, d := range days {
+		if _, ok := c.days[d.Exchange]; !ok {
+			c.days[d.Exchange] = make(map[string]*ds.TradingDay)
+		}
+		c.days[d.Exchange][dateKey(d.Date)] = d
+	}
+}
+
+func (c *Calendar) hasSchedules(exchange string, from, to time.Time) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	for t := from; t.Before(to); t = t.Add(day) {
+		if _, ok := c.days[exchange][dateKey(t)]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetSession resolves session of exchange at the moment.
+// Returns false when schedule for the moment is not loaded.
+func (c *Calendar) GetSession(exchange string, t time.Time) (ds.TradingSession, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	days, ok := c.days[exchange]
+	if !ok {
+		return ds.SessionClosed, false
+	}
+
+	today, ok := days[dateKey(t)]
+	if !ok {
+		return ds.SessionClosed, false
+	}
+
+	for _, d := range []*ds.TradingDay{days[dateKey(t.Add(-day))], today} {
+		if d == nil || !d.IsTradingDay {
+			continue
+		}
+
+		if session, ok := sessionOfDay(d, t); ok {
+			return session, true
+		}
+	}
+
+	return ds.SessionClosed, true
+}
+
+func sessionOfDay(d *ds.TradingDay, t time.Time) (ds.TradingSession, bool) {
+	var first, last time.Time
+	for _, s := range d.Sessions {
+		if !t.Before(s.Start) && t.Before(s.End) {
+			return s.Session, true
+		}
+
+		if first.IsZero() || s.Start.Before(first) {
+			first = s.Start
+		}
+		if s.End.After(last) {
+			last = s.End
+		}
+	}
+
+	if !t.Before(first) && t.Before(last) {
+		return ds.SessionBreak, true
+	}
+
+	return ds.SessionClosed, false
+}
+
+// GetTradingAvailability answers availability with cached status and schedule.
+// Schedule only narrows status: instrument halted by exchange is not available
+// whatever the schedule says, but status is refreshed periodically, so closed session
+// of the schedule is trusted over trading status.
+func (c *Calendar) GetTradingAvailability(instrInfo *ds.InstrumentInfo, t time.Time) (ds.TradingAvailability, ds.TradingSession, error) {
+	status, err := c.getStatus(instrInfo, t)
+	if err != nil {
+		return ds.Undefined, ds.SessionClosed, err
+	}
+
+	if !status.ApiAvailable {
+		return ds.NotAvailableViaAPI, status.Session, nil
+	}
+
+	if !status.Session.IsTrading() {
+		return ds.NotAvailableNow, status.Session, nil
+	}
+
+	session := status.Session
+	if s, ok := c.GetSession(instrInfo.Exchange, t); ok {
+		session = s
+	}
+
+	if !session.IsTrading() {
+		return ds.NotAvailableNow, session, nil
+	}
+
+	return ds.Available, session, nil
+}
+
+// getStatus takes cached status if it is known at the moment and not expired.
+// Moment may be in the past when calendar replays history
+func (c *Calendar) getStatus(instrInfo *ds.InstrumentInfo, t time.Time) (*ds.TradingStatus, error) {
+	c.RLock()
+	status, ok := c.statuses[instrInfo.Uid]
+	c.RUnlock()
+
+	if ok && !t.Before(status.UpdatedAt) && t.Sub(status.UpdatedAt) < c.statusTTL {
+		return status, nil
+	}
+
+	return c.loadStatus(instrInfo, t)
+}
+
+func (c *Calendar) loadStatus(instrInfo *ds.InstrumentInfo, t time.Time) (*ds.TradingStatus, error) {
+	status, err := c.source.GetTradingStatus(instrInfo, t)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.statuses[instrInfo.Uid] = status
+	c.instruments[instrInfo.Uid] = instrInfo
+
+	return status, nil
+}
+
+func dateKey(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
@@ -0,0 +1,215 @@
+package calendar
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSource struct {
+	days        []*ds.TradingDay
+	status      *ds.TradingStatus
+	err         error
+	statusCalls int
+}
+
+func (s *testSource) GetTradingSchedules(exchange string, from, to time.Time) ([]*ds.TradingDay, error) {
+	return s.days, s.err
+}
+
+func (s *testSource) GetTradingStatus(instrInfo *ds.InstrumentInfo, t time.Time) (*ds.TradingStatus, error) {
+	s.statusCalls++
+	if s.status != nil && s.status.UpdatedAt.IsZero() {
+		status := *s.status
+		status.UpdatedAt = t.Truncate(time.Hour * 24)
+		return &status, s.err
+	}
+	return s.status, s.err
+}
+
+type testLogger struct{}
+
+func (l *testLogger) ErrorfKV(message string, argsKV ...any) {}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2025, 3, 3, hour, minute, 0, 0, time.UTC)
+}
+
+func newTestDay() *ds.TradingDay {
+	return &ds.TradingDay{
+		Exchange:     "MOEX",
+		Date:         at(0, 0),
+		IsTradingDay: true,
+		Sessions: []ds.SessionInterval{
+			{Session: ds.SessionBreak, Start: at(11, 0), End: at(11, 5)},
+			{Session: ds.SessionOpeningAuction, Start: at(6, 50), End: at(7, 0)},
+			{Session: ds.SessionMain, Start: at(7, 0), End: at(15, 40)},
+			{Session: ds.SessionClosingAuction, Start: at(15, 40), End: at(15, 50)},
+			{Session: ds.SessionEvening, Start: at(16, 5), End: at(20, 50)},
+		},
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	t.Parallel()
+
+	instrInfo := &ds.InstrumentInfo{Uid: "UID", Exchange: "MOEX"}
+
+	t.Run("GetSession", func(t *testing.T) {
+		t.Parallel()
+
+		c := NewCalendar(&testSource{days: []*ds.TradingDay{newTestDay()}}, &testLogger{}, time.Minute)
+		require.Nil(t, c.LoadSchedules("MOEX", at(0, 0), at(23, 0)))
+
+		cases := map[time.Time]ds.TradingSession{
+			at(6, 55):  ds.SessionOpeningAuction,
+			at(10, 0):  ds.SessionMain,
+			at(11, 1):  ds.SessionBreak,
+			at(15, 45): ds.SessionClosingAuction,
+			at(16, 0):  ds.SessionBreak,
+			at(18, 0):  ds.SessionEvening,
+			at(22, 0):  ds.SessionClosed,
+			at(5, 0):   ds.SessionClosed,
+		}
+
+		for tm, expected := range cases {
+			session, ok := c.GetSession("MOEX", tm)
+			require.True(t, ok)
+			require.Equal(t, expected, session, tm.String())
+		}
+	})
+
+	t.Run("GetSession unknown schedule", func(t *testing.T) {
+		t.Parallel()
+
+		c := NewCalendar(&testSource{}, &testLogger{}, time.Minute)
+		_, ok := c.GetSession("MOEX", at(10, 0))
+		require.False(t, ok)
+	})
+
+	t.Run("GetSession not trading day", func(t *testing.T) {
+		t.Parallel()
+
+		d := newTestDay()
+		d.IsTradingDay = false
+		c := NewCalendar(&testSource{days: []*ds.TradingDay{d}}, &testLogger{}, time.Minute)
+		require.Nil(t, c.LoadSchedules("MOEX", at(0, 0), at(23, 0)))
+
+		session, ok := c.GetSession("MOEX", at(10, 0))
+		require.True(t, ok)
+		require.Equal(t, ds.SessionClosed, session)
+	})
+
+	t.Run("GetTradingAvailability uses schedule", func(t *testing.T) {
+		t.Parallel()
+
+		source := &testSource{
+			days:   []*ds.TradingDay{newTestDay()},
+			status: &ds.TradingStatus{ApiAvailable: true, Session: ds.SessionMain, UpdatedAt: at(10, 0)},
+		}
+		c := NewCalendar(source, &testLogger{}, time.Hour*24)
+		require.Nil(t, c.LoadSchedules("MOEX", at(0, 0), at(23, 0)))
+
+		availability, session, err := c.GetTradingAvailability(instrInfo, at(18, 0))
+		require.Nil(t, err)
+		require.Equal(t, ds.Available, availability)
+		require.Equal(t, ds.SessionEvening, session)
+
+		availability, session, err = c.GetTradingAvailability(instrInfo, at(15, 45))
+		require.Nil(t, err)
+		require.Equal(t, ds.NotAvailableNow, availability)
+		require.Equal(t, ds.SessionClosingAuction, session)
+
+		require.Equal(t, 1, source.statusCalls)
+	})
+
+	t.Run("GetTradingAvailability keeps instrument break", func(t *testing.T) {
+		t.Parallel()
+
+		source := &testSource{
+			days:   []*ds.TradingDay{newTestDay()},
+			status: &ds.TradingStatus{ApiAvailable: true, Session: ds.SessionBreak, UpdatedAt: at(10, 0)},
+		}
+		c := NewCalendar(source, &testLogger{}, time.Hour*24)
+		require.Nil(t, c.LoadSchedules("MOEX", at(0, 0), at(23, 0)))
+
+		availability, session, err := c.GetTradingAvailability(instrInfo, at(10, 0))
+		require.Nil(t, err)
+		require.Equal(t, ds.NotAvailableNow, availability)
+		require.Equal(t, ds.SessionBreak, session)
+	})
+
+	t.Run("GetTradingAvailability keeps instrument halt", func(t *testing.T) {
+		t.Parallel()
+
+		source := &testSource{
+			days:   []*ds.TradingDay{newTestDay()},
+			status: &ds.TradingStatus{ApiAvailable: true, Session: ds.SessionClosed, UpdatedAt: at(10, 0)},
+		}
+		c := NewCalendar(source, &testLogger{}, time.Hour*24)
+		require.Nil(t, c.LoadSchedules("MOEX", at(0, 0), at(23, 0)))
+
+		availability, session, err := c.GetTradingAvailability(instrInfo, at(10, 0))
+		require.Nil(t, err)
+		require.Equal(t, ds.NotAvailableNow, availability)
+		require.Equal(t, ds.SessionClosed, session)
+	})
+
+	t.Run("GetTradingAvailability not via api", func(t *testing.T) {
+		t.Parallel()
+
+		source := &testSource{status: &ds.TradingStatus{ApiAvailable: false, UpdatedAt: at(10, 0)}}
+		c := NewCalendar(source, &testLogger{}, time.Hour)
+
+		availability, _, err := c.GetTradingAvailability(instrInfo, at(10, 0))
+		require.Nil(t, err)
+		require.Equal(t, ds.NotAvailableViaAPI, availability)
+	})
+
+	t.Run("GetTradingAvailability refreshes expired status", func(t *testing.T) {
+		t.Parallel()
+
+		source := &testSource{status: &ds.TradingStatus{ApiAvailable: true, Session: ds.SessionMain, UpdatedAt: at(10, 0)}}
+		c := NewCalendar(source, &testLogger{}, time.Minute)
+
+		_, _, err := c.GetTradingAvailability(instrInfo, at(10, 0))
+		require.Nil(t, err)
+		_, _, err = c.GetTradingAvailability(instrInfo, at(10, 5))
+		require.Nil(t, err)
+
+		require.Equal(t, 2, source.statusCalls)
+	})
+
+	t.Run("GetTradingAvailability keeps status of simulated day", func(t *testing.T) {
+		t.Parallel()
+
+		// status without UpdatedAt is known since the start of the day of request
+		source := &testSource{status: &ds.TradingStatus{ApiAvailable: true, Session: ds.SessionMain}}
+		c := NewCalendar(source, &testLogger{}, time.Hour*24)
+
+		for _, tm := range []time.Time{at(10, 0), at(18, 0), at(10, 0).Add(time.Hour * 24), at(12, 0).Add(time.Hour * 24)} {
+			_, _, err := c.GetTradingAvailability(instrInfo, tm)
+			require.Nil(t, err)
+		}
+		require.Equal(t, 2, source.statusCalls)
+
+		// status is not known before it was updated
+		_, _, err := c.GetTradingAvailability(instrInfo, at(10, 0))
+		require.Nil(t, err)
+		require.Equal(t, 3, source.statusCalls)
+	})
+
+	t.Run("GetTradingAvailability error", func(t *testing.T) {
+		t.Parallel()
+
+		c := NewCalendar(&testSource{err: errors.New("error")}, &testLogger{}, time.Minute)
+
+		availability, _, err := c.GetTradingAvailability(instrInfo, at(10, 0))
+		require.NotNil(t, err)
+		require.Equal(t, ds.Undefined, availability)
+	})
+}
@@ -47,6 +47,10 @@ func NewClient(ctx context.Context) *Client {
 		Topic:             ds.TopicLogs,
 		NumPartitions:     1,
 		ReplicationFactor: 1,
+	}, kafkago.TopicConfig{
+		Topic:             ds.TopicOrdersLatency,
+		NumPartitions:     1,
+		ReplicationFactor: 1,
 	})
 	if err != nil {
 		panic(err)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 	ds "trading_bot/internal/service/datastruct"
@@ -24,10 +25,17 @@ const (
 )
 
 type Client struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	schema string
 }
 
 func NewClient(ctx context.Context) (*Client, error) {
+	return NewClientWithSchema(ctx, "")
+}
+
+// NewClientWithSchema makes client which looks for tables in schema first,
+// so the same queries work with tables of another schema
+func NewClientWithSchema(ctx context.Context, schema string) (*Client, error) {
 	host := supports.ReadSecret(db_host_secret_path)
 	port := supports.ReadSecret(db_port_secret_path)
 	user := supports.ReadSecret(db_user_secret_path)
@@ -40,6 +48,9 @@ func NewClient(ctx context.Context) (*Client, error) {
 
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
+	if schema != "" {
+		dsn += fmt.Sprintf(" search_path=%s,public", schema)
+	}
 
 	db, err := sqlx.Connect("postgres", dsn)
 	if err != nil {
@@ -54,17 +65,18 @@ func NewClient(ctx context.Context) (*Client, error) {
 	db.SetMaxIdleConns(5)
 	db.SetMaxOpenConns(10)
 
-	return buildClient(db), nil
+	return buildClient(db, schema), nil
 }
 
-func buildClient(db *sqlx.DB) *Client {
+func buildClient(db *sqlx.DB, schema string) *Client {
 	return &Client{
-		db: db,
+		db:     db,
+		schema: schema,
 	}
 }
 
 func (c *Client) UpdateConnection(ctx context.Context) error {
-	newClient, err := NewClient(ctx)
+	newClient, err := NewClientWithSchema(ctx, c.schema)
 	if err != nil {
 		return err
 	}
@@ -79,11 +91,43 @@ func (c *Client) GetDB() *sql.DB {
 	return c.db.DB
 }
 
-func (c *Client) AddInstrumentInfo(instrInfo *ds.InstrumentInfo) (dbId int64, err error) {
+const instrumentColumns = `id, uid, isin, figi, ticker, class_code, name, lot, available_api, for_quals,
+	instrument_type, basic_asset,
+	min_price_increment_units AS "min_price_increment.units", min_price_increment_nano AS "min_price_increment.nano",
+	min_price_increment_amount_units AS "min_price_increment_amount.units", min_price_increment_amount_nano AS "min_price_increment_amount.nano",
+	initial_margin_on_buy_units AS "initial_margin_on_buy.units", initial_margin_on_buy_nano AS "initial_margin_on_buy.nano",
+	initial_margin_on_sell_units AS "initial_margin_on_sell.units", initial_margin_on_sell_nano AS "initial_margin_on_sell.nano",
+	expiration_date,
+	nominal_units AS "nominal.units", nominal_nano AS "nominal.nano",
+	aci_value_units AS "aci_value.units", aci_value_nano AS "aci_value.nano",
+	maturity_date, currency`
+
+func instrumentValues(instrInfo *ds.InstrumentInfo) []any {
+	return []any{instrInfo.Uid, instrInfo.Isin, instrInfo.Figi, instrInfo.Ticker, instrInfo.ClassCode, instrInfo.Name,
+		instrInfo.Lot, instrInfo.AvailableApi, instrInfo.ForQuals, instrInfo.Type, instrInfo.BasicAsset,
+		instrInfo.MinPriceIncrement.Units, instrInfo.MinPriceIncrement.Nano,
+		instrInfo.MinPriceIncrementAmount.Units, instrInfo.MinPriceIncrementAmount.Nano,
+		instrInfo.InitialMarginOnBuy.Units, instrInfo.InitialMarginOnBuy.Nano,
+		instrInfo.InitialMarginOnSell.Units, instrInfo.InitialMarginOnSell.Nano,
+		instrInfo.ExpirationDate,
+		instrInfo.Nominal.Units, instrInfo.Nominal.Nano, instrInfo.AciValue.Units, instrInfo.AciValue.Nano,
+		instrInfo.MaturityDate, ds.NormalizeCurrency(instrInfo.Currency)}
+}
+
+func (c *Client) AddInstrumentInfo(instrInfo *ds.InstrumentInfo) (int64, error) {
+	dbId, _, err := c.ResolveInstrument(instrInfo)
+	return dbId, err
+}
+
+// ResolveInstrument adds instrument or updates the row of the same instrument stored
+// under another uid. Rows split by uid changes are relinked to the oldest one.
+// Returns uids which were replaced. Concurrent calls for the same ticker or isin are
+// serialized by advisory locks, so loaders of different instruments do not block each other.
+func (c *Client) ResolveInstrument(instrInfo *ds.InstrumentInfo) (dbId int64, oldUids []string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	var tx *sql.Tx
+	var tx *sqlx.Tx
 	defer func() {
 		if p := recover(); p != nil {
 			err = fmt.Errorf("panic recovered: %v. rollback error: %s", p, tx.Rollback().Error())
@@ -96,26 +140,204 @@ func (c *Client) AddInstrumentInfo(instrInfo *ds.InstrumentInfo) (dbId int64, er
 		}
 	}()
 
-	tx, err = c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	tx, err = c.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return
+	}
+
+	if err = lockInstrument(ctx, tx, instrInfo); err != nil {
+		return
+	}
+
+	var known []*ds.InstrumentInfo
+	query := `SELECT ` + instrumentColumns + ` FROM public.instruments
+		WHERE class_code = $1
+		AND ((ticker = $2 AND ticker <> '') OR (isin = $3 AND isin <> ''))
+		ORDER BY id
+		FOR UPDATE`
+	err = tx.SelectContext(ctx, &known, query, instrInfo.ClassCode, instrInfo.Ticker, instrInfo.Isin)
 	if err != nil {
 		return
 	}
 
-	query := `INSERT INTO instruments (uid, isin, figi, ticker, class_code, name, lot, available_api, for_quals)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (uid, isin, figi, ticker)
-		DO UPDATE SET 
-			lot = EXCLUDED.lot,
-			name = EXCLUDED.name,
-			available_api = EXCLUDED.available_api,
-			for_quals = EXCLUDED.for_quals
+	if len(known) == 0 {
+		query = `INSERT INTO public.instruments (uid, isin, figi, ticker, class_code, name, lot, available_api, for_quals,
+				instrument_type, basic_asset, min_price_increment_units, min_price_increment_nano,
+				min_price_increment_amount_units, min_price_increment_amount_nano,
+				initial_margin_on_buy_units, initial_margin_on_buy_nano, initial_margin_on_sell_units, initial_margin_on_sell_nano,
+				expiration_date, nominal_units, nominal_nano, aci_value_units, aci_value_nano, maturity_date, currency)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+				$21, $22, $23, $24, $25, $26)
+			ON CONFLICT (uid, isin, figi, ticker)
+			DO UPDATE SET 
+				lot = EXCLUDED.lot,
+				name = EXCLUDED.name,
+				available_api = EXCLUDED.available_api,
+				for_quals = EXCLUDED.for_quals,
+				instrument_type = EXCLUDED.instrument_type,
+				basic_asset = EXCLUDED.basic_asset,
+				min_price_increment_units = EXCLUDED.min_price_increment_units,
+				min_price_increment_nano = EXCLUDED.min_price_increment_nano,
+				min_price_increment_amount_units = EXCLUDED.min_price_increment_amount_units,
+				min_price_increment_amount_nano = EXCLUDED.min_price_increment_amount_nano,
+				initial_margin_on_buy_units = EXCLUDED.initial_margin_on_buy_units,
+				initial_margin_on_buy_nano = EXCLUDED.initial_margin_on_buy_nano,
+				initial_margin_on_sell_units = EXCLUDED.initial_margin_on_sell_units,
+				initial_margin_on_sell_nano = EXCLUDED.initial_margin_on_sell_nano,
+				expiration_date = EXCLUDED.expiration_date,
+				nominal_units = EXCLUDED.nominal_units,
+				nominal_nano = EXCLUDED.nominal_nano,
+				aci_value_units = EXCLUDED.aci_value_units,
+				aci_value_nano = EXCLUDED.aci_value_nano,
+				maturity_date = EXCLUDED.maturity_date,
+				currency = EXCLUDED.currency
+			RETURNING id;`
+
+		if err = tx.GetContext(ctx, &dbId, query, instrumentValues(instrInfo)...); err != nil {
+			return
+		}
+		err = putCoupons(ctx, tx, dbId, instrInfo.Coupons)
+		return
+	}
+
+	canonical := known[0]
+	for _, instr := range known {
+		if instr.Uid != instrInfo.Uid && !slices.Contains(oldUids, instr.Uid) {
+			oldUids = append(oldUids, instr.Uid)
+		}
+		if instr.Id == canonical.Id {
+			continue
+		}
+		if err = relinkInstrument(ctx, tx, canonical.Id, instr.Id); err != nil {
+			return
+		}
+	}
+
+	query = `UPDATE public.instruments SET
+			uid = $1,
+			isin = $2,
+			figi = $3,
+			ticker = $4,
+			class_code = $5,
+			name = $6,
+			lot = $7,
+			available_api = $8,
+			for_quals = $9,
+			instrument_type = $10,
+			basic_asset = $11,
+			min_price_increment_units = $12,
+			min_price_increment_nano = $13,
+			min_price_increment_amount_units = $14,
+			min_price_increment_amount_nano = $15,
+			initial_margin_on_buy_units = $16,
+			initial_margin_on_buy_nano = $17,
+			initial_margin_on_sell_units = $18,
+			initial_margin_on_sell_nano = $19,
+			expiration_date = $20,
+			nominal_units = $21,
+			nominal_nano = $22,
+			aci_value_units = $23,
+			aci_value_nano = $24,
+			maturity_date = $25,
+			currency = $26
+		WHERE id = $27
 		RETURNING id;`
 
-	err = c.db.GetContext(ctx, &dbId, query, instrInfo.Uid, instrInfo.Isin, instrInfo.Figi, instrInfo.Ticker,
-		instrInfo.ClassCode, instrInfo.Name, instrInfo.Lot, instrInfo.AvailableApi, instrInfo.ForQuals)
+	if err = tx.GetContext(ctx, &dbId, query, append(instrumentValues(instrInfo), canonical.Id)...); err != nil {
+		return
+	}
+	err = putCoupons(ctx, tx, dbId, instrInfo.Coupons)
 
 	return
 }
 
+// lockInstrument takes transaction advisory locks on ticker and isin of instrument class.
+// Keys are taken in the same order to avoid deadlocks.
+func lockInstrument(ctx context.Context, tx *sqlx.Tx, instrInfo *ds.InstrumentInfo) error {
+	var keys []string
+	if instrInfo.Ticker != "" {
+		keys = append(keys, "ticker:"+instrInfo.ClassCode+":"+instrInfo.Ticker)
+	}
+	if instrInfo.Isin != "" {
+		keys = append(keys, "isin:"+instrInfo.ClassCode+":"+instrInfo.Isin)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key); err != nil {
+			return fmt.Errorf("failed locking instrument %s: %s", key, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func putCoupons(ctx context.Context, tx *sqlx.Tx, instrumentId int64, coupons []*ds.Coupon) error {
+	query := `INSERT INTO public.coupons
+		(instrument_id, coupon_date, coupon_start_date, coupon_end_date, pay_one_bond_units, pay_one_bond_nano)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (instrument_id, coupon_date) DO UPDATE SET
+			coupon_start_date = EXCLUDED.coupon_start_date,
+			coupon_end_date = EXCLUDED.coupon_end_date,
+			pay_one_bond_units = EXCLUDED.pay_one_bond_units,
+			pay_one_bond_nano = EXCLUDED.pay_one_bond_nano`
+
+	for _, c := range coupons {
+		_, err := tx.ExecContext(ctx, query, instrumentId, c.Date, c.StartDate, c.EndDate, c.Amount.Units, c.Amount.Nano)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relinkInstrument moves orders, candles and paper positions to another instrument row
+// and removes the old one
+func relinkInstrument(ctx context.Context, tx *sqlx.Tx, toId, fromId int64) error {
+	queries := []string{
+		`UPDATE public.orders SET instrument_id = $1 WHERE instrument_id = $2`,
+		`INSERT INTO public.candles
+			(instrument_id, timestamp, interval, open_units, open_nano, close_units, close_nano, high_units, high_nano, low_units, low_nano, volume)
+			SELECT $1, timestamp, interval, open_units, open_nano, close_units, close_nano, high_units, high_nano, low_units, low_nano, volume
+			FROM public.candles WHERE instrument_id = $2
+			ON CONFLICT (instrument_id, timestamp, interval) DO NOTHING`,
+	}
+
+	var hasPaper bool
+	if err := tx.GetContext(ctx, &hasPaper, `SELECT to_regclass('paper.orders') IS NOT NULL`); err != nil {
+		return err
+	}
+	if hasPaper {
+		// position of account which already has one on the new row is dropped with the old row
+		queries = append(queries,
+			`UPDATE paper.orders SET instrument_id = $1 WHERE instrument_id = $2`,
+			`UPDATE paper.positions p SET instrument_id = $1
+				WHERE p.instrument_id = $2
+				AND NOT EXISTS (SELECT 1 FROM paper.positions o WHERE o.instrument_id = $1 AND o.account_id = p.account_id)`,
+		)
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, toId, fromId); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM public.instruments WHERE id = $1`, fromId)
+	return err
+}
+
+// FindInstrumentSplits returns instruments stored in several rows
+func (c *Client) FindInstrumentSplits() ([]*ds.InstrumentSplit, error) {
+	var instrs []*ds.InstrumentInfo
+	if err := c.db.Select(&instrs, `SELECT `+instrumentColumns+` FROM public.instruments ORDER BY id`); err != nil {
+		return nil, err
+	}
+
+	return ds.GroupInstrumentSplits(instrs), nil
+}
+
 func (c *Client) GetInstrumentInfo(uid string) (info *ds.InstrumentInfo, err error) {
 	defer func() {
 		if p := recover(); p != nil {
@@ -124,9 +346,18 @@ func (c *Client) GetInstrumentInfo(uid string) (info *ds.InstrumentInfo, err err
 	}()
 	info = &ds.InstrumentInfo{}
 
-	query := `SELECT * FROM instruments WHERE uid = $1`
+	query := `SELECT ` + instrumentColumns + ` FROM instruments WHERE uid = $1`
+
+	if err = c.db.Get(info, query, uid); err != nil {
+		return
+	}
 
-	err = c.db.Get(info, query, uid)
+	if info.IsBond() {
+		query = `SELECT coupon_date, coupon_start_date, coupon_end_date,
+			pay_one_bond_units AS "pay_one_bond.units", pay_one_bond_nano AS "pay_one_bond.nano"
+			FROM coupons WHERE instrument_id = $1 ORDER BY coupon_date`
+		err = c.db.Select(&info.Coupons, query, info.Id)
+	}
 
 	return
 }
@@ -307,6 +538,26 @@ func (c *Client) UpdateOrder(trId string, instrInfo *ds.InstrumentInfo, order *d
 	return
 }
 
+// UpdateOrderLatency sets only passed moments, the first fill moment is kept
+func (c *Client) UpdateOrderLatency(trId string, instrInfo *ds.InstrumentInfo, orderId string, latency *ds.OrderLatency) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	query := `UPDATE orders
+		SET decided_at = COALESCE($1, decided_at),
+			sent_at = COALESCE($2, sent_at),
+			acked_at = COALESCE($3, acked_at),
+			filled_at = COALESCE(filled_at, $4)
+		WHERE instrument_id = $5
+		AND trader_id = $6
+		AND order_id = $7;`
+
+	_, err := c.db.ExecContext(ctx, query, latency.DecidedAt, latency.SentAt, latency.AckedAt, latency.FilledAt,
+		instrInfo.Id, trId, orderId)
+
+	return err
+}
+
 func (c *Client) GetLowestExecutedBuyOrder(trId string, instrInfo *ds.InstrumentInfo) (*ds.Order, bool, error) {
 	query := `SELECT id, created_at, completed_at, order_id, direction, exec_report_status,
 		price_units AS "price.units", price_nano AS "price.nano", lots_requested, 
@@ -370,6 +621,32 @@ func (c *Client) selectOrder(query string, trId string, instrInfo *ds.Instrument
 	return orders[0], true, err
 }
 
+// GetUnsoldOrders returns executed buy orders of trader which are not linked to sell orders
+func (c *Client) GetUnsoldOrders(trId string, instrInfo *ds.InstrumentInfo) ([]*ds.Order, error) {
+	query := `SELECT id, created_at, completed_at, order_id, direction, exec_report_status,
+		price_units AS "price.units", price_nano AS "price.nano", lots_requested,
+		lots_executed, additional_info
+		FROM orders
+		WHERE instrument_id = $1
+		AND direction = 'BUY'
+		AND lots_executed > 0
+		AND trader_id = $2
+		AND order_id_ref IS NULL
+		ORDER BY created_at;`
+
+	var orders []*ds.Order
+	if err := c.db.Select(&orders, query, instrInfo.Id, trId); err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		order.InstrumentUid = instrInfo.Uid
+		order.TraderId = trId
+	}
+
+	return orders, nil
+}
+
 func (c *Client) GetUnsoldOrdersAmount(trId string, instrInfo *ds.InstrumentInfo) (int64, error) {
 	query := `SELECT COUNT(*) FROM orders
 		WHERE instrument_id = $1
@@ -459,3 +736,93 @@ func (c *Client) RemoveOrder(instrInfo *ds.InstrumentInfo, order *ds.Order) (err
 
 	return
 }
+
+func (c *Client) GetPosition(accountId string, instrInfo *ds.InstrumentInfo) (*ds.Position, error) {
+	query := `SELECT id, account_id, instrument_id, lots,
+		average_price_units AS "average_price.units", average_price_nano AS "average_price.nano",
+		realized_pnl_units AS "realized_pnl.units", realized_pnl_nano AS "realized_pnl.nano",
+		commission_units AS "commission.units", commission_nano AS "commission.nano", currency,
+		realized_pnl_base_units AS "realized_pnl_base.units", realized_pnl_base_nano AS "realized_pnl_base.nano",
+		base_currency, updated_at
+		FROM positions
+		WHERE instrument_id = $1
+		AND account_id = $2;`
+
+	var positions []*ds.Position
+	err := c.db.Select(&positions, query, instrInfo.Id, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positions) == 0 {
+		return &ds.Position{AccountId: accountId, InstrumentId: instrInfo.Id, Currency: ds.NormalizeCurrency(instrInfo.Currency)}, nil
+	}
+
+	return positions[0], nil
+}
+
+func (c *Client) UpdatePosition(pos *ds.Position) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	query := `INSERT INTO positions
+		(account_id, instrument_id, lots, average_price_units, average_price_nano,
+		realized_pnl_units, realized_pnl_nano, commission_units, commission_nano, currency,
+		realized_pnl_base_units, realized_pnl_base_nano, base_currency, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+		ON CONFLICT (account_id, instrument_id) DO UPDATE SET
+			lots = EXCLUDED.lots,
+			average_price_units = EXCLUDED.average_price_units,
+			average_price_nano = EXCLUDED.average_price_nano,
+			realized_pnl_units = EXCLUDED.realized_pnl_units,
+			realized_pnl_nano = EXCLUDED.realized_pnl_nano,
+			commission_units = EXCLUDED.commission_units,
+			commission_nano = EXCLUDED.commission_nano,
+			currency = EXCLUDED.currency,
+			realized_pnl_base_units = EXCLUDED.realized_pnl_base_units,
+			realized_pnl_base_nano = EXCLUDED.realized_pnl_base_nano,
+			base_currency = EXCLUDED.base_currency,
+			updated_at = EXCLUDED.updated_at;`
+
+	_, err := c.db.ExecContext(ctx, query, pos.AccountId, pos.InstrumentId, pos.Lots,
+		pos.AveragePrice.Units, pos.AveragePrice.Nano, pos.RealizedPnl.Units, pos.RealizedPnl.Nano,
+		pos.Commission.Units, pos.Commission.Nano, ds.NormalizeCurrency(pos.Currency),
+		pos.RealizedPnlBase.Units, pos.RealizedPnlBase.Nano, ds.NormalizeCurrency(pos.BaseCurrency), pos.UpdatedAt)
+
+	return err
+}
+
+func (c *Client) PutBacktestRun(run *ds.BacktestRun) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	query := `INSERT INTO backtest_runs
+		(id, git_commit, trader_id, strategy, config, from_time, to_time, metrics, trades)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9);`
+
+	// json is passed as text, bytes would be sent as bytea
+	_, err := c.db.ExecContext(ctx, query, run.Id, run.GitCommit, run.TraderId, run.Strategy,
+		string(run.Config), run.From, run.To, string(run.Metrics), string(run.Trades))
+	if err != nil {
+		return fmt.Errorf("failed putting backtest run %s: %s", run.Id, err.Error())
+	}
+
+	return nil
+}
+
+func (c *Client) GetBacktestRun(id string) (*ds.BacktestRun, error) {
+	query := `SELECT id, created_at, git_commit, trader_id, strategy, config, from_time, to_time, metrics, trades
+		FROM backtest_runs
+		WHERE id = $1;`
+
+	var runs []*ds.BacktestRun
+	if err := c.db.Select(&runs, query, id); err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("backtest run %s is not found", id)
+	}
+
+	return runs[0], nil
+}
@@ -0,0 +1,240 @@
+package t_api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/supports"
+
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	pb "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+// max period of candles in one GetCandles request
+var candlesRequestPeriod = map[ds.CandleInterval]time.Duration{
+	ds.Interval_1_Min:  time.Hour * 24,
+	ds.Interval_2_Min:  time.Hour * 24,
+	ds.Interval_3_Min:  time.Hour * 24,
+	ds.Interval_5_Min:  time.Hour * 24,
+	ds.Interval_10_Min: time.Hour * 24,
+	ds.Interval_15_Min: time.Hour * 24,
+	ds.Interval_30_Min: time.Hour * 24 * 2,
+	ds.Interval_Hour:   time.Hour * 24 * 7,
+	ds.Interval_2_Hour: time.Hour * 24 * 30,
+	ds.Interval_4_Hour: time.Hour * 24 * 30,
+	ds.Interval_Day:    time.Hour * 24 * 365,
+	ds.Interval_Week:   time.Hour * 24 * 365 * 2,
+	ds.Interval_Month:  time.Hour * 24 * 365 * 10,
+}
+
+var subscriptionIntervalMap = map[ds.CandleInterval]pb.SubscriptionInterval{
+	ds.Interval_1_Min:  pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MINUTE,
+	ds.Interval_2_Min:  pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_2_MIN,
+	ds.Interval_3_Min:  pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_3_MIN,
+	ds.Interval_5_Min:  pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_FIVE_MINUTES,
+	ds.Interval_10_Min: pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_10_MIN,
+	ds.Interval_15_Min: pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_FIFTEEN_MINUTES,
+	ds.Interval_30_Min: pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_30_MIN,
+	ds.Interval_Hour:   pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_HOUR,
+	ds.Interval_2_Hour: pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_2_HOUR,
+	ds.Interval_4_Hour: pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_4_HOUR,
+	ds.Interval_Day:    pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_DAY,
+	ds.Interval_Week:   pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_WEEK,
+	ds.Interval_Month:  pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MONTH,
+}
+
+func resolveIntervalFromSubscription(interval pb.SubscriptionInterval) (ds.CandleInterval, bool) {
+	for k, v := range subscriptionIntervalMap {
+		if v == interval {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// GetHistoricCandles loads candles splitting period into single requests,
+// so every request goes through rate limiter
+func (c *Client) GetHistoricCandles(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval, from, to time.Time) ([]*ds.Candle, error) {
+	step := candlesRequestPeriod[interval]
+
+	var candles []*ds.Candle
+	for t := from; t.Before(to); t = t.Add(step) {
+		end := t.Add(step)
+		if end.After(to) {
+			end = to
+		}
+
+		hist, err := Invoke(c, QuotaMarketData, func() ([]*pb.HistoricCandle, error) {
+			return c.NewMarketDataServiceClient().GetHistoricCandles(&investgo.GetHistoricCandlesRequest{
+				Instrument: instrInfo.Uid,
+				Interval:   ResolveIntoPbInterval(interval),
+				From:       t,
+				To:         end,
+				Source:     pb.GetCandlesRequest_CANDLE_SOURCE_EXCHANGE,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range hist {
+			candles = append(candles, &ds.Candle{
+				InstrumentId: instrInfo.Id,
+				Interval:     interval.ToString(),
+				Open:         quotationFromPb(v.Open),
+				Close:        quotationFromPb(v.Close),
+				High:         quotationFromPb(v.High),
+				Low:          quotationFromPb(v.Low),
+				Volume:       v.Volume,
+				Timestamp:    v.Time.AsTime(),
+			})
+		}
+	}
+
+	return candles, nil
+}
+
+func quotationFromPb(q *pb.Quotation) ds.Quotation {
+	if q == nil {
+		return ds.Quotation{}
+	}
+
+	return ds.Quotation{
+		Units: q.Units,
+		Nano:  q.Nano,
+	}
+}
+
+func moneyFromPb(m *pb.MoneyValue) ds.Quotation {
+	if m == nil {
+		return ds.Quotation{}
+	}
+
+	return ds.Quotation{
+		Units: m.Units,
+		Nano:  m.Nano,
+	}
+}
+
+func candleKey(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) subscriptionKey {
+	return subscriptionKey{kind: candleSubscription, id: instrInfo.Uid, param: interval.ToString()}
+}
+
+// RegisterCandleRecipient subscribes on candles which are sent by server
+// only when they are closed
+func (c *Client) RegisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error {
+	if _, ok := subscriptionIntervalMap[interval]; !ok {
+		return fmt.Errorf("unsupported candles interval: %s", interval.ToString())
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	instrUid := InstrumentUid(instrInfo.Uid)
+	instanceId := InstanceId(instrInfo.InstanceId)
+	key := candleKey(instrInfo, interval)
+
+	if c.subscriptions.acquire(key, instanceId) {
+		if err := c.subscribeMarketData(key); err != nil {
+			c.subscriptions.release(key, instanceId)
+			return err
+		}
+	}
+
+	if _, ok := c.candleInput[instrUid]; !ok {
+		c.candleInput[instrUid] = make(map[ds.CandleInterval]map[InstanceId]chan *pb.Candle)
+	}
+	if _, ok := c.candleInput[instrUid][interval]; !ok {
+		c.candleInput[instrUid][interval] = make(map[InstanceId]chan *pb.Candle)
+	}
+	if _, ok := c.candleInput[instrUid][interval][instanceId]; !ok {
+		c.candleInput[instrUid][interval][instanceId] = make(chan *pb.Candle, 100)
+	}
+
+	return nil
+}
+
+func (c *Client) UnregisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error {
+	c.Lock()
+	defer c.Unlock()
+
+	instrUid := InstrumentUid(instrInfo.Uid)
+	instanceId := InstanceId(instrInfo.InstanceId)
+	key := candleKey(instrInfo, interval)
+
+	if _, ok := c.candleInput[instrUid][interval][instanceId]; ok {
+		supports.CloseIfMaybeClosed(c.candleInput[instrUid][interval][instanceId])
+	}
+
+	delete(c.candleInput[instrUid][interval], instanceId)
+
+	if len(c.candleInput[instrUid][interval]) == 0 {
+		delete(c.candleInput[instrUid], interval)
+	}
+	if len(c.candleInput[instrUid]) == 0 {
+		delete(c.candleInput, instrUid)
+	}
+
+	if c.subscriptions.release(key, instanceId) {
+		return c.unsubscribeMarketData(key)
+	}
+
+	return nil
+}
+
+func (c *Client) RecieveCandle(ctx context.Context, instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) (*ds.Candle, error) {
+	c.RLock()
+	ch := c.candleInput[InstrumentUid(instrInfo.Uid)][interval][InstanceId(instrInfo.InstanceId)]
+	c.RUnlock()
+
+	var candle *pb.Candle
+	var ok bool
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("recieving candle context done for %s", instrInfo.Ticker)
+	case candle, ok = <-ch:
+		if !ok {
+			return nil, fmt.Errorf("marketDataStream closed for %s", instrInfo.Ticker)
+		}
+	}
+
+	return &ds.Candle{
+		InstrumentId: instrInfo.Id,
+		Interval:     interval.ToString(),
+		Open:         quotationFromPb(candle.Open),
+		Close:        quotationFromPb(candle.Close),
+		High:         quotationFromPb(candle.High),
+		Low:          quotationFromPb(candle.Low),
+		Volume:       candle.Volume,
+		Timestamp:    candle.Time.AsTime(),
+	}, nil
+}
+
+func (c *Client) startCandleRouting(ch <-chan *pb.Candle) {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case v, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			interval, ok := resolveIntervalFromSubscription(v.Interval)
+			if !ok {
+				continue
+			}
+
+			c.Lock()
+			for _, uniqueListener := range c.candleInput[InstrumentUid(v.InstrumentUid)][interval] {
+				if err := supports.SendOrSkipIfMaybeClosed(uniqueListener, v); err != nil {
+					c.Logger.Errorf("error on getting candle", ds.HistoryColError, err.Error())
+				}
+			}
+			c.Unlock()
+		}
+	}
+}
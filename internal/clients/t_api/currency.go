@@ -0,0 +1,137 @@
+package t_api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	pb "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+// GetExchangeRateHistory returns history of rub prices of currencies taken from day candles
+// of currency instruments. Rate of the day is its open price, so it is known from the start of the day.
+func (c *Client) GetExchangeRateHistory(from, to time.Time, currencies ...string) (ds.RateHistories, error) {
+	instrs, err := c.currencyInstruments(currencies...)
+	if err != nil {
+		return nil, err
+	}
+
+	histories := ds.RateHistories{}
+	for iso, instr := range instrs {
+		candles, err := c.GetHistoricCandles(&ds.InstrumentInfo{Uid: instr.GetUid(), Ticker: instr.GetTicker()}, ds.Interval_Day, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting candles of currency %s: %s", iso, err.Error())
+		}
+		if len(candles) == 0 {
+			return nil, fmt.Errorf("no candles of currency %s for %s - %s", iso, from.Format(time.DateOnly), to.Format(time.DateOnly))
+		}
+
+		// some currencies are quoted for their nominal like 100 units
+		nominal := moneyFromPb(instr.GetNominal())
+
+		history := make(ds.RateHistory, 0, len(candles))
+		for _, candle := range candles {
+			rate := candle.Open.ToFloat64()
+			if nominal.ToFloat64() > 0 {
+				rate = rate / nominal.ToFloat64()
+			}
+			history = append(history, ds.RatePoint{Time: candle.Timestamp, Rate: rate})
+		}
+		histories[iso] = history
+	}
+
+	return histories, nil
+}
+
+// GetExchangeRates returns current rub prices of currencies taken from last prices of currency instruments
+func (c *Client) GetExchangeRates(currencies ...string) (ds.ExchangeRates, error) {
+	instrs, err := c.currencyInstruments(currencies...)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := ds.ExchangeRates{}
+	if len(instrs) == 0 {
+		return rates, nil
+	}
+
+	uids := make([]string, 0, len(instrs))
+	byUid := make(map[string]*pb.Currency, len(instrs))
+	for _, instr := range instrs {
+		uids = append(uids, instr.GetUid())
+		byUid[instr.GetUid()] = instr
+	}
+
+	prices, err := Invoke(c, QuotaMarketData, func() (*investgo.GetLastPricesResponse, error) {
+		return c.NewMarketDataServiceClient().GetLastPrices(uids)
+	})
+	if err != nil {
+		return nil, makeErrorMessage(err, prices)
+	}
+
+	for _, lp := range prices.GetLastPrices() {
+		instr, ok := byUid[lp.GetInstrumentUid()]
+		if !ok {
+			continue
+		}
+
+		price, nominal := quotationFromPb(lp.GetPrice()), moneyFromPb(instr.GetNominal())
+		rate := price.ToFloat64()
+		// some currencies are quoted for their nominal like 100 units
+		if nominal.ToFloat64() > 0 {
+			rate = rate / nominal.ToFloat64()
+		}
+		rates[ds.NormalizeCurrency(instr.GetIsoCurrencyName())] = rate
+	}
+
+	for iso := range instrs {
+		if _, ok := rates[iso]; !ok {
+			return nil, fmt.Errorf("no last price of currency %s", iso)
+		}
+	}
+
+	return rates, nil
+}
+
+// currencyInstruments finds instruments of currencies traded in rubles.
+// Settlement 'tomorrow' instruments are preferred as the most liquid ones.
+func (c *Client) currencyInstruments(currencies ...string) (map[string]*pb.Currency, error) {
+	wanted := make(map[string]*pb.Currency)
+	for _, currency := range currencies {
+		if currency = ds.NormalizeCurrency(currency); currency != ds.CurrencyRub {
+			wanted[currency] = nil
+		}
+	}
+	if len(wanted) == 0 {
+		return wanted, nil
+	}
+
+	resp, err := Invoke(c, QuotaInstruments, func() (*investgo.CurrenciesResponse, error) {
+		return c.NewInstrumentsServiceClient().Currencies(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
+	if err != nil {
+		return nil, makeErrorMessage(err, resp)
+	}
+
+	for _, instr := range resp.GetInstruments() {
+		iso := ds.NormalizeCurrency(instr.GetIsoCurrencyName())
+		chosen, ok := wanted[iso]
+		if !ok || ds.NormalizeCurrency(instr.GetCurrency()) != ds.CurrencyRub {
+			continue
+		}
+		if chosen == nil || (!strings.HasSuffix(chosen.GetTicker(), "TOM") && strings.HasSuffix(instr.GetTicker(), "TOM")) {
+			wanted[iso] = instr
+		}
+	}
+
+	for iso, instr := range wanted {
+		if instr == nil {
+			return nil, fmt.Errorf("not found currency instrument for %s", iso)
+		}
+	}
+
+	return wanted, nil
+}
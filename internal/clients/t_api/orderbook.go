@@ -0,0 +1,136 @@
+package t_api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/supports"
+
+	pb "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+type OrderBookDepth int32
+
+func orderBookKey(instrInfo *ds.InstrumentInfo, depth int32) subscriptionKey {
+	return subscriptionKey{kind: orderBookSubscription, id: instrInfo.Uid, param: strconv.Itoa(int(depth))}
+}
+
+func (c *Client) RegisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error {
+	c.Lock()
+	defer c.Unlock()
+
+	instrUid := InstrumentUid(instrInfo.Uid)
+	instanceId := InstanceId(instrInfo.InstanceId)
+	obDepth := OrderBookDepth(depth)
+	key := orderBookKey(instrInfo, depth)
+
+	if c.subscriptions.acquire(key, instanceId) {
+		if err := c.subscribeMarketData(key); err != nil {
+			c.subscriptions.release(key, instanceId)
+			return err
+		}
+	}
+
+	if _, ok := c.orderBookInput[instrUid]; !ok {
+		c.orderBookInput[instrUid] = make(map[OrderBookDepth]map[InstanceId]chan *pb.OrderBook)
+	}
+	if _, ok := c.orderBookInput[instrUid][obDepth]; !ok {
+		c.orderBookInput[instrUid][obDepth] = make(map[InstanceId]chan *pb.OrderBook)
+	}
+	if _, ok := c.orderBookInput[instrUid][obDepth][instanceId]; !ok {
+		c.orderBookInput[instrUid][obDepth][instanceId] = make(chan *pb.OrderBook, 1)
+	}
+
+	return nil
+}
+
+func (c *Client) UnregisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error {
+	c.Lock()
+	defer c.Unlock()
+
+	instrUid := InstrumentUid(instrInfo.Uid)
+	instanceId := InstanceId(instrInfo.InstanceId)
+	obDepth := OrderBookDepth(depth)
+	key := orderBookKey(instrInfo, depth)
+
+	if _, ok := c.orderBookInput[instrUid][obDepth][instanceId]; ok {
+		supports.CloseIfMaybeClosed(c.orderBookInput[instrUid][obDepth][instanceId])
+	}
+
+	delete(c.orderBookInput[instrUid][obDepth], instanceId)
+
+	if len(c.orderBookInput[instrUid][obDepth]) == 0 {
+		delete(c.orderBookInput[instrUid], obDepth)
+	}
+	if len(c.orderBookInput[instrUid]) == 0 {
+		delete(c.orderBookInput, instrUid)
+	}
+
+	if c.subscriptions.release(key, instanceId) {
+		return c.unsubscribeMarketData(key)
+	}
+
+	return nil
+}
+
+func (c *Client) RecieveOrderBook(ctx context.Context, instrInfo *ds.InstrumentInfo, depth int32) (*ds.OrderBook, error) {
+	c.RLock()
+	ch := c.orderBookInput[InstrumentUid(instrInfo.Uid)][OrderBookDepth(depth)][InstanceId(instrInfo.InstanceId)]
+	c.RUnlock()
+
+	var ob *pb.OrderBook
+	var ok bool
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("recieving order book context done for %s", instrInfo.Ticker)
+	case ob, ok = <-ch:
+		if !ok {
+			return nil, fmt.Errorf("marketDataStream closed for %s", instrInfo.Ticker)
+		}
+	}
+
+	return &ds.OrderBook{
+		Figi:         ob.Figi,
+		Uid:          ob.InstrumentUid,
+		Depth:        ob.Depth,
+		IsConsistent: ob.IsConsistent,
+		Bids:         orderBookLevelsFromPb(ob.Bids),
+		Asks:         orderBookLevelsFromPb(ob.Asks),
+		Time:         ob.Time.AsTime(),
+	}, nil
+}
+
+func (c *Client) startOrderBookRouting(ch <-chan *pb.OrderBook) {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case v, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			c.Lock()
+			for _, uniqueListener := range c.orderBookInput[InstrumentUid(v.InstrumentUid)][OrderBookDepth(v.Depth)] {
+				if err := supports.SendOrSkipIfMaybeClosed(uniqueListener, v); err != nil {
+					c.Logger.Errorf("error on getting order book", ds.HistoryColError, err.Error())
+				}
+			}
+			c.Unlock()
+		}
+	}
+}
+
+func orderBookLevelsFromPb(orders []*pb.Order) []ds.OrderBookLevel {
+	levels := make([]ds.OrderBookLevel, 0, len(orders))
+	for _, v := range orders {
+		levels = append(levels, ds.OrderBookLevel{
+			Price:    quotationFromPb(v.Price),
+			Quantity: v.Quantity,
+		})
+	}
+
+	return levels
+}
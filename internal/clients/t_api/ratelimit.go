@@ -0,0 +1,229 @@
+package t_api
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/supports"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	quotaWindow = time.Minute
+
+	maxCallRetries   = 5
+	retryBaseDelay   = time.Millisecond * 500
+	retryMaxDelay    = time.Second * 30
+	rateLimitHeader  = "x-ratelimit-limit"
+	remainingHeader  = "x-ratelimit-remaining"
+	resetLimitHeader = "x-ratelimit-reset"
+)
+
+type QuotaGroup string
+
+const (
+	QuotaInstruments QuotaGroup = "instruments"
+	QuotaMarketData  QuotaGroup = "market_data"
+	QuotaOrders      QuotaGroup = "orders"
+	QuotaOperations  QuotaGroup = "operations"
+	QuotaUsers       QuotaGroup = "users"
+	QuotaSandbox     QuotaGroup = "sandbox"
+)
+
+// requests per minute for T-Invest services on the base tariff
+var defaultQuotas = map[QuotaGroup]int{
+	QuotaInstruments: 200,
+	QuotaMarketData:  600,
+	QuotaOrders:      100,
+	QuotaOperations:  200,
+	QuotaUsers:       100,
+	QuotaSandbox:     200,
+}
+
+type quotaBucket struct {
+	limit     int
+	remaining int
+	resetAt   time.Time
+}
+
+type RateLimiter struct {
+	sync.Mutex
+	buckets map[QuotaGroup]*quotaBucket
+}
+
+func NewRateLimiter(quotas map[QuotaGroup]int) *RateLimiter {
+	l := &RateLimiter{
+		buckets: make(map[QuotaGroup]*quotaBucket),
+	}
+
+	for group, limit := range quotas {
+		l.buckets[group] = &quotaBucket{limit: limit, remaining: limit}
+	}
+
+	return l
+}
+
+// Wait blocks until request in quota group is allowed
+func (l *RateLimiter) Wait(ctx context.Context, group QuotaGroup) error {
+	for {
+		delay, ok := l.take(group, time.Now())
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (l *RateLimiter) take(group QuotaGroup, now time.Time) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	b, ok := l.buckets[group]
+	if !ok {
+		return 0, true
+	}
+
+	if !now.Before(b.resetAt) {
+		b.remaining = b.limit
+		b.resetAt = now.Add(quotaWindow)
+	}
+
+	if b.remaining > 0 {
+		b.remaining--
+		return 0, true
+	}
+
+	return b.resetAt.Sub(now), false
+}
+
+// Update adjusts quota group with ratelimit headers of the server response
+func (l *RateLimiter) Update(group QuotaGroup, md metadata.MD) {
+	limit, hasLimit := headerInt(md, rateLimitHeader)
+	remaining, hasRemaining := headerInt(md, remainingHeader)
+	reset, hasReset := headerInt(md, resetLimitHeader)
+
+	if !hasLimit && !hasRemaining && !hasReset {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	b, ok := l.buckets[group]
+	if !ok {
+		if !hasLimit || limit <= 0 {
+			return
+		}
+		b = &quotaBucket{limit: limit, remaining: limit}
+		l.buckets[group] = b
+	}
+
+	if hasLimit && limit > 0 {
+		b.limit = limit
+	}
+	if hasRemaining && remaining < b.remaining {
+		b.remaining = remaining
+	}
+	if hasReset {
+		b.resetAt = time.Now().Add(time.Duration(reset) * time.Second)
+	}
+}
+
+func headerInt(md metadata.MD, key string) (int, bool) {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	// values may look like "200, 200;w=60"
+	v := strings.TrimSpace(strings.Split(values[0], ",")[0])
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func isRetryable(err error) bool {
+	code := status.Code(err)
+	return code == codes.ResourceExhausted || code == codes.Unavailable
+}
+
+func retryDelay(attempt int, md metadata.MD) time.Duration {
+	if reset, ok := headerInt(md, resetLimitHeader); ok && reset > 0 {
+		return time.Duration(reset) * time.Second
+	}
+
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// headerOf returns header of response, failed calls may return nil response
+func headerOf(resp any) metadata.MD {
+	h, ok := resp.(IGetterHeader)
+	if !ok {
+		return nil
+	}
+
+	if v := reflect.ValueOf(h); v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+
+	return h.GetHeader()
+}
+
+// Invoke makes unary call in quota group limits and retries it with backoff
+// on ResourceExhausted and Unavailable errors. The call must be idempotent,
+// orders are retried with the same order id
+func Invoke[T any](c *Client, group QuotaGroup, call func() (T, error)) (resp T, err error) {
+	for attempt := 0; ; attempt++ {
+		if err = c.limiter.Wait(c.ctx, group); err != nil {
+			return
+		}
+
+		resp, err = call()
+
+		md := headerOf(resp)
+		c.limiter.Update(group, md)
+
+		if err == nil || attempt >= maxCallRetries || !isRetryable(err) {
+			return
+		}
+
+		delay := retryDelay(attempt, md)
+		c.Logger.Infof("Retry unary call, sleep", ds.HistoryColError, err.Error(), ds.HistoryColSeconds, delay.Seconds())
+		supports.WaitFor(c.ctx, delay)
+	}
+}
+
+// InvokeOnce makes unary call in quota group limits without retries,
+// it is used for calls which are not idempotent
+func InvokeOnce[T any](c *Client, group QuotaGroup, call func() (T, error)) (resp T, err error) {
+	if err = c.limiter.Wait(c.ctx, group); err != nil {
+		return
+	}
+
+	resp, err = call()
+	c.limiter.Update(group, headerOf(resp))
+
+	return
+}
@@ -0,0 +1,159 @@
+package t_api
+
+import (
+	"time"
+
+	"trading_bot/internal/calendar"
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	pb "github.com/russianinvestments/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	tradingStatusTTL     = time.Minute
+	calendarRefreshDelay = time.Minute
+)
+
+type calendarLogger struct {
+	l investgo.Logger
+}
+
+func (cl *calendarLogger) ErrorfKV(message string, argsKV ...any) {
+	cl.l.Errorf(message, argsKV...)
+}
+
+// tradingCalendar starts calendar refreshing on the first availability request,
+// so clients which never trade do not spend quota on schedules
+func (c *Client) tradingCalendar() *calendar.Calendar {
+	c.calendarOnce.Do(func() {
+		go c.calendar.Run(c.ctx, calendarRefreshDelay)
+	})
+
+	return c.calendar
+}
+
+func (c *Client) GetTradingAvailability(instrInfo *ds.InstrumentInfo) (ds.TradingAvailability, error) {
+	availability, _, err := c.tradingCalendar().GetTradingAvailability(instrInfo, time.Now())
+	return availability, err
+}
+
+func (c *Client) GetTradingSession(instrInfo *ds.InstrumentInfo) (ds.TradingSession, error) {
+	_, session, err := c.tradingCalendar().GetTradingAvailability(instrInfo, time.Now())
+	return session, err
+}
+
+// GetTradingStatus requests current status, moment is ignored as only current status is available
+func (c *Client) GetTradingStatus(instrInfo *ds.InstrumentInfo, _ time.Time) (*ds.TradingStatus, error) {
+	status, err := Invoke(c, QuotaMarketData, func() (*investgo.GetTradingStatusResponse, error) {
+		return c.NewMarketDataServiceClient().GetTradingStatus(instrInfo.Uid)
+	})
+	if err != nil {
+		return nil, makeErrorMessage(err, status)
+	}
+
+	return &ds.TradingStatus{
+		ApiAvailable: status.ApiTradeAvailableFlag,
+		Session:      resolveTradingSession(status.TradingStatus),
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+func (c *Client) GetTradingSchedules(exchange string, from, to time.Time) ([]*ds.TradingDay, error) {
+	resp, err := Invoke(c, QuotaInstruments, func() (*investgo.TradingSchedulesResponse, error) {
+		return c.NewInstrumentsServiceClient().TradingSchedules(exchange, from, to)
+	})
+	if err != nil {
+		return nil, makeErrorMessage(err, resp)
+	}
+
+	var days []*ds.TradingDay
+	for _, schedule := range resp.Exchanges {
+		for _, d := range schedule.Days {
+			days = append(days, resolveTradingDay(schedule.Exchange, d))
+		}
+	}
+
+	return days, nil
+}
+
+func resolveTradingDay(exchange string, d *pb.TradingDay) *ds.TradingDay {
+	day := &ds.TradingDay{
+		Exchange:     exchange,
+		Date:         d.Date.AsTime(),
+		IsTradingDay: d.IsTradingDay,
+	}
+
+	weekday := day.Date.Weekday()
+	isWeekend := weekday == time.Saturday || weekday == time.Sunday
+
+	main, evening := ds.SessionMain, ds.SessionEvening
+	if isWeekend {
+		main, evening = ds.SessionWeekend, ds.SessionWeekend
+	}
+
+	mainEnd := d.EndTime
+	if d.ClosingAuctionStartTime != nil {
+		mainEnd = d.ClosingAuctionStartTime
+	}
+
+	// breaks go first because they are inside of main session
+	day.Sessions = appendSession(day.Sessions, ds.SessionBreak, d.ClearingStartTime, d.ClearingEndTime)
+	day.Sessions = appendSession(day.Sessions, ds.SessionOpeningAuction, d.OpeningAuctionStartTime, d.OpeningAuctionEndTime)
+	day.Sessions = appendSession(day.Sessions, main, d.StartTime, mainEnd)
+	day.Sessions = appendSession(day.Sessions, ds.SessionClosingAuction, d.ClosingAuctionStartTime, d.ClosingAuctionEndTime)
+	day.Sessions = appendSession(day.Sessions, ds.SessionOpeningAuction, d.EveningOpeningAuctionStartTime, d.EveningStartTime)
+	day.Sessions = appendSession(day.Sessions, evening, d.EveningStartTime, d.EveningEndTime)
+
+	return day
+}
+
+func appendSession(sessions []ds.SessionInterval, session ds.TradingSession, start, end *timestamppb.Timestamp) []ds.SessionInterval {
+	if start == nil || end == nil {
+		return sessions
+	}
+
+	s, e := start.AsTime(), end.AsTime()
+	if s.Unix() <= 0 || !e.After(s) {
+		return sessions
+	}
+
+	return append(sessions, ds.SessionInterval{Session: session, Start: s, End: e})
+}
+
+func resolveTradingSession(status pb.SecurityTradingStatus) ds.TradingSession {
+	switch status {
+	case pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING,
+		pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DEALER_NORMAL_TRADING:
+		return ds.SessionMain
+	case pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_OPENING_AUCTION_PERIOD,
+		pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_OPENING_PERIOD:
+		return ds.SessionOpeningAuction
+	case pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_CLOSING_AUCTION,
+		pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_CLOSING_PERIOD,
+		pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_TRADING_AT_CLOSING_AUCTION_PRICE:
+		return ds.SessionClosingAuction
+	case pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_BREAK_IN_TRADING,
+		pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DEALER_BREAK_IN_TRADING,
+		pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DISCRETE_AUCTION:
+		return ds.SessionBreak
+	}
+
+	return ds.SessionClosed
+}
+
+// fillInstrumentDetails sets exchange and currency which short instrument info lacks
+func (c *Client) fillInstrumentDetails(instrInfo *ds.InstrumentInfo) {
+	resp, err := Invoke(c, QuotaInstruments, func() (*investgo.InstrumentResponse, error) {
+		return c.NewInstrumentsServiceClient().InstrumentByUid(instrInfo.Uid)
+	})
+	if err != nil {
+		c.Logger.Errorf("failed getting instrument details", ds.HistoryColInstrumentUID, instrInfo.Uid,
+			ds.HistoryColError, makeErrorMessage(err, resp).Error())
+		return
+	}
+
+	instrInfo.Exchange = resp.GetInstrument().GetExchange()
+	instrInfo.Currency = ds.NormalizeCurrency(resp.GetInstrument().GetCurrency())
+}
@@ -0,0 +1,306 @@
+package t_api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/supports"
+
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+)
+
+const (
+	// T-Invest API limits for one token
+	maxSubscriptionsPerStream = 300
+	maxMarketDataStreams      = 16
+)
+
+type StreamPoolStats struct {
+	Streams                   int
+	MaxStreams                int
+	Subscriptions             int
+	SubscriptionsPerStream    []int
+	MaxSubscriptionsPerStream int
+}
+
+func (s StreamPoolStats) Utilisation() float64 {
+	capacity := s.MaxStreams * s.MaxSubscriptionsPerStream
+	if capacity == 0 {
+		return 0
+	}
+
+	return float64(s.Subscriptions) / float64(capacity)
+}
+
+type marketDataShard struct {
+	stream        *investgo.MarketDataStream
+	subscriptions map[subscriptionKey]struct{}
+	routed        map[subscriptionKind]bool
+	cancel        func()
+}
+
+func (s *marketDataShard) stop() {
+	s.cancel()
+	s.stream.Stop()
+}
+
+type marketDataPool struct {
+	shards                    []*marketDataShard
+	placement                 map[subscriptionKey]*marketDataShard
+	maxStreams                int
+	maxSubscriptionsPerStream int
+}
+
+func newMarketDataPool(maxStreams, maxSubscriptionsPerStream int) *marketDataPool {
+	return &marketDataPool{
+		placement:                 make(map[subscriptionKey]*marketDataShard),
+		maxStreams:                maxStreams,
+		maxSubscriptionsPerStream: maxSubscriptionsPerStream,
+	}
+}
+
+func (p *marketDataPool) leastLoaded(except *marketDataShard) *marketDataShard {
+	var shard *marketDataShard
+	for _, s := range p.shards {
+		if s == except || len(s.subscriptions) >= p.maxSubscriptionsPerStream {
+			continue
+		}
+		if shard == nil || len(s.subscriptions) < len(shard.subscriptions) {
+			shard = s
+		}
+	}
+
+	return shard
+}
+
+func (p *marketDataPool) subscriptionsAmount() int {
+	return len(p.placement)
+}
+
+func (p *marketDataPool) removeShard(shard *marketDataShard) {
+	for i, s := range p.shards {
+		if s == shard {
+			p.shards = append(p.shards[:i], p.shards[i+1:]...)
+			break
+		}
+	}
+	shard.stop()
+}
+
+// GetMarketDataPoolStats returns utilisation of market data streams pool
+func (c *Client) GetMarketDataPoolStats() StreamPoolStats {
+	c.RLock()
+	defer c.RUnlock()
+
+	stats := StreamPoolStats{
+		Streams:                   len(c.marketData.shards),
+		MaxStreams:                c.marketData.maxStreams,
+		Subscriptions:             c.marketData.subscriptionsAmount(),
+		SubscriptionsPerStream:    make([]int, 0, len(c.marketData.shards)),
+		MaxSubscriptionsPerStream: c.marketData.maxSubscriptionsPerStream,
+	}
+
+	for _, s := range c.marketData.shards {
+		stats.SubscriptionsPerStream = append(stats.SubscriptionsPerStream, len(s.subscriptions))
+	}
+
+	return stats
+}
+
+// subscribeMarketData places subscription on the least loaded stream and opens
+// new stream when all of them are full. Must be called under client lock.
+func (c *Client) subscribeMarketData(key subscriptionKey) error {
+	if _, ok := c.marketData.placement[key]; ok {
+		return nil
+	}
+
+	shard := c.marketData.leastLoaded(nil)
+	if shard == nil {
+		if len(c.marketData.shards) >= c.marketData.maxStreams {
+			return fmt.Errorf("market data streams pool is exhausted: %d streams with %d subscriptions",
+				len(c.marketData.shards), c.marketData.subscriptionsAmount())
+		}
+
+		var err error
+		shard, err = c.newMarketDataShard()
+		if err != nil {
+			return err
+		}
+		c.marketData.shards = append(c.marketData.shards, shard)
+	}
+
+	if err := c.subscribeOnShard(shard, key); err != nil {
+		if len(shard.subscriptions) == 0 {
+			c.marketData.removeShard(shard)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// unsubscribeMarketData drops subscription and rebalances pool to use as few
+// streams as possible. Must be called under client lock.
+func (c *Client) unsubscribeMarketData(key subscriptionKey) error {
+	shard, ok := c.marketData.placement[key]
+	if !ok {
+		return nil
+	}
+
+	err := c.unsubscribeOnShard(shard, key)
+
+	c.rebalanceMarketData()
+
+	return err
+}
+
+func (c *Client) rebalanceMarketData() {
+	pool := c.marketData
+
+	for _, s := range pool.shards {
+		if len(s.subscriptions) == 0 {
+			pool.removeShard(s)
+			c.rebalanceMarketData()
+			return
+		}
+	}
+
+	for len(pool.shards) > 1 && pool.subscriptionsAmount() <= (len(pool.shards)-1)*pool.maxSubscriptionsPerStream {
+		source := pool.shards[0]
+		for _, s := range pool.shards {
+			if len(s.subscriptions) < len(source.subscriptions) {
+				source = s
+			}
+		}
+
+		for key := range source.subscriptions {
+			target := pool.leastLoaded(source)
+			if target == nil {
+				return
+			}
+
+			if err := c.subscribeOnShard(target, key); err != nil {
+				c.Logger.Errorf("failed moving subscription between streams",
+					ds.HistoryColInstrumentUID, key.id, ds.HistoryColError, err.Error())
+				return
+			}
+
+			if err := c.unsubscribeOnShard(source, key); err != nil {
+				c.Logger.Errorf("failed unsubscribing moved subscription",
+					ds.HistoryColInstrumentUID, key.id, ds.HistoryColError, err.Error())
+			}
+		}
+
+		pool.removeShard(source)
+	}
+}
+
+func (c *Client) newMarketDataShard() (*marketDataShard, error) {
+	stream, err := c.NewMarketDataStreamClient().MarketDataStream()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	shard := &marketDataShard{
+		stream:        stream,
+		subscriptions: make(map[subscriptionKey]struct{}),
+		routed:        make(map[subscriptionKind]bool),
+		cancel:        cancel,
+	}
+
+	go c.startListeningShard(ctx, shard)
+
+	return shard, nil
+}
+
+func (c *Client) subscribeOnShard(shard *marketDataShard, key subscriptionKey) error {
+	switch key.kind {
+	case lastPriceSubscription:
+		ch, err := shard.stream.SubscribeLastPrice([]string{key.id})
+		if err != nil {
+			return err
+		}
+		if !shard.routed[key.kind] {
+			go c.startLastPriceRouting(ch)
+		}
+	case candleSubscription:
+		interval, ok := ds.CandleIntervalFromString(key.param)
+		if !ok {
+			return fmt.Errorf("unsupported candles interval: %s", key.param)
+		}
+		// waiting close makes server send only closed candles
+		ch, err := shard.stream.SubscribeCandle([]string{key.id}, subscriptionIntervalMap[interval], true, nil)
+		if err != nil {
+			return err
+		}
+		if !shard.routed[key.kind] {
+			go c.startCandleRouting(ch)
+		}
+	case orderBookSubscription:
+		depth, err := strconv.Atoi(key.param)
+		if err != nil {
+			return err
+		}
+		ch, err := shard.stream.SubscribeOrderBook([]string{key.id}, int32(depth))
+		if err != nil {
+			return err
+		}
+		if !shard.routed[key.kind] {
+			go c.startOrderBookRouting(ch)
+		}
+	default:
+		return fmt.Errorf("unsupported market data subscription: %d", key.kind)
+	}
+
+	shard.routed[key.kind] = true
+	shard.subscriptions[key] = struct{}{}
+	c.marketData.placement[key] = shard
+
+	return nil
+}
+
+func (c *Client) unsubscribeOnShard(shard *marketDataShard, key subscriptionKey) error {
+	delete(shard.subscriptions, key)
+	if c.marketData.placement[key] == shard {
+		delete(c.marketData.placement, key)
+	}
+
+	switch key.kind {
+	case lastPriceSubscription:
+		return shard.stream.UnSubscribeLastPrice([]string{key.id})
+	case candleSubscription:
+		interval, ok := ds.CandleIntervalFromString(key.param)
+		if !ok {
+			return fmt.Errorf("unsupported candles interval: %s", key.param)
+		}
+		return shard.stream.UnSubscribeCandle([]string{key.id}, subscriptionIntervalMap[interval], true, nil)
+	case orderBookSubscription:
+		depth, err := strconv.Atoi(key.param)
+		if err != nil {
+			return err
+		}
+		return shard.stream.UnSubscribeOrderBook([]string{key.id}, int32(depth))
+	}
+
+	return fmt.Errorf("unsupported market data subscription: %d", key.kind)
+}
+
+func (c *Client) startListeningShard(ctx context.Context, shard *marketDataShard) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if err := shard.stream.Listen(); err != nil {
+				c.Logger.Errorf("failed listening market data stream", ds.HistoryColError, err.Error())
+
+				c.Logger.Infof("Sleep", ds.HistoryColSeconds, onErrorListeningStreamDelay.Seconds())
+				supports.WaitFor(ctx, onErrorListeningStreamDelay)
+			}
+		}
+	}
+}
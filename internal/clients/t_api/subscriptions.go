@@ -0,0 +1,75 @@
+package t_api
+
+import "sync"
+
+type subscriptionKind int8
+
+const (
+	lastPriceSubscription subscriptionKind = iota
+	candleSubscription
+	orderBookSubscription
+	orderStateSubscription
+)
+
+// subscriptionKey identifies one stream subscription. Param keeps subscription
+// specific options like candle interval or order book depth.
+type subscriptionKey struct {
+	kind  subscriptionKind
+	id    string
+	param string
+}
+
+// subscriptionsCounter counts listeners of every subscription, so the stream
+// subscription is made by the first listener and dropped by the last one.
+type subscriptionsCounter struct {
+	sync.Mutex
+	refs map[subscriptionKey]map[InstanceId]struct{}
+}
+
+func newSubscriptionsCounter() *subscriptionsCounter {
+	return &subscriptionsCounter{
+		refs: make(map[subscriptionKey]map[InstanceId]struct{}),
+	}
+}
+
+// acquire registers listener and reports whether it is the first one for the key.
+func (sc *subscriptionsCounter) acquire(key subscriptionKey, instanceId InstanceId) (first bool) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	listeners, ok := sc.refs[key]
+	if !ok {
+		listeners = make(map[InstanceId]struct{})
+		sc.refs[key] = listeners
+	}
+
+	first = len(listeners) == 0
+	listeners[instanceId] = struct{}{}
+
+	return first
+}
+
+// release removes listener and reports whether it was the last one for the key.
+// Releasing of unknown listener is not the last one.
+func (sc *subscriptionsCounter) release(key subscriptionKey, instanceId InstanceId) (last bool) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	listeners, ok := sc.refs[key]
+	if !ok {
+		return false
+	}
+
+	if _, ok := listeners[instanceId]; !ok {
+		return false
+	}
+
+	delete(listeners, instanceId)
+	if len(listeners) > 0 {
+		return false
+	}
+
+	delete(sc.refs, key)
+
+	return true
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"trading_bot/internal/calendar"
 	ds "trading_bot/internal/service/datastruct"
 	"trading_bot/internal/supports"
 
@@ -59,11 +62,19 @@ type Client struct {
 	sync.RWMutex
 	investgo.Client
 
-	marketDataStream *investgo.MarketDataStream
+	marketData       *marketDataPool
 	ordersDataStream *investgo.OrderStateStream
 	lastPriceInput   map[InstrumentUid]map[InstanceId]chan *pb.LastPrice
+	orderBookInput   map[InstrumentUid]map[OrderBookDepth]map[InstanceId]chan *pb.OrderBook
+	candleInput      map[InstrumentUid]map[ds.CandleInterval]map[InstanceId]chan *pb.Candle
 	ordersStateInput map[AccountId]map[InstrumentUid]map[InstanceId]chan *pb.OrderStateStreamResponse_OrderState
+	subscriptions    *subscriptionsCounter
+	limiter          *RateLimiter
+	calendar         *calendar.Calendar
+	calendarOnce     sync.Once
 	ctx              context.Context
+	asyncOrders      bool
+	instrumentLookup *ds.InstrumentLookup
 }
 
 func NewClient(ctx context.Context, conf investgo.Config, l investgo.Logger) (*Client, error) {
@@ -76,77 +87,201 @@ func NewClient(ctx context.Context, conf investgo.Config, l investgo.Logger) (*C
 		Client:           *investClient,
 		ctx:              ctx,
 		lastPriceInput:   make(map[InstrumentUid]map[InstanceId]chan *pb.LastPrice),
+		orderBookInput:   make(map[InstrumentUid]map[OrderBookDepth]map[InstanceId]chan *pb.OrderBook),
+		candleInput:      make(map[InstrumentUid]map[ds.CandleInterval]map[InstanceId]chan *pb.Candle),
 		ordersStateInput: make(map[AccountId]map[InstrumentUid]map[InstanceId]chan *pb.OrderStateStreamResponse_OrderState),
+		subscriptions:    newSubscriptionsCounter(),
+		marketData:       newMarketDataPool(maxMarketDataStreams, maxSubscriptionsPerStream),
+		limiter:          NewRateLimiter(defaultQuotas),
+		instrumentLookup: &ds.InstrumentLookup{},
 	}
 
+	c.calendar = calendar.NewCalendar(c, &calendarLogger{l: l}, tradingStatusTTL)
+
 	return c, nil
 }
 
+// FindInstrument looks for instrument by uid, figi, isin, ticker or 'TICKER@CLASS_CODE'.
+// Ambiguous ticker not resolved by lookup preferences is an error.
 func (c *Client) FindInstrument(identifier string) (*ds.InstrumentInfo, error) {
-	instrs, err := c.NewInstrumentsServiceClient().FindInstrument(identifier)
+	query, _ := ds.ParseInstrumentIdentifier(identifier)
+	instrs, err := Invoke(c, QuotaInstruments, func() (*investgo.FindInstrumentResponse, error) {
+		return c.NewInstrumentsServiceClient().FindInstrument(query)
+	})
 	if err != nil {
-		return nil, err
+		return nil, makeErrorMessage(err, instrs)
 	}
 
-	var instr *pb.InstrumentShort
+	found := make([]*ds.InstrumentInfo, 0, len(instrs.Instruments))
 	for _, v := range instrs.Instruments {
-		if v.Uid == identifier || v.Figi == identifier || v.Ticker == identifier || v.Isin == identifier {
-			instr = v
-			break
+		found = append(found, &ds.InstrumentInfo{
+			Isin:            v.Isin,
+			Figi:            v.Figi,
+			Ticker:          v.Ticker,
+			ClassCode:       v.ClassCode,
+			Name:            v.Name,
+			Uid:             v.Uid,
+			Lot:             v.Lot,
+			AvailableApi:    v.ApiTradeAvailableFlag,
+			ForQuals:        v.ForQualInvestorFlag,
+			Type:            v.InstrumentType,
+			FirstCandleDate: v.First_1MinCandleDate.AsTime(),
+		})
+	}
+
+	c.RLock()
+	lookup := c.instrumentLookup
+	c.RUnlock()
+
+	instrInfo, err := lookup.Select(identifier, found)
+	if err != nil {
+		return nil, err
+	}
+	c.fillInstrumentDetails(instrInfo)
+
+	if instrInfo.IsFutures() {
+		if err := c.fillFuturesInfo(instrInfo); err != nil {
+			return nil, err
 		}
 	}
-	if instr == nil {
-		return nil, fmt.Errorf("not found instrument '%s'", identifier)
-	}
-
-	return &ds.InstrumentInfo{
-		Isin:            instr.Isin,
-		Figi:            instr.Figi,
-		Ticker:          instr.Ticker,
-		ClassCode:       instr.ClassCode,
-		Name:            instr.Name,
-		Uid:             instr.Uid,
-		Lot:             instr.Lot,
-		AvailableApi:    instr.ApiTradeAvailableFlag,
-		ForQuals:        instr.ForQualInvestorFlag,
-		FirstCandleDate: instr.First_1MinCandleDate.AsTime(),
-	}, nil
+	if instrInfo.IsBond() {
+		if err := c.fillBondInfo(instrInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	return instrInfo, nil
 }
 
-func (c *Client) GetTradingAvailability(instrInfo *ds.InstrumentInfo) (ds.TradingAvailability, error) {
-	status, err := c.NewMarketDataServiceClient().GetTradingStatus(instrInfo.Uid)
+// FindFutures returns all contracts of basic asset like 'SBER' or 'IMOEX'
+func (c *Client) FindFutures(basicAsset string) ([]*ds.InstrumentInfo, error) {
+	resp, err := Invoke(c, QuotaInstruments, func() (*investgo.FuturesResponse, error) {
+		return c.NewInstrumentsServiceClient().Futures(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
-		return ds.Undefined, err
+		return nil, makeErrorMessage(err, resp)
 	}
 
-	if !status.ApiTradeAvailableFlag {
-		return ds.NotAvailableViaAPI, nil
+	var contracts []*ds.InstrumentInfo
+	for _, v := range resp.GetInstruments() {
+		if !strings.EqualFold(v.GetBasicAsset(), basicAsset) {
+			continue
+		}
+
+		expiration := v.GetExpirationDate().AsTime()
+		contracts = append(contracts, &ds.InstrumentInfo{
+			Figi:                v.GetFigi(),
+			Ticker:              v.GetTicker(),
+			ClassCode:           v.GetClassCode(),
+			Name:                v.GetName(),
+			Uid:                 v.GetUid(),
+			Lot:                 v.GetLot(),
+			AvailableApi:        v.GetApiTradeAvailableFlag(),
+			ForQuals:            v.GetForQualInvestorFlag(),
+			Type:                ds.InstrumentTypeFutures,
+			BasicAsset:          v.GetBasicAsset(),
+			MinPriceIncrement:   quotationFromPb(v.GetMinPriceIncrement()),
+			InitialMarginOnBuy:  moneyFromPb(v.GetInitialMarginOnBuy()),
+			InitialMarginOnSell: moneyFromPb(v.GetInitialMarginOnSell()),
+			ExpirationDate:      &expiration,
+			FirstCandleDate:     v.GetFirst_1MinCandleDate().AsTime(),
+		})
+	}
+
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("not found futures of '%s'", basicAsset)
+	}
+
+	return contracts, nil
+}
+
+// fillBondInfo adds nominal, accrued interest, maturity and all coupons to bond
+func (c *Client) fillBondInfo(instrInfo *ds.InstrumentInfo) error {
+	bond, err := Invoke(c, QuotaInstruments, func() (*investgo.BondResponse, error) {
+		return c.NewInstrumentsServiceClient().BondByUid(instrInfo.Uid)
+	})
+	if err != nil {
+		return makeErrorMessage(err, bond)
 	}
 
-	if status.TradingStatus != pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING {
-		return ds.NotAvailableNow, nil
+	maturity := bond.GetInstrument().GetMaturityDate().AsTime()
+	instrInfo.MaturityDate = &maturity
+	instrInfo.Nominal = moneyFromPb(bond.GetInstrument().GetNominal())
+	instrInfo.AciValue = moneyFromPb(bond.GetInstrument().GetAciValue())
+
+	from := bond.GetInstrument().GetPlacementDate().AsTime()
+	coupons, err := Invoke(c, QuotaInstruments, func() (*investgo.GetBondCouponsResponse, error) {
+		return c.NewInstrumentsServiceClient().GetBondCoupons(instrInfo.Figi, from, maturity)
+	})
+	if err != nil {
+		return makeErrorMessage(err, coupons)
 	}
 
-	return ds.Available, nil
+	instrInfo.Coupons = make([]*ds.Coupon, 0, len(coupons.GetEvents()))
+	for _, v := range coupons.GetEvents() {
+		instrInfo.Coupons = append(instrInfo.Coupons, &ds.Coupon{
+			Date:      v.GetCouponDate().AsTime(),
+			StartDate: v.GetCouponStartDate().AsTime(),
+			EndDate:   v.GetCouponEndDate().AsTime(),
+			Amount:    moneyFromPb(v.GetPayOneBond()),
+		})
+	}
+	slices.SortFunc(instrInfo.Coupons, func(a, b *ds.Coupon) int {
+		return a.Date.Compare(b.Date)
+	})
+
+	return nil
 }
 
-func (c *Client) RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
-	if c.marketDataStream == nil {
-		if err := c.prepareStreamForInstrument(instrInfo); err != nil {
-			return err
-		}
-	} else {
-		_, err := c.marketDataStream.SubscribeLastPrice([]string{instrInfo.Uid})
-		if err != nil {
-			return err
-		}
+// fillFuturesInfo adds expiration, margin and cost of price step to futures contract
+func (c *Client) fillFuturesInfo(instrInfo *ds.InstrumentInfo) error {
+	future, err := Invoke(c, QuotaInstruments, func() (*investgo.FutureResponse, error) {
+		return c.NewInstrumentsServiceClient().FutureByUid(instrInfo.Uid)
+	})
+	if err != nil {
+		return makeErrorMessage(err, future)
 	}
 
+	margin, err := Invoke(c, QuotaInstruments, func() (*investgo.GetFuturesMarginResponse, error) {
+		return c.NewInstrumentsServiceClient().GetFuturesMargin(instrInfo.Figi)
+	})
+	if err != nil {
+		return makeErrorMessage(err, margin)
+	}
+
+	expiration := future.GetInstrument().GetExpirationDate().AsTime()
+	instrInfo.ExpirationDate = &expiration
+	instrInfo.BasicAsset = future.GetInstrument().GetBasicAsset()
+	instrInfo.MinPriceIncrement = quotationFromPb(margin.GetMinPriceIncrement())
+	instrInfo.MinPriceIncrementAmount = quotationFromPb(margin.GetMinPriceIncrementAmount())
+	instrInfo.InitialMarginOnBuy = moneyFromPb(margin.GetInitialMarginOnBuy())
+	instrInfo.InitialMarginOnSell = moneyFromPb(margin.GetInitialMarginOnSell())
+
+	return nil
+}
+
+// SetInstrumentLookup sets class codes preference and instrument types used to resolve ambiguous tickers
+func (c *Client) SetInstrumentLookup(lookup *ds.InstrumentLookup) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.instrumentLookup = lookup
+}
+
+func (c *Client) RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
 	c.Lock()
 	defer c.Unlock()
 
 	instrUid := InstrumentUid(instrInfo.Uid)
 	instanceId := InstanceId(instrInfo.InstanceId)
+	key := subscriptionKey{kind: lastPriceSubscription, id: instrInfo.Uid}
+
+	if c.subscriptions.acquire(key, instanceId) {
+		if err := c.subscribeMarketData(key); err != nil {
+			c.subscriptions.release(key, instanceId)
+			return err
+		}
+	}
 
 	if _, ok := c.lastPriceInput[instrUid]; !ok {
 		c.lastPriceInput[instrUid] = make(map[InstanceId]chan *pb.LastPrice)
@@ -159,16 +294,12 @@ func (c *Client) RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error
 }
 
 func (c *Client) UnregisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
-	err := c.marketDataStream.UnSubscribeLastPrice([]string{instrInfo.Uid})
-	if err != nil {
-		return err
-	}
-
 	c.Lock()
 	defer c.Unlock()
 
 	instrUid := InstrumentUid(instrInfo.Uid)
 	instanceId := InstanceId(instrInfo.InstanceId)
+	key := subscriptionKey{kind: lastPriceSubscription, id: instrInfo.Uid}
 
 	if _, ok := c.lastPriceInput[instrUid][instanceId]; ok {
 		supports.CloseIfMaybeClosed(c.lastPriceInput[instrUid][instanceId])
@@ -176,7 +307,13 @@ func (c *Client) UnregisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) erro
 
 	delete(c.lastPriceInput[instrUid], instanceId)
 
-	delete(c.lastPriceInput, instrUid)
+	if len(c.lastPriceInput[instrUid]) == 0 {
+		delete(c.lastPriceInput, instrUid)
+	}
+
+	if c.subscriptions.release(key, instanceId) {
+		return c.unsubscribeMarketData(key)
+	}
 
 	return nil
 }
@@ -211,25 +348,6 @@ func (c *Client) RecieveLastPrice(ctx context.Context, instrInfo *ds.InstrumentI
 
 }
 
-func (c *Client) prepareStreamForInstrument(instrInfo *ds.InstrumentInfo) error {
-	stream, err := c.NewMarketDataStreamClient().MarketDataStream()
-	if err != nil {
-		return err
-	}
-	c.marketDataStream = stream
-
-	ch, err := c.marketDataStream.SubscribeLastPrice([]string{instrInfo.Uid})
-	if err != nil {
-		return err
-	}
-
-	go c.startLastPriceRouting(ch)
-
-	go c.startListeningStream(instrInfo.Uid, c.marketDataStream)
-
-	return nil
-}
-
 func (c *Client) startLastPriceRouting(ch <-chan *pb.LastPrice) {
 	for {
 		select {
@@ -257,6 +375,7 @@ func (c *Client) startListeningStream(uid string, s IStream) {
 		select {
 		case <-c.ctx.Done():
 			s.Stop()
+			return
 		default:
 			if err := s.Listen(); err != nil {
 				c.Logger.Errorf("failed starting stream listening",
@@ -270,9 +389,11 @@ func (c *Client) startListeningStream(uid string, s IStream) {
 }
 
 func (c *Client) GetInstrumentInfo(uid string) (*ds.InstrumentInfo, error) {
-	respInfo, err := c.NewInstrumentsServiceClient().FindInstrument(uid)
+	respInfo, err := Invoke(c, QuotaInstruments, func() (*investgo.FindInstrumentResponse, error) {
+		return c.NewInstrumentsServiceClient().FindInstrument(uid)
+	})
 	if err != nil {
-		return nil, err
+		return nil, makeErrorMessage(err, respInfo)
 	}
 
 	var instrumentInfo *pb.InstrumentShort
@@ -286,7 +407,7 @@ func (c *Client) GetInstrumentInfo(uid string) (*ds.InstrumentInfo, error) {
 		return nil, fmt.Errorf("not found instrument '%s'", uid)
 	}
 
-	return &ds.InstrumentInfo{
+	instrInfo := &ds.InstrumentInfo{
 		Isin:         instrumentInfo.Isin,
 		Figi:         instrumentInfo.Figi,
 		Ticker:       instrumentInfo.Ticker,
@@ -296,21 +417,51 @@ func (c *Client) GetInstrumentInfo(uid string) (*ds.InstrumentInfo, error) {
 		AvailableApi: instrumentInfo.ApiTradeAvailableFlag,
 		ForQuals:     instrumentInfo.ForQualInvestorFlag,
 		Lot:          instrumentInfo.Lot,
-	}, nil
+	}
+	c.fillInstrumentDetails(instrInfo)
+
+	return instrInfo, nil
 }
 
 func (c *Client) MakeSellOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	return c.postOrder(instrInfo, pb.OrderDirection_ORDER_DIRECTION_SELL, lots, requestId, accountId)
+}
+
+func (c *Client) MakeBuyOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	return c.postOrder(instrInfo, pb.OrderDirection_ORDER_DIRECTION_BUY, lots, requestId, accountId)
+}
+
+// SetAsyncOrders makes orders be only accepted by exchange without waiting for execution.
+// Results of such orders come through order state stream.
+func (c *Client) SetAsyncOrders(async bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.asyncOrders = async
+}
+
+func (c *Client) postOrder(instrInfo *ds.InstrumentInfo, direction pb.OrderDirection, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
 	if lots < 1 {
 		return nil, fmt.Errorf("incorrect lots to make order: %d", lots)
 	}
 
-	orderResp, err := c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
-		InstrumentId: instrInfo.Uid,
-		Quantity:     lots,
-		Direction:    pb.OrderDirection_ORDER_DIRECTION_SELL,
-		AccountId:    accountId,
-		OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
-		OrderId:      requestId,
+	c.RLock()
+	async := c.asyncOrders
+	c.RUnlock()
+
+	if async {
+		return c.postOrderAsync(instrInfo, direction, lots, requestId, accountId)
+	}
+
+	orderResp, err := Invoke(c, QuotaOrders, func() (*investgo.PostOrderResponse, error) {
+		return c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
+			InstrumentId: instrInfo.Uid,
+			Quantity:     lots,
+			Direction:    direction,
+			AccountId:    accountId,
+			OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
+			OrderId:      requestId,
+		})
 	})
 	if err != nil {
 		return nil, makeErrorMessage(err, orderResp)
@@ -331,63 +482,52 @@ func (c *Client) MakeSellOrder(instrInfo *ds.InstrumentInfo, lots int64, request
 	}, nil
 }
 
-func (c *Client) MakeBuyOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
-	if lots < 1 {
-		return nil, fmt.Errorf("incorrect lots to make order: %d", lots)
-	}
-
-	buyResp, err := c.NewOrdersServiceClient().PostOrder(&investgo.PostOrderRequest{
-		InstrumentId: instrInfo.Uid,
-		Quantity:     lots,
-		Direction:    pb.OrderDirection_ORDER_DIRECTION_BUY,
-		AccountId:    accountId,
-		OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
-		OrderId:      requestId,
+func (c *Client) postOrderAsync(instrInfo *ds.InstrumentInfo, direction pb.OrderDirection, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	orderResp, err := Invoke(c, QuotaOrders, func() (*investgo.PostOrderAsyncResponse, error) {
+		return c.NewOrdersServiceClient().PostOrderAsync(&investgo.PostOrderAsyncRequest{
+			InstrumentId: instrInfo.Uid,
+			Quantity:     lots,
+			Direction:    direction,
+			AccountId:    accountId,
+			OrderType:    pb.OrderType_ORDER_TYPE_BESTPRICE,
+			OrderId:      requestId,
+		})
 	})
 	if err != nil {
-		return nil, makeErrorMessage(err, buyResp)
+		return nil, makeErrorMessage(err, orderResp)
 	}
 
 	return &ds.PostOrderResult{
-		ExecutedCommission: ds.Quotation{
-			Units: buyResp.ExecutedCommission.Units,
-			Nano:  buyResp.ExecutedCommission.Nano,
-		},
-		ExecutedOrderPrice: ds.Quotation{
-			Units: buyResp.ExecutedOrderPrice.Units,
-			Nano:  buyResp.ExecutedOrderPrice.Nano,
-		},
-		InstrumentUid:         buyResp.InstrumentUid,
-		OrderId:               buyResp.OrderId,
-		ExecutionReportStatus: resolveExecutionReportStatus(buyResp.ExecutionReportStatus).ToString(),
+		InstrumentUid:         instrInfo.Uid,
+		OrderId:               orderResp.OrderRequestId,
+		ExecutionReportStatus: resolveExecutionReportStatus(orderResp.ExecutionReportStatus).ToString(),
 	}, nil
 }
 
 func makeErrorMessage(err error, h IGetterHeader) error {
 	msg := err.Error()
-	if h != nil {
-		for _, s := range h.GetHeader()["message"] {
-			msg += "; " + s
-		}
+	for _, s := range headerOf(h)["message"] {
+		msg += "; " + s
 	}
 
 	return errors.New(msg)
 }
 
 func (c *Client) RegisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
-	if c.ordersDataStream == nil {
-		err := c.prepareStreamForOrdersState(instrInfo)
-		if err != nil {
-			return err
-		}
-	}
-
 	c.Lock()
 	defer c.Unlock()
 
 	accId := AccountId(accountId)
 	instrUid := InstrumentUid(instrInfo.Uid)
 	instanceId := InstanceId(instrInfo.InstanceId)
+	key := subscriptionKey{kind: orderStateSubscription, id: accountId, param: instrInfo.Uid}
+
+	if c.subscriptions.acquire(key, instanceId) && c.ordersDataStream == nil {
+		if err := c.prepareStreamForOrdersState(instrInfo); err != nil {
+			c.subscriptions.release(key, instanceId)
+			return err
+		}
+	}
 
 	if _, ok := c.ordersStateInput[accId]; !ok {
 		c.ordersStateInput[accId] = make(map[InstrumentUid]map[InstanceId]chan *pb.OrderStateStreamResponse_OrderState)
@@ -410,15 +550,21 @@ func (c *Client) UnregisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, acc
 	instrUid := InstrumentUid(instrInfo.Uid)
 	instanceId := InstanceId(instrInfo.InstanceId)
 
+	key := subscriptionKey{kind: orderStateSubscription, id: accountId, param: instrInfo.Uid}
+
 	if _, ok := c.ordersStateInput[accId][instrUid][instanceId]; ok {
 		supports.CloseIfMaybeClosed(c.ordersStateInput[accId][instrUid][instanceId])
 	}
 
 	delete(c.ordersStateInput[accId][instrUid], instanceId)
 
-	delete(c.ordersStateInput[accId], instrUid)
+	if c.subscriptions.release(key, instanceId) {
+		delete(c.ordersStateInput[accId], instrUid)
+	}
 
-	delete(c.ordersStateInput, accId)
+	if len(c.ordersStateInput[accId]) == 0 {
+		delete(c.ordersStateInput, accId)
+	}
 
 	return nil
 }
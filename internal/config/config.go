@@ -32,28 +32,105 @@ type CandlesLoaderCfg struct {
 }
 
 type BacktesterCfg struct {
-	UniqueTraderId    string         `yaml:"unique_trader_id"`
-	Uid               string         `yaml:"uid"`
-	From              string         `yaml:"from"`
-	To                string         `yaml:"to"`
-	Interval          string         `yaml:"interval"`
-	StartDeposit      float64        `yaml:"start_deposit"`
-	CommissionPercent float64        `yaml:"commission_percent"`
-	StrategyCfg       map[string]any `yaml:"strategy_cfg"`
+	UniqueTraderId    string          `yaml:"unique_trader_id" json:"unique_trader_id"`
+	Uid               string          `yaml:"uid" json:"uid"`
+	From              string          `yaml:"from" json:"from"`
+	To                string          `yaml:"to" json:"to"`
+	Interval          string          `yaml:"interval" json:"interval"`
+	StartDeposit      float64         `yaml:"start_deposit" json:"start_deposit"`
+	BaseCurrency      string          `yaml:"base_currency" json:"base_currency"`
+	CommissionPercent float64         `yaml:"commission_percent" json:"commission_percent"`
+	Sessions          []string        `yaml:"sessions" json:"sessions"`
+	ReplaySchedule    bool            `yaml:"replay_schedule" json:"replay_schedule"`
+	StrategyCfg       map[string]any  `yaml:"strategy_cfg" json:"strategy_cfg"`
+	WalkForward       *WalkForwardCfg `yaml:"walk_forward" json:"walk_forward"`
+	Fill              *FillCfg        `yaml:"fill" json:"fill"`
+	Margin            *MarginCfg      `yaml:"margin" json:"margin"`
+	Fees              *FeesCfg        `yaml:"fees" json:"fees"`
+	Tax               *TaxCfg         `yaml:"tax" json:"tax"`
+	Portfolio         string          `yaml:"portfolio" json:"portfolio"`
+	AllocationPercent float64         `yaml:"allocation_percent" json:"allocation_percent"`
+}
+
+type FeesCfg struct {
+	Tiers           []FeeTierCfg `yaml:"tiers" json:"tiers"`
+	MinPerOrder     float64      `yaml:"min_per_order" json:"min_per_order"`
+	ExchangePercent float64      `yaml:"exchange_percent" json:"exchange_percent"`
+}
+
+type FeeTierCfg struct {
+	Turnover float64 `yaml:"turnover" json:"turnover"`
+	Percent  float64 `yaml:"percent" json:"percent"`
+}
+
+type TaxCfg struct {
+	Percent     float64 `yaml:"percent" json:"percent"`
+	HighPercent float64 `yaml:"high_percent" json:"high_percent"`
+	Threshold   float64 `yaml:"threshold" json:"threshold"`
+}
+
+type MarginCfg struct {
+	Leverage        float64 `yaml:"leverage" json:"leverage"`
+	InterestPercent float64 `yaml:"interest_percent" json:"interest_percent"`
+}
+
+type FillCfg struct {
+	Model              string  `yaml:"model" json:"model"`
+	SlippagePercent    float64 `yaml:"slippage_percent" json:"slippage_percent"`
+	VolatilitySlippage float64 `yaml:"volatility_slippage" json:"volatility_slippage"`
+	SpreadPercent      float64 `yaml:"spread_percent" json:"spread_percent"`
+	MaxVolumePercent   float64 `yaml:"max_volume_percent" json:"max_volume_percent"`
+}
+
+type WalkForwardCfg struct {
+	InSampleDays    int `yaml:"in_sample_days" json:"in_sample_days"`
+	OutOfSampleDays int `yaml:"out_of_sample_days" json:"out_of_sample_days"`
 }
 
 type TraderCfg struct {
 	TradingDelay                time.Duration `yaml:"trading_delay"`
 	OnTradingErrorDelay         time.Duration `yaml:"on_trading_error_delay"`
 	OnOrdersOperatingErrorDelay time.Duration `yaml:"on_orders_operating_error_delay"`
+	AsyncOrders                 bool          `yaml:"async_orders"`
+	BaseCurrency                string        `yaml:"base_currency"`
+	InstrumentLookup            *LookupCfg    `yaml:"instrument_lookup"`
+	Paper                       *PaperCfg     `yaml:"paper"`
+	Record                      *RecordCfg    `yaml:"record"`
+	Replay                      *ReplayCfg    `yaml:"replay"`
 
 	Traders []*OneTraderCfg `yaml:"traders"`
 }
 
+type LookupCfg struct {
+	ClassCodes      []string `yaml:"class_codes"`
+	InstrumentTypes []string `yaml:"instrument_types"`
+}
+
+type PaperCfg struct {
+	SlippagePercent   float64       `yaml:"slippage_percent"`
+	CommissionPercent float64       `yaml:"commission_percent"`
+	Latency           time.Duration `yaml:"latency"`
+	OrderBookDepth    int32         `yaml:"order_book_depth"`
+}
+
+type RecordCfg struct {
+	Path string `yaml:"path"`
+}
+
+type ReplayCfg struct {
+	Path              string  `yaml:"path"`
+	Speed             float64 `yaml:"speed"`
+	CommissionPercent float64 `yaml:"commission_percent"`
+	ReplayOrders      bool    `yaml:"replay_orders"`
+}
+
 type OneTraderCfg struct {
 	UniqueTraderId string         `yaml:"unique_trader_id"`
 	Uid            string         `yaml:"uid"`
+	BasicAsset     string         `yaml:"basic_asset"`
+	RollBefore     time.Duration  `yaml:"roll_before"`
 	AccountId      string         `yaml:"account_id"`
+	Sessions       []string       `yaml:"sessions"`
 	StrategyCfg    map[string]any `yaml:"strategy_cfg"`
 }
 
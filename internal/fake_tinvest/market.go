@@ -0,0 +1,447 @@
+package faketinvest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/google/uuid"
+)
+
+const (
+	eventsBuffer = 1000
+
+	// order book levels are placed with this step of price in percents
+	orderBookStepPercent = 0.05
+)
+
+type PriceTick struct {
+	Uid, Figi string
+	Price     float64
+	Time      time.Time
+}
+
+type Candle struct {
+	Open, High, Low, Close float64
+	Volume                 int64
+	Time                   time.Time
+}
+
+type OrderState struct {
+	OrderId       string
+	RequestId     string
+	AccountId     string
+	Instrument    *ScriptInstrument
+	Direction     ds.Action
+	Status        ds.OrderStatus
+	IsLimit       bool
+	LimitPrice    float64
+	LotsRequested int64
+	LotsExecuted  int64
+	Price         float64
+	Commission    float64
+	CreatedAt     time.Time
+	CompletedAt   time.Time
+}
+
+type Event struct {
+	Tick  *PriceTick
+	Order *OrderState
+}
+
+type Account struct {
+	Id        string
+	Name      string
+	Money     float64
+	Positions map[string]int64
+	Sandbox   bool
+	OpenedAt  time.Time
+}
+
+// Market replays script prices and fills orders deterministically:
+// market orders are filled at the current price, limit orders
+// when the current price reaches the limit one.
+type Market struct {
+	sync.Mutex
+
+	script      *Script
+	cursor      int
+	instruments map[string]*ScriptInstrument
+	accounts    map[string]*Account
+	orders      map[string]*OrderState
+	listeners   map[int]chan Event
+	lastId      int
+}
+
+func NewMarket(script *Script) *Market {
+	m := &Market{
+		script:      script,
+		instruments: make(map[string]*ScriptInstrument),
+		accounts:    make(map[string]*Account),
+		orders:      make(map[string]*OrderState),
+		listeners:   make(map[int]chan Event),
+	}
+
+	for _, v := range script.Instruments {
+		m.instruments[v.Uid] = v
+	}
+
+	for _, v := range script.Accounts {
+		m.accounts[v.Id] = &Account{
+			Id:        v.Id,
+			Name:      v.Name,
+			Money:     v.Money,
+			Positions: make(map[string]int64),
+			OpenedAt:  script.Start,
+		}
+	}
+
+	return m
+}
+
+// Run moves prices every tick of script
+func (m *Market) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.script.Tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Advance(time.Now())
+		}
+	}
+}
+
+// Advance makes the next price current, fills limit orders and notifies listeners
+func (m *Market) Advance(now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.cursor++
+
+	for _, instr := range m.script.Instruments {
+		m.broadcast(Event{Tick: &PriceTick{
+			Uid:   instr.Uid,
+			Figi:  instr.Figi,
+			Price: m.priceOf(instr),
+			Time:  now,
+		}})
+	}
+
+	for _, order := range m.orders {
+		if order.Status != ds.New {
+			continue
+		}
+		if m.crosses(order) {
+			m.fill(order, order.LimitPrice, now)
+		}
+	}
+}
+
+func (m *Market) Subscribe() (int, <-chan Event) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.lastId++
+	ch := make(chan Event, eventsBuffer)
+	m.listeners[m.lastId] = ch
+
+	return m.lastId, ch
+}
+
+func (m *Market) Unsubscribe(id int) {
+	m.Lock()
+	defer m.Unlock()
+
+	if ch, ok := m.listeners[id]; ok {
+		close(ch)
+	}
+	delete(m.listeners, id)
+}
+
+func (m *Market) broadcast(e Event) {
+	for _, ch := range m.listeners {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (m *Market) Instruments() []*ScriptInstrument {
+	return m.script.Instruments
+}
+
+func (m *Market) Instrument(uid string) (*ScriptInstrument, bool) {
+	v, ok := m.instruments[uid]
+	return v, ok
+}
+
+// FindInstrument looks for instruments by any identifier
+func (m *Market) FindInstrument(query string) []*ScriptInstrument {
+	var found []*ScriptInstrument
+	for _, v := range m.script.Instruments {
+		if v.Uid == query || v.Figi == query || v.Ticker == query || v.Isin == query {
+			found = append(found, v)
+		}
+	}
+
+	return found
+}
+
+// resolveUid returns uid of instrument by uid or figi, requests may have any of them
+func (m *Market) resolveUid(instrumentId, figi string) string {
+	for _, id := range []string{instrumentId, figi} {
+		if id == "" {
+			continue
+		}
+		if found := m.FindInstrument(id); len(found) > 0 {
+			return found[0].Uid
+		}
+	}
+
+	if instrumentId != "" {
+		return instrumentId
+	}
+	return figi
+}
+
+func (m *Market) FirstCandleTime() time.Time {
+	return m.script.Start
+}
+
+func (m *Market) Price(uid string) (float64, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	instr, ok := m.instruments[uid]
+	if !ok {
+		return 0, false
+	}
+
+	return m.priceOf(instr), true
+}
+
+func (m *Market) priceOf(instr *ScriptInstrument) float64 {
+	return instr.Prices[m.cursor%len(instr.Prices)]
+}
+
+// OrderBook makes synthetic levels around the current price with volume of instrument
+func (m *Market) OrderBook(uid string, depth int32) (bids, asks []ds.OrderBookLevel, ok bool) {
+	price, ok := m.Price(uid)
+	if !ok {
+		return nil, nil, false
+	}
+
+	volume := m.instruments[uid].Volume
+	step := price * orderBookStepPercent / 100
+
+	for i := int32(1); i <= depth; i++ {
+		bid := ds.OrderBookLevel{Quantity: volume * int64(i)}
+		bid.Price.FromFloat64(roundPrice(price - step*float64(i)))
+		bids = append(bids, bid)
+
+		ask := ds.OrderBookLevel{Quantity: volume * int64(i)}
+		ask.Price.FromFloat64(roundPrice(price + step*float64(i)))
+		asks = append(asks, ask)
+	}
+
+	return bids, asks, true
+}
+
+// Candles aggregates script prices into candles of interval
+func (m *Market) Candles(uid string, interval time.Duration, from, to time.Time) ([]*Candle, error) {
+	instr, ok := m.instruments[uid]
+	if !ok {
+		return nil, fmt.Errorf("not found instrument '%s'", uid)
+	}
+
+	var candles []*Candle
+	var current *Candle
+	for i, price := range instr.Prices {
+		t := m.script.Start.Add(m.script.Step * time.Duration(i))
+		if t.Before(from) || !t.Before(to) {
+			continue
+		}
+
+		bucket := t.Truncate(interval)
+		if current == nil || !current.Time.Equal(bucket) {
+			current = &Candle{Open: price, High: price, Low: price, Time: bucket}
+			candles = append(candles, current)
+		}
+
+		current.High = math.Max(current.High, price)
+		current.Low = math.Min(current.Low, price)
+		current.Close = price
+		current.Volume += instr.Volume
+	}
+
+	return candles, nil
+}
+
+func (m *Market) PostOrder(accountId, requestId, uid string, direction ds.Action, lots int64,
+	isLimit bool, limitPrice float64, now time.Time) (*OrderState, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if lots < 1 {
+		return nil, fmt.Errorf("incorrect lots: %d", lots)
+	}
+
+	if _, ok := m.accounts[accountId]; !ok {
+		return nil, fmt.Errorf("not found account '%s'", accountId)
+	}
+
+	instr, ok := m.instruments[uid]
+	if !ok {
+		return nil, fmt.Errorf("not found instrument '%s'", uid)
+	}
+
+	if requestId == "" {
+		requestId = uuid.NewString()
+	}
+	if order, ok := m.orders[requestId]; ok {
+		return order, nil
+	}
+
+	order := &OrderState{
+		OrderId:       uuid.NewString(),
+		RequestId:     requestId,
+		AccountId:     accountId,
+		Instrument:    instr,
+		Direction:     direction,
+		Status:        ds.New,
+		IsLimit:       isLimit,
+		LimitPrice:    limitPrice,
+		LotsRequested: lots,
+		CreatedAt:     now,
+	}
+	m.orders[requestId] = order
+
+	if !isLimit {
+		m.fill(order, m.priceOf(instr), now)
+	} else if m.crosses(order) {
+		m.fill(order, limitPrice, now)
+	} else {
+		m.broadcast(Event{Order: order})
+	}
+
+	state := *order
+	return &state, nil
+}
+
+func (m *Market) crosses(order *OrderState) bool {
+	price := m.priceOf(order.Instrument)
+	if order.Direction == ds.Buy {
+		return price <= order.LimitPrice
+	}
+
+	return price >= order.LimitPrice
+}
+
+func (m *Market) fill(order *OrderState, price float64, now time.Time) {
+	acc := m.accounts[order.AccountId]
+
+	amount := order.Instrument.Amount(price, order.LotsRequested)
+	commission := amount * m.script.CommissionPercent / 100
+
+	if order.Direction == ds.Buy {
+		acc.Money -= amount + commission
+		acc.Positions[order.Instrument.Uid] += order.LotsRequested * int64(order.Instrument.Lot)
+	} else {
+		acc.Money += amount - commission
+		acc.Positions[order.Instrument.Uid] -= order.LotsRequested * int64(order.Instrument.Lot)
+	}
+
+	order.Status = ds.Fill
+	order.Price = price
+	order.Commission = commission
+	order.LotsExecuted = order.LotsRequested
+	order.CompletedAt = now
+
+	state := *order
+	m.broadcast(Event{Order: &state})
+}
+
+func (m *Market) Accounts(sandbox bool) []*Account {
+	m.Lock()
+	defer m.Unlock()
+
+	var accounts []*Account
+	for _, v := range m.accounts {
+		if v.Sandbox == sandbox {
+			acc := *v
+			accounts = append(accounts, &acc)
+		}
+	}
+
+	return accounts
+}
+
+func (m *Market) Account(id string) (*Account, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	acc, ok := m.accounts[id]
+	if !ok {
+		return nil, false
+	}
+
+	copied := *acc
+	copied.Positions = make(map[string]int64, len(acc.Positions))
+	for k, v := range acc.Positions {
+		copied.Positions[k] = v
+	}
+
+	return &copied, true
+}
+
+func (m *Market) OpenAccount(now time.Time) string {
+	m.Lock()
+	defer m.Unlock()
+
+	id := uuid.NewString()
+	m.accounts[id] = &Account{
+		Id:        id,
+		Name:      "Sandbox",
+		Positions: make(map[string]int64),
+		Sandbox:   true,
+		OpenedAt:  now,
+	}
+
+	return id
+}
+
+func (m *Market) CloseAccount(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.accounts[id]; !ok {
+		return fmt.Errorf("not found account '%s'", id)
+	}
+	delete(m.accounts, id)
+
+	return nil
+}
+
+func (m *Market) PayIn(id string, amount float64) (float64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	acc, ok := m.accounts[id]
+	if !ok {
+		return 0, fmt.Errorf("not found account '%s'", id)
+	}
+	acc.Money += amount
+
+	return acc.Money, nil
+}
+
+func roundPrice(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
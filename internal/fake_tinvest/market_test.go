@@ -0,0 +1,138 @@
+package faketinvest
+
+import (
+	"testing"
+	"time"
+
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMarket(t *testing.T) *Market {
+	t.Helper()
+
+	s := &Script{
+		Start:             time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		CommissionPercent: 1,
+		Instruments: []*ScriptInstrument{
+			{Uid: "uid", Figi: "figi", Ticker: "TICK", Lot: 10, Volume: 5, Prices: []float64{100, 102, 98, 105}},
+		},
+	}
+	require.NoError(t, s.prepare())
+
+	return NewMarket(s)
+}
+
+func TestPostOrder(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	t.Run("market order filled at current price", func(t *testing.T) {
+		t.Parallel()
+
+		m := newTestMarket(t)
+
+		order, err := m.PostOrder(defaultAccountId, "req", "uid", ds.Buy, 2, false, 0, now)
+		require.NoError(t, err)
+		require.Equal(t, ds.Fill, order.Status)
+		require.InDelta(t, 100.0, order.Price, 1e-9)
+		require.InDelta(t, 20.0, order.Commission, 1e-9)
+
+		acc, ok := m.Account(defaultAccountId)
+		require.True(t, ok)
+		require.InDelta(t, defaultAccountMoney-2000.0-20, acc.Money, 1e-9)
+		require.Equal(t, int64(20), acc.Positions["uid"])
+	})
+
+	t.Run("same request id is not executed twice", func(t *testing.T) {
+		t.Parallel()
+
+		m := newTestMarket(t)
+
+		first, err := m.PostOrder(defaultAccountId, "req", "uid", ds.Buy, 1, false, 0, now)
+		require.NoError(t, err)
+		second, err := m.PostOrder(defaultAccountId, "req", "uid", ds.Buy, 1, false, 0, now)
+		require.NoError(t, err)
+		require.Equal(t, first.OrderId, second.OrderId)
+
+		acc, _ := m.Account(defaultAccountId)
+		require.Equal(t, int64(10), acc.Positions["uid"])
+	})
+
+	t.Run("limit order filled when price reaches it", func(t *testing.T) {
+		t.Parallel()
+
+		m := newTestMarket(t)
+		_, events := m.Subscribe()
+
+		order, err := m.PostOrder(defaultAccountId, "req", "uid", ds.Buy, 1, true, 99, now)
+		require.NoError(t, err)
+		require.Equal(t, ds.New, order.Status)
+
+		m.Advance(now)
+		acc, _ := m.Account(defaultAccountId)
+		require.Equal(t, int64(0), acc.Positions["uid"])
+
+		m.Advance(now)
+		acc, _ = m.Account(defaultAccountId)
+		require.Equal(t, int64(10), acc.Positions["uid"])
+
+		var filled *OrderState
+		for len(events) > 0 {
+			if e := <-events; e.Order != nil && e.Order.Status == ds.Fill {
+				filled = e.Order
+			}
+		}
+		require.NotNil(t, filled)
+		require.InDelta(t, 99.0, filled.Price, 1e-9)
+	})
+
+	t.Run("unknown account", func(t *testing.T) {
+		t.Parallel()
+
+		m := newTestMarket(t)
+
+		_, err := m.PostOrder("unknown", "req", "uid", ds.Buy, 1, false, 0, now)
+		require.Error(t, err)
+	})
+}
+
+func TestCandles(t *testing.T) {
+	t.Parallel()
+
+	m := newTestMarket(t)
+	start := m.FirstCandleTime()
+
+	candles, err := m.Candles("uid", time.Minute*2, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, candles, 2)
+
+	require.InDelta(t, 100.0, candles[0].Open, 1e-9)
+	require.InDelta(t, 102.0, candles[0].High, 1e-9)
+	require.InDelta(t, 100.0, candles[0].Low, 1e-9)
+	require.InDelta(t, 102.0, candles[0].Close, 1e-9)
+	require.Equal(t, int64(10), candles[0].Volume)
+
+	require.InDelta(t, 98.0, candles[1].Open, 1e-9)
+	require.InDelta(t, 105.0, candles[1].Close, 1e-9)
+	require.Equal(t, start.Add(time.Minute*2), candles[1].Time)
+}
+
+func TestOrderBook(t *testing.T) {
+	t.Parallel()
+
+	m := newTestMarket(t)
+
+	bids, asks, ok := m.OrderBook("uid", 2)
+	require.True(t, ok)
+	require.Len(t, bids, 2)
+	require.Len(t, asks, 2)
+	require.InDelta(t, 99.95, bids[0].Price.ToFloat64(), 1e-9)
+	require.InDelta(t, 100.1, asks[1].Price.ToFloat64(), 1e-9)
+	require.Equal(t, int64(10), asks[1].Quantity)
+
+	_, _, ok = m.OrderBook("unknown", 2)
+	require.False(t, ok)
+}
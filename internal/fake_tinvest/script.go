@@ -0,0 +1,142 @@
+package faketinvest
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultAccountId    = "fake-account"
+	defaultAccountMoney = 1_000_000
+)
+
+type ScriptInstrument struct {
+	Uid       string    `yaml:"uid"`
+	Figi      string    `yaml:"figi"`
+	Ticker    string    `yaml:"ticker"`
+	ClassCode string    `yaml:"class_code"`
+	Isin      string    `yaml:"isin"`
+	Name      string    `yaml:"name"`
+	Type      string    `yaml:"type"`
+	Exchange  string    `yaml:"exchange"`
+	Currency  string    `yaml:"currency"`
+	Lot       int32     `yaml:"lot"`
+	Volume    int64     `yaml:"volume"`
+	Prices    []float64 `yaml:"prices"`
+
+	// futures only, price is in points and every MinPriceIncrement costs MinPriceIncrementAmount
+	BasicAsset              string    `yaml:"basic_asset"`
+	ExpirationDate          time.Time `yaml:"expiration_date"`
+	MinPriceIncrement       float64   `yaml:"min_price_increment"`
+	MinPriceIncrementAmount float64   `yaml:"min_price_increment_amount"`
+	InitialMargin           float64   `yaml:"initial_margin"`
+
+	// bonds only, price is in percents of nominal
+	Nominal      float64         `yaml:"nominal"`
+	MaturityDate time.Time       `yaml:"maturity_date"`
+	Coupons      []*ScriptCoupon `yaml:"coupons"`
+
+	// currencies only, prices of currency are in Currency for one unit of IsoCurrencyName
+	IsoCurrencyName string `yaml:"iso_currency_name"`
+}
+
+// ScriptCoupon is paid on date for one bond, its period starts on the previous coupon date
+type ScriptCoupon struct {
+	Date   time.Time `yaml:"date"`
+	Amount float64   `yaml:"amount"`
+}
+
+// Amount returns money cost of lots at price
+func (v *ScriptInstrument) Amount(price float64, lots int64) float64 {
+	amount := price * float64(lots) * float64(v.Lot)
+	if v.Nominal > 0 {
+		amount = amount / 100 * v.Nominal
+	}
+	if v.MinPriceIncrement > 0 && v.MinPriceIncrementAmount > 0 {
+		amount = amount / v.MinPriceIncrement * v.MinPriceIncrementAmount
+	}
+
+	return amount
+}
+
+type ScriptAccount struct {
+	Id    string  `yaml:"id"`
+	Name  string  `yaml:"name"`
+	Money float64 `yaml:"money"`
+}
+
+// Script describes instruments with price series which fake server replays.
+// Price with index i has history time Start + i*Step, and every Tick
+// the next price becomes the current one.
+type Script struct {
+	Start             time.Time           `yaml:"start"`
+	Step              time.Duration       `yaml:"step"`
+	Tick              time.Duration       `yaml:"tick"`
+	CommissionPercent float64             `yaml:"commission_percent"`
+	Instruments       []*ScriptInstrument `yaml:"instruments"`
+	Accounts          []*ScriptAccount    `yaml:"accounts"`
+}
+
+func LoadScript(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &Script{}
+	if err := yaml.NewDecoder(f).Decode(s); err != nil {
+		return nil, fmt.Errorf("failed decoding script: %s", err.Error())
+	}
+
+	return s, s.prepare()
+}
+
+func (s *Script) prepare() error {
+	if len(s.Instruments) == 0 {
+		return fmt.Errorf("no instruments in script")
+	}
+
+	if s.Start.IsZero() {
+		s.Start = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	}
+	if s.Step <= 0 {
+		s.Step = time.Minute
+	}
+	if s.Tick <= 0 {
+		s.Tick = time.Second
+	}
+
+	for _, v := range s.Instruments {
+		if v.Uid == "" {
+			return fmt.Errorf("instrument without uid in script")
+		}
+		if len(v.Prices) == 0 {
+			return fmt.Errorf("no prices for instrument '%s'", v.Uid)
+		}
+		if v.Lot <= 0 {
+			v.Lot = 1
+		}
+		if v.Volume <= 0 {
+			v.Volume = 1
+		}
+		if v.Type == "" {
+			v.Type = "share"
+		}
+		if v.Exchange == "" {
+			v.Exchange = "MOEX"
+		}
+		if v.Currency == "" {
+			v.Currency = "rub"
+		}
+	}
+
+	if len(s.Accounts) == 0 {
+		s.Accounts = []*ScriptAccount{{Id: defaultAccountId, Name: "Fake", Money: defaultAccountMoney}}
+	}
+
+	return nil
+}
@@ -0,0 +1,787 @@
+package faketinvest
+
+import (
+	"context"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/google/uuid"
+	pb "github.com/russianinvestments/invest-api-go-sdk/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var candleIntervals = map[pb.CandleInterval]time.Duration{
+	pb.CandleInterval_CANDLE_INTERVAL_1_MIN:  time.Minute,
+	pb.CandleInterval_CANDLE_INTERVAL_2_MIN:  time.Minute * 2,
+	pb.CandleInterval_CANDLE_INTERVAL_3_MIN:  time.Minute * 3,
+	pb.CandleInterval_CANDLE_INTERVAL_5_MIN:  time.Minute * 5,
+	pb.CandleInterval_CANDLE_INTERVAL_10_MIN: time.Minute * 10,
+	pb.CandleInterval_CANDLE_INTERVAL_15_MIN: time.Minute * 15,
+	pb.CandleInterval_CANDLE_INTERVAL_30_MIN: time.Minute * 30,
+	pb.CandleInterval_CANDLE_INTERVAL_HOUR:   time.Hour,
+	pb.CandleInterval_CANDLE_INTERVAL_2_HOUR: time.Hour * 2,
+	pb.CandleInterval_CANDLE_INTERVAL_4_HOUR: time.Hour * 4,
+	pb.CandleInterval_CANDLE_INTERVAL_DAY:    time.Hour * 24,
+	pb.CandleInterval_CANDLE_INTERVAL_WEEK:   time.Hour * 24 * 7,
+	pb.CandleInterval_CANDLE_INTERVAL_MONTH:  time.Hour * 24 * 30,
+}
+
+// Register adds services used by the project on grpc server
+func Register(s *grpc.Server, m *Market) {
+	pb.RegisterInstrumentsServiceServer(s, &instrumentsService{m: m})
+	pb.RegisterMarketDataServiceServer(s, &marketDataService{m: m})
+	pb.RegisterMarketDataStreamServiceServer(s, &marketDataStreamService{m: m})
+	pb.RegisterOrdersServiceServer(s, &ordersService{m: m})
+	pb.RegisterOrdersStreamServiceServer(s, &ordersStreamService{m: m})
+	pb.RegisterOperationsServiceServer(s, &operationsService{m: m})
+	pb.RegisterUsersServiceServer(s, &usersService{m: m})
+	pb.RegisterSandboxServiceServer(s, &sandboxService{m: m})
+}
+
+type instrumentsService struct {
+	pb.UnimplementedInstrumentsServiceServer
+	m *Market
+}
+
+func (s *instrumentsService) FindInstrument(_ context.Context, req *pb.FindInstrumentRequest) (*pb.FindInstrumentResponse, error) {
+	resp := &pb.FindInstrumentResponse{}
+	for _, v := range s.m.FindInstrument(req.GetQuery()) {
+		resp.Instruments = append(resp.Instruments, &pb.InstrumentShort{
+			Isin:                  v.Isin,
+			Figi:                  v.Figi,
+			Ticker:                v.Ticker,
+			ClassCode:             v.ClassCode,
+			InstrumentType:        v.Type,
+			Name:                  v.Name,
+			Uid:                   v.Uid,
+			Lot:                   v.Lot,
+			ApiTradeAvailableFlag: true,
+			First_1MinCandleDate:  timestamppb.New(s.m.FirstCandleTime()),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *instrumentsService) GetInstrumentBy(_ context.Context, req *pb.InstrumentRequest) (*pb.InstrumentResponse, error) {
+	found := s.m.FindInstrument(req.GetId())
+	if len(found) == 0 {
+		return nil, status.Errorf(codes.NotFound, "not found instrument '%s'", req.GetId())
+	}
+
+	v := found[0]
+	return &pb.InstrumentResponse{Instrument: &pb.Instrument{
+		Figi:                  v.Figi,
+		Ticker:                v.Ticker,
+		ClassCode:             v.ClassCode,
+		Isin:                  v.Isin,
+		Lot:                   v.Lot,
+		Currency:              v.Currency,
+		Name:                  v.Name,
+		Exchange:              v.Exchange,
+		Uid:                   v.Uid,
+		InstrumentType:        v.Type,
+		ApiTradeAvailableFlag: true,
+	}}, nil
+}
+
+func (s *instrumentsService) Shares(_ context.Context, _ *pb.InstrumentsRequest) (*pb.SharesResponse, error) {
+	resp := &pb.SharesResponse{}
+	for _, v := range s.instrumentsOfType("share") {
+		resp.Instruments = append(resp.Instruments, &pb.Share{
+			Figi: v.Figi, Ticker: v.Ticker, ClassCode: v.ClassCode, Isin: v.Isin, Lot: v.Lot,
+			Currency: v.Currency, Name: v.Name, Exchange: v.Exchange, Uid: v.Uid, ApiTradeAvailableFlag: true,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *instrumentsService) Etfs(_ context.Context, _ *pb.InstrumentsRequest) (*pb.EtfsResponse, error) {
+	resp := &pb.EtfsResponse{}
+	for _, v := range s.instrumentsOfType("etf") {
+		resp.Instruments = append(resp.Instruments, &pb.Etf{
+			Figi: v.Figi, Ticker: v.Ticker, ClassCode: v.ClassCode, Isin: v.Isin, Lot: v.Lot,
+			Currency: v.Currency, Name: v.Name, Exchange: v.Exchange, Uid: v.Uid, ApiTradeAvailableFlag: true,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *instrumentsService) Bonds(_ context.Context, _ *pb.InstrumentsRequest) (*pb.BondsResponse, error) {
+	resp := &pb.BondsResponse{}
+	for _, v := range s.instrumentsOfType("bond") {
+		resp.Instruments = append(resp.Instruments, &pb.Bond{
+			Figi: v.Figi, Ticker: v.Ticker, ClassCode: v.ClassCode, Isin: v.Isin, Lot: v.Lot,
+			Currency: v.Currency, Name: v.Name, Exchange: v.Exchange, Uid: v.Uid, ApiTradeAvailableFlag: true,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *instrumentsService) Currencies(_ context.Context, _ *pb.InstrumentsRequest) (*pb.CurrenciesResponse, error) {
+	resp := &pb.CurrenciesResponse{}
+	for _, v := range s.instrumentsOfType("currency") {
+		resp.Instruments = append(resp.Instruments, &pb.Currency{
+			Figi: v.Figi, Ticker: v.Ticker, ClassCode: v.ClassCode, Isin: v.Isin, Lot: v.Lot,
+			Currency: v.Currency, Name: v.Name, Exchange: v.Exchange, Uid: v.Uid, ApiTradeAvailableFlag: true,
+			IsoCurrencyName: v.IsoCurrencyName,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *instrumentsService) Futures(_ context.Context, _ *pb.InstrumentsRequest) (*pb.FuturesResponse, error) {
+	resp := &pb.FuturesResponse{}
+	for _, v := range s.instrumentsOfType("futures") {
+		resp.Instruments = append(resp.Instruments, future(v))
+	}
+
+	return resp, nil
+}
+
+func (s *instrumentsService) FutureBy(_ context.Context, req *pb.InstrumentRequest) (*pb.FutureResponse, error) {
+	found := s.m.FindInstrument(req.GetId())
+	if len(found) == 0 || found[0].Type != "futures" {
+		return nil, status.Errorf(codes.NotFound, "not found futures '%s'", req.GetId())
+	}
+
+	return &pb.FutureResponse{Instrument: future(found[0])}, nil
+}
+
+func (s *instrumentsService) GetFuturesMargin(_ context.Context, req *pb.GetFuturesMarginRequest) (*pb.GetFuturesMarginResponse, error) {
+	found := s.m.FindInstrument(req.GetFigi())
+	if len(found) == 0 || found[0].Type != "futures" {
+		return nil, status.Errorf(codes.NotFound, "not found futures '%s'", req.GetFigi())
+	}
+
+	v := found[0]
+	return &pb.GetFuturesMarginResponse{
+		InitialMarginOnBuy:      money(v.InitialMargin, v.Currency),
+		InitialMarginOnSell:     money(v.InitialMargin, v.Currency),
+		MinPriceIncrement:       quotation(v.MinPriceIncrement),
+		MinPriceIncrementAmount: quotation(v.MinPriceIncrementAmount),
+	}, nil
+}
+
+func (s *instrumentsService) BondBy(_ context.Context, req *pb.InstrumentRequest) (*pb.BondResponse, error) {
+	found := s.m.FindInstrument(req.GetId())
+	if len(found) == 0 || found[0].Type != "bond" {
+		return nil, status.Errorf(codes.NotFound, "not found bond '%s'", req.GetId())
+	}
+
+	v := found[0]
+	return &pb.BondResponse{Instrument: &pb.Bond{
+		Figi: v.Figi, Ticker: v.Ticker, ClassCode: v.ClassCode, Isin: v.Isin, Lot: v.Lot,
+		Currency: v.Currency, Name: v.Name, Exchange: v.Exchange, Uid: v.Uid, ApiTradeAvailableFlag: true,
+		Nominal:       money(v.Nominal, v.Currency),
+		AciValue:      money(0, v.Currency),
+		MaturityDate:  timestamppb.New(v.MaturityDate),
+		PlacementDate: timestamppb.New(s.m.FirstCandleTime()),
+	}}, nil
+}
+
+func (s *instrumentsService) GetBondCoupons(_ context.Context, req *pb.GetBondCouponsRequest) (*pb.GetBondCouponsResponse, error) {
+	found := s.m.FindInstrument(req.GetFigi())
+	if len(found) == 0 || found[0].Type != "bond" {
+		return nil, status.Errorf(codes.NotFound, "not found bond '%s'", req.GetFigi())
+	}
+
+	resp := &pb.GetBondCouponsResponse{}
+	start := s.m.FirstCandleTime()
+	for i, c := range found[0].Coupons {
+		resp.Events = append(resp.Events, &pb.Coupon{
+			Figi:            found[0].Figi,
+			CouponDate:      timestamppb.New(c.Date),
+			CouponNumber:    int64(i + 1),
+			PayOneBond:      money(c.Amount, found[0].Currency),
+			CouponStartDate: timestamppb.New(start),
+			CouponEndDate:   timestamppb.New(c.Date),
+		})
+		start = c.Date
+	}
+
+	return resp, nil
+}
+
+func future(v *ScriptInstrument) *pb.Future {
+	return &pb.Future{
+		Figi: v.Figi, Ticker: v.Ticker, ClassCode: v.ClassCode, Lot: v.Lot, Currency: v.Currency, Name: v.Name,
+		Exchange: v.Exchange, Uid: v.Uid, ApiTradeAvailableFlag: true, BasicAsset: v.BasicAsset,
+		ExpirationDate:     timestamppb.New(v.ExpirationDate),
+		MinPriceIncrement:  quotation(v.MinPriceIncrement),
+		InitialMarginOnBuy: money(v.InitialMargin, v.Currency), InitialMarginOnSell: money(v.InitialMargin, v.Currency),
+	}
+}
+
+func (s *instrumentsService) instrumentsOfType(t string) []*ScriptInstrument {
+	var res []*ScriptInstrument
+	for _, v := range s.m.Instruments() {
+		if v.Type == t {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// TradingSchedules answers that every day is trading all day long
+func (s *instrumentsService) TradingSchedules(_ context.Context, req *pb.TradingSchedulesRequest) (*pb.TradingSchedulesResponse, error) {
+	exchanges := map[string]struct{}{}
+	for _, v := range s.m.Instruments() {
+		if req.GetExchange() == "" || req.GetExchange() == v.Exchange {
+			exchanges[v.Exchange] = struct{}{}
+		}
+	}
+
+	from := req.GetFrom().AsTime().Truncate(time.Hour * 24)
+	to := req.GetTo().AsTime()
+
+	resp := &pb.TradingSchedulesResponse{}
+	for exchange := range exchanges {
+		schedule := &pb.TradingSchedule{Exchange: exchange}
+		for d := from; !d.After(to); d = d.Add(time.Hour * 24) {
+			schedule.Days = append(schedule.Days, &pb.TradingDay{
+				Date:         timestamppb.New(d),
+				IsTradingDay: true,
+				StartTime:    timestamppb.New(d),
+				EndTime:      timestamppb.New(d.Add(time.Hour*24 - time.Second)),
+			})
+		}
+		resp.Exchanges = append(resp.Exchanges, schedule)
+	}
+
+	return resp, nil
+}
+
+type marketDataService struct {
+	pb.UnimplementedMarketDataServiceServer
+	m *Market
+}
+
+func (s *marketDataService) GetCandles(_ context.Context, req *pb.GetCandlesRequest) (*pb.GetCandlesResponse, error) {
+	interval, ok := candleIntervals[req.GetInterval()]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported interval %s", req.GetInterval().String())
+	}
+
+	uid := s.m.resolveUid(req.GetInstrumentId(), req.GetFigi())
+
+	candles, err := s.m.Candles(uid, interval, req.GetFrom().AsTime(), req.GetTo().AsTime())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	resp := &pb.GetCandlesResponse{}
+	for _, v := range candles {
+		resp.Candles = append(resp.Candles, &pb.HistoricCandle{
+			Open:       quotation(v.Open),
+			High:       quotation(v.High),
+			Low:        quotation(v.Low),
+			Close:      quotation(v.Close),
+			Volume:     v.Volume,
+			Time:       timestamppb.New(v.Time),
+			IsComplete: true,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *marketDataService) GetTradingStatus(_ context.Context, req *pb.GetTradingStatusRequest) (*pb.GetTradingStatusResponse, error) {
+	uid := s.m.resolveUid(req.GetInstrumentId(), req.GetFigi())
+	instr, ok := s.m.Instrument(uid)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "not found instrument '%s'", uid)
+	}
+
+	return &pb.GetTradingStatusResponse{
+		Figi:                     instr.Figi,
+		InstrumentUid:            instr.Uid,
+		TradingStatus:            pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING,
+		LimitOrderAvailableFlag:  true,
+		MarketOrderAvailableFlag: true,
+		ApiTradeAvailableFlag:    true,
+	}, nil
+}
+
+func (s *marketDataService) GetLastPrices(_ context.Context, req *pb.GetLastPricesRequest) (*pb.GetLastPricesResponse, error) {
+	resp := &pb.GetLastPricesResponse{}
+	for _, id := range append(req.GetInstrumentId(), req.GetFigi()...) {
+		uid := s.m.resolveUid(id, id)
+		instr, ok := s.m.Instrument(uid)
+		if !ok {
+			continue
+		}
+
+		price, _ := s.m.Price(uid)
+		resp.LastPrices = append(resp.LastPrices, &pb.LastPrice{
+			Figi:          instr.Figi,
+			InstrumentUid: instr.Uid,
+			Price:         quotation(price),
+			Time:          timestamppb.Now(),
+		})
+	}
+
+	return resp, nil
+}
+
+type marketDataStreamService struct {
+	pb.UnimplementedMarketDataStreamServiceServer
+	m *Market
+}
+
+type streamSubscriptions struct {
+	lastPrices map[string]struct{}
+	orderBooks map[string]int32
+	candles    map[string]map[pb.SubscriptionInterval]struct{}
+	prevPrices map[string]float64
+}
+
+func (s *marketDataStreamService) MarketDataStream(stream pb.MarketDataStreamService_MarketDataStreamServer) error {
+	id, events := s.m.Subscribe()
+	defer s.m.Unsubscribe(id)
+
+	requests := make(chan *pb.MarketDataRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+
+			// handler may be gone after failed send
+			select {
+			case <-stream.Context().Done():
+				return
+			case requests <- req:
+			}
+		}
+	}()
+
+	subs := &streamSubscriptions{
+		lastPrices: make(map[string]struct{}),
+		orderBooks: make(map[string]int32),
+		candles:    make(map[string]map[pb.SubscriptionInterval]struct{}),
+		prevPrices: make(map[string]float64),
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case err := <-recvErr:
+			return err
+		case req := <-requests:
+			if resp := s.handleRequest(subs, req); resp != nil {
+				if err := stream.Send(resp); err != nil {
+					return err
+				}
+			}
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if e.Tick == nil {
+				continue
+			}
+			for _, resp := range s.handleTick(subs, e.Tick) {
+				if err := stream.Send(resp); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (s *marketDataStreamService) handleRequest(subs *streamSubscriptions, req *pb.MarketDataRequest) *pb.MarketDataResponse {
+	if r := req.GetSubscribeLastPriceRequest(); r != nil {
+		resp := &pb.SubscribeLastPriceResponse{TrackingId: uuid.NewString()}
+		for _, v := range r.GetInstruments() {
+			uid := s.m.resolveUid(v.GetInstrumentId(), v.GetFigi())
+			if r.GetSubscriptionAction() == pb.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE {
+				subs.lastPrices[uid] = struct{}{}
+			} else {
+				delete(subs.lastPrices, uid)
+			}
+			resp.LastPriceSubscriptions = append(resp.LastPriceSubscriptions, &pb.LastPriceSubscription{
+				Figi:               v.GetFigi(),
+				InstrumentUid:      uid,
+				SubscriptionStatus: s.subscriptionStatus(uid),
+			})
+		}
+		return &pb.MarketDataResponse{Payload: &pb.MarketDataResponse_SubscribeLastPriceResponse{SubscribeLastPriceResponse: resp}}
+	}
+
+	if r := req.GetSubscribeOrderBookRequest(); r != nil {
+		resp := &pb.SubscribeOrderBookResponse{TrackingId: uuid.NewString()}
+		for _, v := range r.GetInstruments() {
+			uid := s.m.resolveUid(v.GetInstrumentId(), v.GetFigi())
+			if r.GetSubscriptionAction() == pb.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE {
+				subs.orderBooks[uid] = v.GetDepth()
+			} else {
+				delete(subs.orderBooks, uid)
+			}
+			resp.OrderBookSubscriptions = append(resp.OrderBookSubscriptions, &pb.OrderBookSubscription{
+				Figi:               v.GetFigi(),
+				Depth:              v.GetDepth(),
+				InstrumentUid:      uid,
+				SubscriptionStatus: s.subscriptionStatus(uid),
+			})
+		}
+		return &pb.MarketDataResponse{Payload: &pb.MarketDataResponse_SubscribeOrderBookResponse{SubscribeOrderBookResponse: resp}}
+	}
+
+	if r := req.GetSubscribeCandlesRequest(); r != nil {
+		resp := &pb.SubscribeCandlesResponse{TrackingId: uuid.NewString()}
+		for _, v := range r.GetInstruments() {
+			uid := s.m.resolveUid(v.GetInstrumentId(), v.GetFigi())
+			if r.GetSubscriptionAction() == pb.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE {
+				if _, ok := subs.candles[uid]; !ok {
+					subs.candles[uid] = make(map[pb.SubscriptionInterval]struct{})
+				}
+				subs.candles[uid][v.GetInterval()] = struct{}{}
+			} else {
+				delete(subs.candles[uid], v.GetInterval())
+			}
+			resp.CandlesSubscriptions = append(resp.CandlesSubscriptions, &pb.CandleSubscription{
+				Figi:               v.GetFigi(),
+				Interval:           v.GetInterval(),
+				InstrumentUid:      uid,
+				SubscriptionStatus: s.subscriptionStatus(uid),
+			})
+		}
+		return &pb.MarketDataResponse{Payload: &pb.MarketDataResponse_SubscribeCandlesResponse{SubscribeCandlesResponse: resp}}
+	}
+
+	return nil
+}
+
+func (s *marketDataStreamService) subscriptionStatus(uid string) pb.SubscriptionStatus {
+	if _, ok := s.m.Instrument(uid); !ok {
+		return pb.SubscriptionStatus_SUBSCRIPTION_STATUS_INSTRUMENT_NOT_FOUND
+	}
+
+	return pb.SubscriptionStatus_SUBSCRIPTION_STATUS_SUCCESS
+}
+
+// handleTick makes responses for subscriptions of stream. Every tick closes
+// a candle of every subscribed interval, so bars go as fast as prices.
+func (s *marketDataStreamService) handleTick(subs *streamSubscriptions, tick *PriceTick) []*pb.MarketDataResponse {
+	var res []*pb.MarketDataResponse
+
+	if _, ok := subs.lastPrices[tick.Uid]; ok {
+		res = append(res, &pb.MarketDataResponse{Payload: &pb.MarketDataResponse_LastPrice{LastPrice: &pb.LastPrice{
+			Figi:          tick.Figi,
+			InstrumentUid: tick.Uid,
+			Price:         quotation(tick.Price),
+			Time:          timestamppb.New(tick.Time),
+		}}})
+	}
+
+	if depth, ok := subs.orderBooks[tick.Uid]; ok {
+		bids, asks, _ := s.m.OrderBook(tick.Uid, depth)
+		res = append(res, &pb.MarketDataResponse{Payload: &pb.MarketDataResponse_Orderbook{Orderbook: &pb.OrderBook{
+			Figi:          tick.Figi,
+			InstrumentUid: tick.Uid,
+			Depth:         depth,
+			IsConsistent:  true,
+			Bids:          orderBookLevels(bids),
+			Asks:          orderBookLevels(asks),
+			Time:          timestamppb.New(tick.Time),
+		}}})
+	}
+
+	prev, ok := subs.prevPrices[tick.Uid]
+	if !ok {
+		prev = tick.Price
+	}
+	subs.prevPrices[tick.Uid] = tick.Price
+
+	instr, _ := s.m.Instrument(tick.Uid)
+	for interval := range subs.candles[tick.Uid] {
+		res = append(res, &pb.MarketDataResponse{Payload: &pb.MarketDataResponse_Candle{Candle: &pb.Candle{
+			Figi:          tick.Figi,
+			InstrumentUid: tick.Uid,
+			Interval:      interval,
+			Open:          quotation(prev),
+			High:          quotation(max(prev, tick.Price)),
+			Low:           quotation(min(prev, tick.Price)),
+			Close:         quotation(tick.Price),
+			Volume:        instr.Volume,
+			Time:          timestamppb.New(tick.Time),
+			LastTradeTs:   timestamppb.New(tick.Time),
+		}}})
+	}
+
+	return res
+}
+
+type ordersService struct {
+	pb.UnimplementedOrdersServiceServer
+	m *Market
+}
+
+func (s *ordersService) PostOrder(_ context.Context, req *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
+	return postOrder(s.m, req)
+}
+
+func postOrder(m *Market, req *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
+	direction := ds.Buy
+	if req.GetDirection() == pb.OrderDirection_ORDER_DIRECTION_SELL {
+		direction = ds.Sell
+	}
+
+	isLimit := req.GetOrderType() == pb.OrderType_ORDER_TYPE_LIMIT
+	limitPrice := fromQuotation(req.GetPrice())
+
+	uid := m.resolveUid(req.GetInstrumentId(), req.GetFigi())
+
+	order, err := m.PostOrder(req.GetAccountId(), req.GetOrderId(), uid, direction, req.GetQuantity(), isLimit, limitPrice, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	currency := order.Instrument.Currency
+	amount := order.Instrument.Amount(order.Price, order.LotsExecuted)
+
+	return &pb.PostOrderResponse{
+		OrderId:               order.OrderId,
+		OrderRequestId:        order.RequestId,
+		ExecutionReportStatus: executionReportStatus(order.Status),
+		LotsRequested:         order.LotsRequested,
+		LotsExecuted:          order.LotsExecuted,
+		InitialOrderPrice:     money(order.LimitPrice, currency),
+		ExecutedOrderPrice:    money(order.Price, currency),
+		TotalOrderAmount:      money(amount, currency),
+		InitialCommission:     money(order.Commission, currency),
+		ExecutedCommission:    money(order.Commission, currency),
+		Figi:                  order.Instrument.Figi,
+		Direction:             req.GetDirection(),
+		OrderType:             req.GetOrderType(),
+		InstrumentUid:         order.Instrument.Uid,
+	}, nil
+}
+
+type ordersStreamService struct {
+	pb.UnimplementedOrdersStreamServiceServer
+	m *Market
+}
+
+func (s *ordersStreamService) OrderStateStream(req *pb.OrderStateStreamRequest, stream pb.OrdersStreamService_OrderStateStreamServer) error {
+	id, events := s.m.Subscribe()
+	defer s.m.Unsubscribe(id)
+
+	accounts := map[string]struct{}{}
+	for _, v := range req.GetAccounts() {
+		accounts[v] = struct{}{}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if e.Order == nil {
+				continue
+			}
+			if _, ok := accounts[e.Order.AccountId]; len(accounts) > 0 && !ok {
+				continue
+			}
+
+			if err := stream.Send(&pb.OrderStateStreamResponse{Payload: &pb.OrderStateStreamResponse_OrderState_{
+				OrderState: orderState(e.Order),
+			}}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func orderState(o *OrderState) *pb.OrderStateStreamResponse_OrderState {
+	direction := pb.OrderDirection_ORDER_DIRECTION_BUY
+	if o.Direction == ds.Sell {
+		direction = pb.OrderDirection_ORDER_DIRECTION_SELL
+	}
+
+	price := o.Price
+	if o.Status == ds.New {
+		price = o.LimitPrice
+	}
+
+	requestId := o.RequestId
+	state := &pb.OrderStateStreamResponse_OrderState{
+		OrderId:               o.OrderId,
+		OrderRequestId:        &requestId,
+		CreatedAt:             timestamppb.New(o.CreatedAt),
+		ExecutionReportStatus: executionReportStatus(o.Status),
+		Ticker:                o.Instrument.Ticker,
+		ClassCode:             o.Instrument.ClassCode,
+		LotSize:               o.Instrument.Lot,
+		Direction:             direction,
+		AccountId:             o.AccountId,
+		OrderPrice:            money(price, o.Instrument.Currency),
+		ExecutedOrderPrice:    money(o.Price, o.Instrument.Currency),
+		Currency:              o.Instrument.Currency,
+		LotsRequested:         o.LotsRequested,
+		LotsExecuted:          o.LotsExecuted,
+		LotsLeft:              o.LotsRequested - o.LotsExecuted,
+		Exchange:              o.Instrument.Exchange,
+		InstrumentUid:         o.Instrument.Uid,
+	}
+
+	if !o.CompletedAt.IsZero() {
+		state.CompletionTime = timestamppb.New(o.CompletedAt)
+	}
+
+	return state
+}
+
+type operationsService struct {
+	pb.UnimplementedOperationsServiceServer
+	m *Market
+}
+
+func (s *operationsService) GetPositions(_ context.Context, req *pb.PositionsRequest) (*pb.PositionsResponse, error) {
+	return positions(s.m, req.GetAccountId())
+}
+
+func positions(m *Market, accountId string) (*pb.PositionsResponse, error) {
+	acc, ok := m.Account(accountId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "not found account '%s'", accountId)
+	}
+
+	resp := &pb.PositionsResponse{Money: []*pb.MoneyValue{money(acc.Money, "rub")}}
+	for uid, balance := range acc.Positions {
+		instr, _ := m.Instrument(uid)
+		resp.Securities = append(resp.Securities, &pb.PositionsSecurities{
+			Figi:           instr.Figi,
+			InstrumentUid:  uid,
+			Balance:        balance,
+			InstrumentType: instr.Type,
+		})
+	}
+
+	return resp, nil
+}
+
+type usersService struct {
+	pb.UnimplementedUsersServiceServer
+	m *Market
+}
+
+func (s *usersService) GetAccounts(_ context.Context, _ *pb.GetAccountsRequest) (*pb.GetAccountsResponse, error) {
+	return accounts(s.m.Accounts(false)), nil
+}
+
+func accounts(list []*Account) *pb.GetAccountsResponse {
+	resp := &pb.GetAccountsResponse{}
+	for _, v := range list {
+		resp.Accounts = append(resp.Accounts, &pb.Account{
+			Id:          v.Id,
+			Name:        v.Name,
+			Type:        pb.AccountType_ACCOUNT_TYPE_TINKOFF,
+			Status:      pb.AccountStatus_ACCOUNT_STATUS_OPEN,
+			OpenedDate:  timestamppb.New(v.OpenedAt),
+			AccessLevel: pb.AccessLevel_ACCOUNT_ACCESS_LEVEL_FULL_ACCESS,
+		})
+	}
+
+	return resp
+}
+
+type sandboxService struct {
+	pb.UnimplementedSandboxServiceServer
+	m *Market
+}
+
+func (s *sandboxService) OpenSandboxAccount(_ context.Context, _ *pb.OpenSandboxAccountRequest) (*pb.OpenSandboxAccountResponse, error) {
+	return &pb.OpenSandboxAccountResponse{AccountId: s.m.OpenAccount(time.Now())}, nil
+}
+
+func (s *sandboxService) CloseSandboxAccount(_ context.Context, req *pb.CloseSandboxAccountRequest) (*pb.CloseSandboxAccountResponse, error) {
+	if err := s.m.CloseAccount(req.GetAccountId()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.CloseSandboxAccountResponse{}, nil
+}
+
+func (s *sandboxService) GetSandboxAccounts(_ context.Context, _ *pb.GetAccountsRequest) (*pb.GetAccountsResponse, error) {
+	return accounts(s.m.Accounts(true)), nil
+}
+
+func (s *sandboxService) SandboxPayIn(_ context.Context, req *pb.SandboxPayInRequest) (*pb.SandboxPayInResponse, error) {
+	balance, err := s.m.PayIn(req.GetAccountId(), fromMoney(req.GetAmount()))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.SandboxPayInResponse{Balance: money(balance, req.GetAmount().GetCurrency())}, nil
+}
+
+func (s *sandboxService) PostSandboxOrder(_ context.Context, req *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
+	return postOrder(s.m, req)
+}
+
+func (s *sandboxService) GetSandboxPositions(_ context.Context, req *pb.PositionsRequest) (*pb.PositionsResponse, error) {
+	return positions(s.m, req.GetAccountId())
+}
+
+func executionReportStatus(st ds.OrderStatus) pb.OrderExecutionReportStatus {
+	switch st {
+	case ds.Fill:
+		return pb.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_FILL
+	case ds.PartiallyFill:
+		return pb.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_PARTIALLYFILL
+	case ds.Cancelled:
+		return pb.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_CANCELLED
+	}
+
+	return pb.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_NEW
+}
+
+func orderBookLevels(levels []ds.OrderBookLevel) []*pb.Order {
+	res := make([]*pb.Order, 0, len(levels))
+	for _, v := range levels {
+		res = append(res, &pb.Order{
+			Price:    &pb.Quotation{Units: v.Price.Units, Nano: v.Price.Nano},
+			Quantity: v.Quantity,
+		})
+	}
+
+	return res
+}
+
+func quotation(v float64) *pb.Quotation {
+	q := ds.Quotation{}
+	q.FromFloat64(v)
+	return &pb.Quotation{Units: q.Units, Nano: q.Nano}
+}
+
+func money(v float64, currency string) *pb.MoneyValue {
+	q := quotation(v)
+	return &pb.MoneyValue{Currency: currency, Units: q.Units, Nano: q.Nano}
+}
+
+func fromQuotation(q *pb.Quotation) float64 {
+	v := ds.Quotation{Units: q.GetUnits(), Nano: q.GetNano()}
+	return v.ToFloat64()
+}
+
+func fromMoney(m *pb.MoneyValue) float64 {
+	v := ds.Quotation{Units: m.GetUnits(), Nano: m.GetNano()}
+	return v.ToFloat64()
+}
@@ -0,0 +1,409 @@
+package paper
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+	"trading_bot/internal/supports"
+
+	"github.com/google/uuid"
+)
+
+type IMarketData interface {
+	FindInstrument(identifier string) (*ds.InstrumentInfo, error)
+	FindFutures(basicAsset string) ([]*ds.InstrumentInfo, error)
+	RecieveLastPrice(ctx context.Context, instrInfo *ds.InstrumentInfo) (*ds.LastPrice, error)
+	RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error
+	UnregisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error
+	RegisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error
+	UnregisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error
+	RecieveOrderBook(ctx context.Context, instrInfo *ds.InstrumentInfo, depth int32) (*ds.OrderBook, error)
+	RegisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error
+	UnregisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error
+	RecieveCandle(ctx context.Context, instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) (*ds.Candle, error)
+	GetTradingAvailability(instrInfo *ds.InstrumentInfo) (ds.TradingAvailability, error)
+	GetTradingSession(instrInfo *ds.InstrumentInfo) (ds.TradingSession, error)
+}
+
+type IStorage interface {
+	GetPosition(accountId string, instrInfo *ds.InstrumentInfo) (*ds.Position, error)
+	UpdatePosition(pos *ds.Position) error
+}
+
+type PaperCfg struct {
+	SlippagePercent   float64
+	CommissionPercent float64
+	Latency           time.Duration
+	OrderBookDepth    int32
+	// BaseCurrency is currency of realized pnl summed over instruments of different currencies
+	BaseCurrency string
+}
+
+type orderBookWatcher struct {
+	instrInfo *ds.InstrumentInfo
+	cancel    func()
+}
+
+// PaperBroker takes market data from real broker and simulates orders execution locally
+type PaperBroker struct {
+	IMarketData
+	sync.RWMutex
+
+	ctx     context.Context
+	cfg     *PaperCfg
+	storage IStorage
+	logger  trader.ILogger
+
+	// positions keeps check of held lots and fill of position atomic
+	positions sync.Mutex
+
+	lastPrices  map[string]float64
+	orderBooks  map[string]*ds.OrderBook
+	watchers    map[uuid.UUID]*orderBookWatcher
+	ordersInput map[uuid.UUID]chan *ds.Order
+}
+
+func NewPaperBroker(ctx context.Context, md IMarketData, storage IStorage, l trader.ILogger, cfg *PaperCfg) *PaperBroker {
+	return &PaperBroker{
+		IMarketData: md,
+		ctx:         ctx,
+		cfg:         cfg,
+		storage:     storage,
+		logger:      l,
+		lastPrices:  make(map[string]float64),
+		orderBooks:  make(map[string]*ds.OrderBook),
+		watchers:    make(map[uuid.UUID]*orderBookWatcher),
+		ordersInput: make(map[uuid.UUID]chan *ds.Order),
+	}
+}
+
+func (b *PaperBroker) RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
+	if err := b.IMarketData.RegisterLastPriceRecipient(instrInfo); err != nil {
+		return err
+	}
+
+	if b.cfg.OrderBookDepth <= 0 {
+		return nil
+	}
+
+	// separate instance keeps order book of strategy untouched
+	watched := *instrInfo
+	watched.InstanceId = uuid.New()
+
+	if err := b.IMarketData.RegisterOrderBookRecipient(&watched, b.cfg.OrderBookDepth); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(b.ctx)
+
+	b.Lock()
+	b.watchers[instrInfo.InstanceId] = &orderBookWatcher{instrInfo: &watched, cancel: cancel}
+	b.Unlock()
+
+	go b.watchOrderBook(ctx, &watched)
+
+	return nil
+}
+
+func (b *PaperBroker) UnregisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
+	b.Lock()
+	w, ok := b.watchers[instrInfo.InstanceId]
+	delete(b.watchers, instrInfo.InstanceId)
+	b.Unlock()
+
+	if ok {
+		w.cancel()
+		if err := b.IMarketData.UnregisterOrderBookRecipient(w.instrInfo, b.cfg.OrderBookDepth); err != nil {
+			b.logger.ErrorfKV("failed unregister order book recipient",
+				ds.HistoryColInstrumentUID, instrInfo.Uid, ds.HistoryColError, err.Error())
+		}
+	}
+
+	return b.IMarketData.UnregisterLastPriceRecipient(instrInfo)
+}
+
+func (b *PaperBroker) watchOrderBook(ctx context.Context, instrInfo *ds.InstrumentInfo) {
+	for {
+		ob, err := b.IMarketData.RecieveOrderBook(ctx, instrInfo, b.cfg.OrderBookDepth)
+		if err != nil {
+			return
+		}
+
+		b.Lock()
+		b.orderBooks[instrInfo.Uid] = ob
+		b.Unlock()
+	}
+}
+
+func (b *PaperBroker) RecieveLastPrice(ctx context.Context, instrInfo *ds.InstrumentInfo) (*ds.LastPrice, error) {
+	lp, err := b.IMarketData.RecieveLastPrice(ctx, instrInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Lock()
+	b.lastPrices[instrInfo.Uid] = lp.Price.ToFloat64()
+	b.Unlock()
+
+	return lp, nil
+}
+
+func (b *PaperBroker) RegisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.ordersInput[instrInfo.InstanceId]; !ok {
+		b.ordersInput[instrInfo.InstanceId] = make(chan *ds.Order, 100)
+	}
+
+	return nil
+}
+
+func (b *PaperBroker) UnregisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if ch, ok := b.ordersInput[instrInfo.InstanceId]; ok {
+		supports.CloseIfMaybeClosed(ch)
+	}
+	delete(b.ordersInput, instrInfo.InstanceId)
+
+	return nil
+}
+
+func (b *PaperBroker) RecieveOrdersUpdate(ctx context.Context, instrInfo *ds.InstrumentInfo, accountId string) (*ds.Order, error) {
+	b.RLock()
+	ch := b.ordersInput[instrInfo.InstanceId]
+	b.RUnlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("recieving orders update context done for %s", instrInfo.Ticker)
+	case order, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("paper orders closed for %s", instrInfo.Ticker)
+		}
+		return order, nil
+	}
+}
+
+func (b *PaperBroker) MakeBuyOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	if lots < 1 {
+		return nil, fmt.Errorf("incorrect lots to make order: %d", lots)
+	}
+
+	return b.execute(instrInfo, ds.Buy, lots, requestId, accountId)
+}
+
+func (b *PaperBroker) MakeSellOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	if lots < 1 {
+		return nil, fmt.Errorf("incorrect lots to make order: %d", lots)
+	}
+
+	return b.execute(instrInfo, ds.Sell, lots, requestId, accountId)
+}
+
+func (b *PaperBroker) execute(instrInfo *ds.InstrumentInfo, direction ds.Action, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	createdAt := time.Now()
+
+	// order reaches exchange after latency, so the price is taken after it
+	supports.WaitFor(b.ctx, b.cfg.Latency)
+
+	b.RLock()
+	lastPrice, hasPrice := b.lastPrices[instrInfo.Uid]
+	ob := b.orderBooks[instrInfo.Uid]
+	ch := b.ordersInput[instrInfo.InstanceId]
+	b.RUnlock()
+
+	if !hasPrice {
+		return nil, fmt.Errorf("no price to execute paper order for %s", instrInfo.Ticker)
+	}
+
+	price := fillPrice(direction, lots, lastPrice, ob, b.cfg.SlippagePercent/100)
+	commission := instrInfo.LotsCost(price, lots) * b.cfg.CommissionPercent / 100
+
+	if err := b.updatePosition(accountId, instrInfo, direction, lots, price, commission); err != nil {
+		return nil, err
+	}
+
+	completedAt := time.Now()
+
+	orderPrice := ds.Quotation{}
+	orderPrice.FromFloat64(price)
+
+	commissionQuotation := ds.Quotation{}
+	commissionQuotation.FromFloat64(commission)
+
+	order := &ds.Order{
+		CreatedAt:             &createdAt,
+		CompletionTime:        &completedAt,
+		OrderId:               requestId,
+		Direction:             direction.ToString(),
+		ExecutionReportStatus: ds.Fill.ToString(),
+		OrderPrice:            orderPrice,
+		LotsRequested:         lots,
+		LotsExecuted:          lots,
+		InstrumentUid:         instrInfo.Uid,
+	}
+
+	if ch != nil {
+		if err := supports.SendIfMaybeClosed(ch, order); err != nil {
+			b.logger.ErrorfKV("failed sending paper order state", ds.HistoryColError, err.Error())
+		}
+	}
+
+	return &ds.PostOrderResult{
+		ExecutedCommission:    commissionQuotation,
+		ExecutedOrderPrice:    orderPrice,
+		InstrumentUid:         instrInfo.Uid,
+		ExecutionReportStatus: ds.Fill.ToString(),
+		OrderId:               requestId,
+		LotsExecuted:          lots,
+	}, nil
+}
+
+func (b *PaperBroker) updatePosition(accountId string, instrInfo *ds.InstrumentInfo, direction ds.Action,
+	lots int64, price, commission float64) error {
+	b.positions.Lock()
+	defer b.positions.Unlock()
+
+	pos, err := b.storage.GetPosition(accountId, instrInfo)
+	if err != nil {
+		return fmt.Errorf("failed getting paper position: %s", err.Error())
+	}
+
+	if direction == ds.Sell && lots > pos.Lots {
+		return fmt.Errorf("not enough lots to sell: %d, held: %d", lots, pos.Lots)
+	}
+
+	realized := applyFill(pos, direction, lots, instrInfo, price, instrInfo.AccruedInterest(time.Now()), commission)
+	if err := b.addRealizedBase(pos, realized); err != nil {
+		b.logger.ErrorfKV("failed converting paper pnl to base currency",
+			ds.HistoryColInstrumentUID, instrInfo.Uid, ds.HistoryColError, err.Error())
+	}
+	pos.UpdatedAt = time.Now()
+
+	if err := b.storage.UpdatePosition(pos); err != nil {
+		return fmt.Errorf("failed updating paper position: %s", err.Error())
+	}
+
+	return nil
+}
+
+// addRealizedBase adds realized pnl of fill to pnl in base currency with current rates.
+// Pnl kept in previous base currency is converted too, so changing base currency does not mix them.
+func (b *PaperBroker) addRealizedBase(pos *ds.Position, realized ds.Money) error {
+	base := ds.NormalizeCurrency(b.cfg.BaseCurrency)
+	total := ds.Money{Amount: pos.RealizedPnlBase, Currency: ds.NormalizeCurrency(pos.BaseCurrency)}
+
+	rates := ds.ExchangeRates{}
+	if realized.Currency != base || total.Currency != base {
+		var err error
+		if rates, err = b.GetExchangeRates(realized.Currency, total.Currency, base); err != nil {
+			return err
+		}
+	}
+
+	total, err := rates.Convert(total, base)
+	if err != nil {
+		return err
+	}
+
+	delta, err := rates.Convert(realized, base)
+	if err != nil {
+		return err
+	}
+
+	if total, err = total.Add(delta); err != nil {
+		return err
+	}
+
+	pos.RealizedPnlBase, pos.BaseCurrency = total.Amount, total.Currency
+
+	return nil
+}
+
+// GetExchangeRates takes rates from market data broker
+func (b *PaperBroker) GetExchangeRates(currencies ...string) (ds.ExchangeRates, error) {
+	rates, ok := b.IMarketData.(trader.IExchangeRates)
+	if !ok {
+		return nil, fmt.Errorf("market data has no exchange rates")
+	}
+
+	return rates.GetExchangeRates(currencies...)
+}
+
+// fillPrice walks through order book levels for requested lots. When order book
+// is not available or not enough deep, last price and the worst level are used.
+// Slippage is applied against direction of the order.
+func fillPrice(direction ds.Action, lots int64, lastPrice float64, ob *ds.OrderBook, slippage float64) float64 {
+	price := lastPrice
+
+	var levels []ds.OrderBookLevel
+	if ob != nil && ob.IsConsistent {
+		levels = ob.Asks
+		if direction == ds.Sell {
+			levels = ob.Bids
+		}
+	}
+
+	if len(levels) > 0 {
+		var sum float64
+		rest := lots
+		for _, v := range levels {
+			if rest == 0 {
+				break
+			}
+			filled := min(rest, v.Quantity)
+			sum += float64(filled) * v.Price.ToFloat64()
+			rest -= filled
+		}
+		if rest > 0 {
+			sum += float64(rest) * levels[len(levels)-1].Price.ToFloat64()
+		}
+		price = sum / float64(lots)
+	}
+
+	if direction == ds.Buy {
+		price *= 1 + slippage
+	} else {
+		price *= 1 - slippage
+	}
+
+	return math.Round(price*1e9) / 1e9
+}
+
+// applyFill updates position with filled order and returns pnl realized by it.
+// Accrued interest of bond is paid on buy and recieved on sell.
+func applyFill(pos *ds.Position, direction ds.Action, lots int64, instrInfo *ds.InstrumentInfo, price, aci, commission float64) ds.Money {
+	avg := pos.AveragePrice.ToFloat64()
+	pnl := pos.RealizedPnl.ToFloat64()
+	aciAmount := aci * float64(lots) * float64(instrInfo.Lot)
+
+	if direction == ds.Buy {
+		if pos.Lots+lots != 0 {
+			avg = (avg*float64(pos.Lots) + price*float64(lots)) / float64(pos.Lots+lots)
+		}
+		pos.Lots += lots
+		pnl -= aciAmount
+	} else {
+		pnl += instrInfo.LotsCost(price-avg, lots) + aciAmount
+		pos.Lots -= lots
+		if pos.Lots == 0 {
+			avg = 0
+		}
+	}
+
+	realized := ds.NewMoney(pnl-commission-pos.RealizedPnl.ToFloat64(), instrInfo.Currency)
+
+	pos.Currency = realized.Currency
+	pos.AveragePrice.FromFloat64(avg)
+	pos.RealizedPnl.FromFloat64(pnl - commission)
+	pos.Commission.FromFloat64(pos.Commission.ToFloat64() + commission)
+
+	return realized
+}
@@ -0,0 +1,161 @@
+package paper
+
+import (
+	"context"
+	"testing"
+
+	ds "trading_bot/internal/service/datastruct"
+
+	"github.com/stretchr/testify/require"
+)
+
+func level(price float64, quantity int64) ds.OrderBookLevel {
+	l := ds.OrderBookLevel{Quantity: quantity}
+	l.Price.FromFloat64(price)
+	return l
+}
+
+func TestFillPrice(t *testing.T) {
+	t.Parallel()
+
+	ob := &ds.OrderBook{
+		IsConsistent: true,
+		Bids:         []ds.OrderBookLevel{level(99, 2), level(98, 2)},
+		Asks:         []ds.OrderBookLevel{level(101, 2), level(102, 2)},
+	}
+
+	t.Run("last price without order book", func(t *testing.T) {
+		t.Parallel()
+
+		require.InDelta(t, 100.0, fillPrice(ds.Buy, 5, 100, nil, 0), 1e-9)
+		require.InDelta(t, 101.0, fillPrice(ds.Buy, 5, 100, nil, 0.01), 1e-9)
+		require.InDelta(t, 99.0, fillPrice(ds.Sell, 5, 100, nil, 0.01), 1e-9)
+	})
+
+	t.Run("walks order book", func(t *testing.T) {
+		t.Parallel()
+
+		require.InDelta(t, 101.5, fillPrice(ds.Buy, 4, 100, ob, 0), 1e-9)
+		require.InDelta(t, 98.5, fillPrice(ds.Sell, 4, 100, ob, 0), 1e-9)
+	})
+
+	t.Run("not enough depth", func(t *testing.T) {
+		t.Parallel()
+
+		require.InDelta(t, (101.0*2+102.0*4)/6, fillPrice(ds.Buy, 6, 100, ob, 0), 1e-9)
+	})
+
+	t.Run("inconsistent order book", func(t *testing.T) {
+		t.Parallel()
+
+		inconsistent := *ob
+		inconsistent.IsConsistent = false
+		require.InDelta(t, 100.0, fillPrice(ds.Buy, 4, 100, &inconsistent, 0), 1e-9)
+	})
+}
+
+func TestApplyFill(t *testing.T) {
+	t.Parallel()
+
+	pos := &ds.Position{}
+	instrInfo := &ds.InstrumentInfo{Lot: 10}
+
+	applyFill(pos, ds.Buy, 2, instrInfo, 100, 0, 1)
+	applyFill(pos, ds.Buy, 2, instrInfo, 110, 0, 1)
+	require.Equal(t, int64(4), pos.Lots)
+	require.InDelta(t, 105.0, pos.AveragePrice.ToFloat64(), 1e-9)
+
+	applyFill(pos, ds.Sell, 4, instrInfo, 115, 0, 2)
+	require.Equal(t, int64(0), pos.Lots)
+	require.InDelta(t, 0.0, pos.AveragePrice.ToFloat64(), 1e-9)
+	require.InDelta(t, 400.0-4, pos.RealizedPnl.ToFloat64(), 1e-9)
+	require.InDelta(t, 4.0, pos.Commission.ToFloat64(), 1e-9)
+	require.Equal(t, ds.CurrencyRub, pos.Currency)
+}
+
+func TestApplyFillBond(t *testing.T) {
+	t.Parallel()
+
+	pos := &ds.Position{}
+	bond := &ds.InstrumentInfo{Type: ds.InstrumentTypeBond, Lot: 1}
+	bond.Nominal.FromFloat64(1000)
+
+	// bought at 98% with 10 of accrued interest, sold at 99% with 15
+	applyFill(pos, ds.Buy, 2, bond, 98, 10, 0)
+	applyFill(pos, ds.Sell, 2, bond, 99, 15, 0)
+	require.InDelta(t, 20.0+10, pos.RealizedPnl.ToFloat64(), 1e-9)
+}
+
+type testStorage struct {
+	pos *ds.Position
+}
+
+func (s *testStorage) GetPosition(accountId string, instrInfo *ds.InstrumentInfo) (*ds.Position, error) {
+	return s.pos, nil
+}
+
+func (s *testStorage) UpdatePosition(pos *ds.Position) error {
+	s.pos = pos
+	return nil
+}
+
+func TestOversell(t *testing.T) {
+	t.Parallel()
+
+	instrInfo := &ds.InstrumentInfo{Uid: "uid", Lot: 1}
+	storage := &testStorage{pos: &ds.Position{}}
+	b := NewPaperBroker(context.Background(), nil, storage, nil, &PaperCfg{})
+	b.lastPrices[instrInfo.Uid] = 100
+
+	_, err := b.MakeSellOrder(instrInfo, 1, "sell1", "acc")
+	require.Error(t, err)
+
+	_, err = b.MakeBuyOrder(instrInfo, 2, "buy", "acc")
+	require.NoError(t, err)
+	_, err = b.MakeSellOrder(instrInfo, 3, "sell2", "acc")
+	require.Error(t, err)
+
+	require.Equal(t, int64(2), storage.pos.Lots)
+	require.InDelta(t, 100.0, storage.pos.AveragePrice.ToFloat64(), 1e-9)
+	require.InDelta(t, 0.0, storage.pos.RealizedPnl.ToFloat64(), 1e-9)
+}
+
+type testRates struct {
+	IMarketData
+	rates ds.ExchangeRates
+}
+
+func (r *testRates) GetExchangeRates(currencies ...string) (ds.ExchangeRates, error) {
+	return r.rates, nil
+}
+
+func TestRealizedPnlBase(t *testing.T) {
+	t.Parallel()
+
+	instrInfo := &ds.InstrumentInfo{Uid: "uid", Lot: 1, Currency: "usd"}
+	storage := &testStorage{pos: &ds.Position{}}
+	md := &testRates{rates: ds.ExchangeRates{"usd": 90}}
+	b := NewPaperBroker(context.Background(), md, storage, nil, &PaperCfg{})
+
+	b.lastPrices[instrInfo.Uid] = 100
+	_, err := b.MakeBuyOrder(instrInfo, 2, "buy", "acc")
+	require.NoError(t, err)
+
+	b.lastPrices[instrInfo.Uid] = 110
+	md.rates["usd"] = 100
+	_, err = b.MakeSellOrder(instrInfo, 2, "sell", "acc")
+	require.NoError(t, err)
+
+	// pnl is converted with the rate of the fill which realized it
+	require.Equal(t, "usd", storage.pos.Currency)
+	require.InDelta(t, 20.0, storage.pos.RealizedPnl.ToFloat64(), 1e-9)
+	require.Equal(t, ds.CurrencyRub, storage.pos.BaseCurrency)
+	require.InDelta(t, 2000.0, storage.pos.RealizedPnlBase.ToFloat64(), 1e-9)
+
+	// pnl in the previous base currency is converted as well
+	b.cfg.BaseCurrency = "usd"
+	_, err = b.MakeBuyOrder(instrInfo, 1, "buy2", "acc")
+	require.NoError(t, err)
+	require.Equal(t, "usd", storage.pos.BaseCurrency)
+	require.InDelta(t, 20.0, storage.pos.RealizedPnlBase.ToFloat64(), 1e-9)
+}
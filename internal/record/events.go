@@ -0,0 +1,154 @@
+package record
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+)
+
+type EventType string
+
+const (
+	EventInstrument EventType = "instrument"
+	EventLastPrice  EventType = "last_price"
+	EventCandle     EventType = "candle"
+	EventOrder      EventType = "order"
+)
+
+type Format int
+
+const (
+	FormatJSONL Format = iota
+	FormatBinary
+)
+
+// Event is one market data update as the bot recieved it
+type Event struct {
+	Type       EventType          `json:"type"`
+	Time       time.Time          `json:"time"`
+	Uid        string             `json:"uid"`
+	AccountId  string             `json:"account_id,omitempty"`
+	Interval   ds.CandleInterval  `json:"interval,omitempty"`
+	Instrument *ds.InstrumentInfo `json:"instrument,omitempty"`
+	LastPrice  *ds.LastPrice      `json:"last_price,omitempty"`
+	Candle     *ds.Candle         `json:"candle,omitempty"`
+	Order      *ds.Order          `json:"order,omitempty"`
+}
+
+type encoder interface {
+	Encode(v any) error
+}
+
+type decoder interface {
+	Decode(v any) error
+}
+
+// FormatFromPath resolves format by file extension: '.bin' is binary, others are JSONL.
+// Extra '.gz' extension means the file is compressed.
+func FormatFromPath(path string) (format Format, compressed bool) {
+	compressed = strings.HasSuffix(path, ".gz")
+	path = strings.TrimSuffix(path, ".gz")
+
+	if strings.HasSuffix(path, ".bin") {
+		return FormatBinary, compressed
+	}
+
+	return FormatJSONL, compressed
+}
+
+type Writer struct {
+	f   *os.File
+	gz  *gzip.Writer
+	enc encoder
+}
+
+func NewWriter(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{f: f}
+
+	var out io.Writer = f
+	format, compressed := FormatFromPath(path)
+	if compressed {
+		w.gz = gzip.NewWriter(f)
+		out = w.gz
+	}
+
+	if format == FormatBinary {
+		w.enc = gob.NewEncoder(out)
+	} else {
+		w.enc = json.NewEncoder(out)
+	}
+
+	return w, nil
+}
+
+func (w *Writer) Write(e *Event) error {
+	return w.enc.Encode(e)
+}
+
+func (w *Writer) Close() error {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+
+	return w.f.Close()
+}
+
+func ReadEvents(path string) ([]*Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var in io.Reader = f
+	format, compressed := FormatFromPath(path)
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	var dec decoder
+	if format == FormatBinary {
+		dec = gob.NewDecoder(in)
+	} else {
+		dec = json.NewDecoder(in)
+	}
+
+	var events []*Event
+	for {
+		e := &Event{}
+		err := dec.Decode(e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		// the last event may be cut when the bot was killed
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed decoding event %d: %s", len(events), err.Error())
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
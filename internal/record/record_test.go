@@ -0,0 +1,159 @@
+package record
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func lastPrice(price float64, t time.Time) *ds.LastPrice {
+	lp := &ds.LastPrice{Uid: "uid", Time: t}
+	lp.Price.FromFloat64(price)
+	return lp
+}
+
+func TestWriterReader(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	events := []*Event{
+		{Type: EventInstrument, Time: now, Uid: "uid", Instrument: &ds.InstrumentInfo{Uid: "uid", Ticker: "TICK", Lot: 10}},
+		{Type: EventLastPrice, Time: now, Uid: "uid", LastPrice: lastPrice(100.5, now)},
+		{Type: EventCandle, Time: now, Uid: "uid", Interval: ds.Interval_5_Min, Candle: &ds.Candle{Timestamp: now, Volume: 7}},
+		{Type: EventOrder, Time: now, Uid: "uid", AccountId: "acc", Order: &ds.Order{OrderId: "order", LotsExecuted: 2}},
+	}
+
+	for _, name := range []string{"events.jsonl", "events.bin", "events.jsonl.gz", "events.bin.gz"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), name)
+
+			w, err := NewWriter(path)
+			require.NoError(t, err)
+			for _, e := range events {
+				require.NoError(t, w.Write(e))
+			}
+			require.NoError(t, w.Close())
+
+			read, err := ReadEvents(path)
+			require.NoError(t, err)
+			require.Len(t, read, len(events))
+			for i := range events {
+				require.Equal(t, events[i].Type, read[i].Type)
+				require.True(t, events[i].Time.Equal(read[i].Time))
+			}
+			require.Equal(t, "TICK", read[0].Instrument.Ticker)
+			require.InDelta(t, 100.5, read[1].LastPrice.Price.ToFloat64(), 1e-9)
+			require.Equal(t, ds.Interval_5_Min, read[2].Interval)
+			require.Equal(t, int64(2), read[3].Order.LotsExecuted)
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	mc := gomock.NewController(t)
+	broker := trader.NewMockIBroker(mc)
+	logger := trader.NewMockILogger(mc)
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	w, err := NewWriter(path)
+	require.NoError(t, err)
+
+	r := NewRecorder(broker, w, logger)
+
+	now := time.Now()
+	instrInfo := &ds.InstrumentInfo{Uid: "uid", Ticker: "TICK"}
+
+	broker.EXPECT().FindInstrument("uid").Return(instrInfo, nil).Times(2)
+	broker.EXPECT().RecieveLastPrice(gomock.Any(), instrInfo).Return(lastPrice(100, now), nil).Times(2)
+	broker.EXPECT().RecieveLastPrice(gomock.Any(), instrInfo).Return(lastPrice(101, now.Add(time.Second)), nil)
+
+	_, err = r.FindInstrument("uid")
+	require.NoError(t, err)
+	_, err = r.FindInstrument("uid")
+	require.NoError(t, err)
+
+	// the same price recieved by two traders is written once
+	for range 3 {
+		_, err := r.RecieveLastPrice(context.Background(), instrInfo)
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	events, err := ReadEvents(path)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, EventInstrument, events[0].Type)
+	require.InDelta(t, 100.0, events[1].LastPrice.Price.ToFloat64(), 1e-9)
+	require.InDelta(t, 101.0, events[2].LastPrice.Price.ToFloat64(), 1e-9)
+}
+
+func TestReplayBroker(t *testing.T) {
+	t.Parallel()
+
+	mc := gomock.NewController(t)
+	logger := trader.NewMockILogger(mc)
+	logger.EXPECT().InfofKV(gomock.Any(), gomock.Any()).AnyTimes()
+
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "events.bin")
+	w, err := NewWriter(path)
+	require.NoError(t, err)
+	for _, e := range []*Event{
+		{Type: EventInstrument, Time: now, Uid: "uid", Instrument: &ds.InstrumentInfo{Uid: "uid", Ticker: "TICK", Lot: 10}},
+		{Type: EventLastPrice, Time: now, Uid: "uid", LastPrice: lastPrice(100, now)},
+		{Type: EventOrder, Time: now, Uid: "uid", AccountId: "acc", Order: &ds.Order{OrderId: "recorded"}},
+		{Type: EventLastPrice, Time: now.Add(time.Second), Uid: "uid", LastPrice: lastPrice(102, now)},
+	} {
+		require.NoError(t, w.Write(e))
+	}
+	require.NoError(t, w.Close())
+
+	b, err := NewReplayBroker(path, logger, &ReplayCfg{CommissionPercent: 1})
+	require.NoError(t, err)
+
+	instrInfo, err := b.FindInstrument("TICK")
+	require.NoError(t, err)
+	instrInfo.InstanceId = uuid.New()
+
+	_, err = b.FindInstrument("unknown")
+	require.Error(t, err)
+
+	require.NoError(t, b.RegisterLastPriceRecipient(instrInfo))
+	require.NoError(t, b.RegisterOrderStateRecipient(instrInfo, "acc"))
+
+	ctx := context.Background()
+	b.Start(ctx)
+
+	lp, err := b.RecieveLastPrice(ctx, instrInfo)
+	require.NoError(t, err)
+	require.InDelta(t, 100.0, lp.Price.ToFloat64(), 1e-9)
+
+	res, err := b.MakeBuyOrder(instrInfo, 2, "request", "acc")
+	require.NoError(t, err)
+	require.InDelta(t, 100.0, res.ExecutedOrderPrice.ToFloat64(), 1e-9)
+	require.InDelta(t, 20.0, res.ExecutedCommission.ToFloat64(), 1e-9)
+
+	// recorded orders are skipped, only states of orders made on replay come
+	order, err := b.RecieveOrdersUpdate(ctx, instrInfo, "acc")
+	require.NoError(t, err)
+	require.Equal(t, "request", order.OrderId)
+
+	lp, err = b.RecieveLastPrice(ctx, instrInfo)
+	require.NoError(t, err)
+	require.InDelta(t, 102.0, lp.Price.ToFloat64(), 1e-9)
+
+	<-b.Done()
+	_, err = b.RecieveLastPrice(ctx, instrInfo)
+	require.Error(t, err)
+}
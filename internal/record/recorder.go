@@ -0,0 +1,124 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+)
+
+// Recorder writes every event recieved from broker. The same update recieved by several
+// traders of one instrument is written once.
+type Recorder struct {
+	trader.IBroker
+	sync.Mutex
+
+	w        *Writer
+	logger   trader.ILogger
+	lastKeys map[string]string
+}
+
+func NewRecorder(b trader.IBroker, w *Writer, l trader.ILogger) *Recorder {
+	return &Recorder{
+		IBroker:  b,
+		w:        w,
+		logger:   l,
+		lastKeys: make(map[string]string),
+	}
+}
+
+func (r *Recorder) FindInstrument(identifier string) (*ds.InstrumentInfo, error) {
+	instrInfo, err := r.IBroker.FindInstrument(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(string(EventInstrument)+instrInfo.Uid, instrInfo.Uid, &Event{
+		Type:       EventInstrument,
+		Uid:        instrInfo.Uid,
+		Instrument: instrInfo,
+	})
+
+	return instrInfo, nil
+}
+
+func (r *Recorder) RecieveLastPrice(ctx context.Context, instrInfo *ds.InstrumentInfo) (*ds.LastPrice, error) {
+	lp, err := r.IBroker.RecieveLastPrice(ctx, instrInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(string(EventLastPrice)+instrInfo.Uid, fmt.Sprintf("%d%s", lp.Time.UnixNano(), lp.Price.ToString()), &Event{
+		Type:      EventLastPrice,
+		Uid:       instrInfo.Uid,
+		LastPrice: lp,
+	})
+
+	return lp, nil
+}
+
+func (r *Recorder) RecieveCandle(ctx context.Context, instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) (*ds.Candle, error) {
+	candle, err := r.IBroker.RecieveCandle(ctx, instrInfo, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(fmt.Sprintf("%s%s%d", EventCandle, instrInfo.Uid, interval), fmt.Sprintf("%d", candle.Timestamp.UnixNano()), &Event{
+		Type:     EventCandle,
+		Uid:      instrInfo.Uid,
+		Interval: interval,
+		Candle:   candle,
+	})
+
+	return candle, nil
+}
+
+func (r *Recorder) RecieveOrdersUpdate(ctx context.Context, instrInfo *ds.InstrumentInfo, accountId string) (*ds.Order, error) {
+	order, err := r.IBroker.RecieveOrdersUpdate(ctx, instrInfo, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(string(EventOrder)+order.OrderId, fmt.Sprintf("%s%d", order.ExecutionReportStatus, order.LotsExecuted), &Event{
+		Type:      EventOrder,
+		Uid:       instrInfo.Uid,
+		AccountId: accountId,
+		Order:     order,
+	})
+
+	return order, nil
+}
+
+// GetExchangeRates passes rates of wrapped broker, they are not recorded
+func (r *Recorder) GetExchangeRates(currencies ...string) (ds.ExchangeRates, error) {
+	rates, ok := r.IBroker.(trader.IExchangeRates)
+	if !ok {
+		return nil, fmt.Errorf("broker has no exchange rates")
+	}
+
+	return rates.GetExchangeRates(currencies...)
+}
+
+func (r *Recorder) record(key, value string, e *Event) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.lastKeys[key] == value {
+		return
+	}
+	r.lastKeys[key] = value
+
+	e.Time = time.Now()
+	if err := r.w.Write(e); err != nil {
+		r.logger.ErrorfKV("failed recording event", ds.HistoryColInstrumentUID, e.Uid, ds.HistoryColError, err.Error())
+	}
+}
+
+func (r *Recorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.w.Close()
+}
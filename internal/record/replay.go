@@ -0,0 +1,438 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	ds "trading_bot/internal/service/datastruct"
+	"trading_bot/internal/service/trader"
+	"trading_bot/internal/supports"
+
+	"github.com/google/uuid"
+)
+
+const recipientBuffer = 100
+
+type ReplayCfg struct {
+	// Speed multiplies original pace of events, zero replays as fast as recipients read
+	Speed             float64
+	CommissionPercent float64
+	// ReplayOrders feeds recorded order states instead of states of orders made on replay
+	ReplayOrders bool
+}
+
+type orderRecipient struct {
+	accountId string
+	ch        chan *ds.Order
+}
+
+// ReplayBroker feeds recorded events back to traders. Orders are filled
+// with the last price the trader recieved.
+type ReplayBroker struct {
+	sync.RWMutex
+
+	cfg    *ReplayCfg
+	logger trader.ILogger
+	events []*Event
+	done   chan struct{}
+
+	instruments     map[string]*ds.InstrumentInfo
+	lastSeen        map[uuid.UUID]float64
+	lastPriceInput  map[string]map[uuid.UUID]chan *ds.LastPrice
+	candleInput     map[string]map[ds.CandleInterval]map[uuid.UUID]chan *ds.Candle
+	orderStateInput map[string]map[uuid.UUID]*orderRecipient
+}
+
+func NewReplayBroker(path string, l trader.ILogger, cfg *ReplayCfg) (*ReplayBroker, error) {
+	events, err := ReadEvents(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading events: %s", err.Error())
+	}
+
+	b := &ReplayBroker{
+		cfg:             cfg,
+		logger:          l,
+		done:            make(chan struct{}),
+		instruments:     make(map[string]*ds.InstrumentInfo),
+		lastSeen:        make(map[uuid.UUID]float64),
+		lastPriceInput:  make(map[string]map[uuid.UUID]chan *ds.LastPrice),
+		candleInput:     make(map[string]map[ds.CandleInterval]map[uuid.UUID]chan *ds.Candle),
+		orderStateInput: make(map[string]map[uuid.UUID]*orderRecipient),
+	}
+
+	for _, e := range events {
+		if e.Type == EventInstrument && e.Instrument != nil {
+			b.instruments[e.Uid] = e.Instrument
+			continue
+		}
+		b.events = append(b.events, e)
+	}
+
+	return b, nil
+}
+
+// Start replays events to registered recipients, so traders should be created before
+func (b *ReplayBroker) Start(ctx context.Context) {
+	go func() {
+		defer close(b.done)
+
+		var prev time.Time
+		for _, e := range b.events {
+			if b.cfg.Speed > 0 && !prev.IsZero() && e.Time.After(prev) {
+				supports.WaitFor(ctx, time.Duration(float64(e.Time.Sub(prev))/b.cfg.Speed))
+			}
+			prev = e.Time
+
+			if ctx.Err() != nil {
+				return
+			}
+			b.dispatch(ctx, e)
+		}
+
+		b.logger.InfofKV("replay finished", ds.HistoryColDetails, fmt.Sprintf("%d events", len(b.events)))
+	}()
+}
+
+// Done is closed when all events are replayed
+func (b *ReplayBroker) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *ReplayBroker) dispatch(ctx context.Context, e *Event) {
+	b.RLock()
+	var lpChans []chan *ds.LastPrice
+	var candleChans []chan *ds.Candle
+	var orderChans []chan *ds.Order
+	switch e.Type {
+	case EventLastPrice:
+		for _, ch := range b.lastPriceInput[e.Uid] {
+			lpChans = append(lpChans, ch)
+		}
+	case EventCandle:
+		for _, ch := range b.candleInput[e.Uid][e.Interval] {
+			candleChans = append(candleChans, ch)
+		}
+	case EventOrder:
+		if b.cfg.ReplayOrders {
+			for _, r := range b.orderStateInput[e.Uid] {
+				if r.accountId == e.AccountId {
+					orderChans = append(orderChans, r.ch)
+				}
+			}
+		}
+	}
+	b.RUnlock()
+
+	for _, ch := range lpChans {
+		lp := *e.LastPrice
+		send(ctx, ch, &lp)
+	}
+	for _, ch := range candleChans {
+		candle := *e.Candle
+		send(ctx, ch, &candle)
+	}
+	for _, ch := range orderChans {
+		order := *e.Order
+		send(ctx, ch, &order)
+	}
+}
+
+// send waits for recipient to keep events in order, closed channel means recipient is gone
+func send[Type any](ctx context.Context, ch chan Type, v Type) {
+	defer func() { _ = recover() }()
+
+	select {
+	case <-ctx.Done():
+	case ch <- v:
+	}
+}
+
+// recieve prefers events left in channel over finished replay
+func recieve[Type any](ctx context.Context, ch chan Type, done <-chan struct{}) (Type, error) {
+	var zero Type
+
+	select {
+	case <-ctx.Done():
+		return zero, fmt.Errorf("context done")
+	case v, ok := <-ch:
+		if !ok {
+			return zero, fmt.Errorf("recipient closed")
+		}
+		return v, nil
+	case <-done:
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return zero, fmt.Errorf("recipient closed")
+			}
+			return v, nil
+		default:
+			return zero, fmt.Errorf("replay finished")
+		}
+	}
+}
+
+func (b *ReplayBroker) FindInstrument(identifier string) (*ds.InstrumentInfo, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	instrs := make([]*ds.InstrumentInfo, 0, len(b.instruments))
+	for _, v := range b.instruments {
+		instrs = append(instrs, v)
+	}
+
+	found, err := (&ds.InstrumentLookup{}).Select(identifier, instrs)
+	if err != nil {
+		return nil, fmt.Errorf("instrument is not recorded: %s", err.Error())
+	}
+	instrInfo := *found
+
+	return &instrInfo, nil
+}
+
+// FindFutures returns recorded contracts of basic asset
+func (b *ReplayBroker) FindFutures(basicAsset string) ([]*ds.InstrumentInfo, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	var contracts []*ds.InstrumentInfo
+	for _, v := range b.instruments {
+		if v.IsFutures() && strings.EqualFold(v.BasicAsset, basicAsset) {
+			instrInfo := *v
+			contracts = append(contracts, &instrInfo)
+		}
+	}
+
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("futures of '%s' are not recorded", basicAsset)
+	}
+
+	return contracts, nil
+}
+
+func (b *ReplayBroker) RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.lastPriceInput[instrInfo.Uid]; !ok {
+		b.lastPriceInput[instrInfo.Uid] = make(map[uuid.UUID]chan *ds.LastPrice)
+	}
+	if _, ok := b.lastPriceInput[instrInfo.Uid][instrInfo.InstanceId]; !ok {
+		b.lastPriceInput[instrInfo.Uid][instrInfo.InstanceId] = make(chan *ds.LastPrice, recipientBuffer)
+	}
+
+	return nil
+}
+
+func (b *ReplayBroker) UnregisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if ch, ok := b.lastPriceInput[instrInfo.Uid][instrInfo.InstanceId]; ok {
+		supports.CloseIfMaybeClosed(ch)
+	}
+	delete(b.lastPriceInput[instrInfo.Uid], instrInfo.InstanceId)
+	delete(b.lastSeen, instrInfo.InstanceId)
+
+	return nil
+}
+
+func (b *ReplayBroker) RecieveLastPrice(ctx context.Context, instrInfo *ds.InstrumentInfo) (*ds.LastPrice, error) {
+	b.RLock()
+	ch := b.lastPriceInput[instrInfo.Uid][instrInfo.InstanceId]
+	b.RUnlock()
+
+	if ch == nil {
+		return nil, fmt.Errorf("not registered last price recipient for %s", instrInfo.Ticker)
+	}
+
+	lp, err := recieve(ctx, ch, b.done)
+	if err != nil {
+		return nil, fmt.Errorf("failed recieving last price for %s: %s", instrInfo.Ticker, err.Error())
+	}
+
+	b.Lock()
+	b.lastSeen[instrInfo.InstanceId] = lp.Price.ToFloat64()
+	b.Unlock()
+
+	return lp, nil
+}
+
+func (b *ReplayBroker) RegisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.candleInput[instrInfo.Uid]; !ok {
+		b.candleInput[instrInfo.Uid] = make(map[ds.CandleInterval]map[uuid.UUID]chan *ds.Candle)
+	}
+	if _, ok := b.candleInput[instrInfo.Uid][interval]; !ok {
+		b.candleInput[instrInfo.Uid][interval] = make(map[uuid.UUID]chan *ds.Candle)
+	}
+	if _, ok := b.candleInput[instrInfo.Uid][interval][instrInfo.InstanceId]; !ok {
+		b.candleInput[instrInfo.Uid][interval][instrInfo.InstanceId] = make(chan *ds.Candle, recipientBuffer)
+	}
+
+	return nil
+}
+
+func (b *ReplayBroker) UnregisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if ch, ok := b.candleInput[instrInfo.Uid][interval][instrInfo.InstanceId]; ok {
+		supports.CloseIfMaybeClosed(ch)
+	}
+	delete(b.candleInput[instrInfo.Uid][interval], instrInfo.InstanceId)
+
+	return nil
+}
+
+func (b *ReplayBroker) RecieveCandle(ctx context.Context, instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) (*ds.Candle, error) {
+	b.RLock()
+	ch := b.candleInput[instrInfo.Uid][interval][instrInfo.InstanceId]
+	b.RUnlock()
+
+	if ch == nil {
+		return nil, fmt.Errorf("not registered candle recipient for %s", instrInfo.Ticker)
+	}
+
+	candle, err := recieve(ctx, ch, b.done)
+	if err != nil {
+		return nil, fmt.Errorf("failed recieving candle for %s: %s", instrInfo.Ticker, err.Error())
+	}
+
+	return candle, nil
+}
+
+func (b *ReplayBroker) RegisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error {
+	return fmt.Errorf("order book is not recorded")
+}
+
+func (b *ReplayBroker) UnregisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error {
+	return nil
+}
+
+func (b *ReplayBroker) RecieveOrderBook(ctx context.Context, instrInfo *ds.InstrumentInfo, depth int32) (*ds.OrderBook, error) {
+	return nil, fmt.Errorf("order book is not recorded")
+}
+
+func (b *ReplayBroker) RegisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.orderStateInput[instrInfo.Uid]; !ok {
+		b.orderStateInput[instrInfo.Uid] = make(map[uuid.UUID]*orderRecipient)
+	}
+	if _, ok := b.orderStateInput[instrInfo.Uid][instrInfo.InstanceId]; !ok {
+		b.orderStateInput[instrInfo.Uid][instrInfo.InstanceId] = &orderRecipient{
+			accountId: accountId,
+			ch:        make(chan *ds.Order, recipientBuffer),
+		}
+	}
+
+	return nil
+}
+
+func (b *ReplayBroker) UnregisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if r, ok := b.orderStateInput[instrInfo.Uid][instrInfo.InstanceId]; ok {
+		supports.CloseIfMaybeClosed(r.ch)
+	}
+	delete(b.orderStateInput[instrInfo.Uid], instrInfo.InstanceId)
+
+	return nil
+}
+
+func (b *ReplayBroker) RecieveOrdersUpdate(ctx context.Context, instrInfo *ds.InstrumentInfo, accountId string) (*ds.Order, error) {
+	b.RLock()
+	var ch chan *ds.Order
+	if r, ok := b.orderStateInput[instrInfo.Uid][instrInfo.InstanceId]; ok {
+		ch = r.ch
+	}
+	b.RUnlock()
+
+	if ch == nil {
+		return nil, fmt.Errorf("not registered order state recipient for %s", instrInfo.Ticker)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("recieving orders update context done for %s", instrInfo.Ticker)
+	case order, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("order state recipient closed for %s", instrInfo.Ticker)
+		}
+		return order, nil
+	}
+}
+
+func (b *ReplayBroker) MakeBuyOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	return b.execute(instrInfo, ds.Buy, lots, requestId)
+}
+
+func (b *ReplayBroker) MakeSellOrder(instrInfo *ds.InstrumentInfo, lots int64, requestId, accountId string) (*ds.PostOrderResult, error) {
+	return b.execute(instrInfo, ds.Sell, lots, requestId)
+}
+
+func (b *ReplayBroker) execute(instrInfo *ds.InstrumentInfo, direction ds.Action, lots int64, requestId string) (*ds.PostOrderResult, error) {
+	if lots < 1 {
+		return nil, fmt.Errorf("incorrect lots to make order: %d", lots)
+	}
+
+	b.RLock()
+	price, ok := b.lastSeen[instrInfo.InstanceId]
+	var ch chan *ds.Order
+	if r, exists := b.orderStateInput[instrInfo.Uid][instrInfo.InstanceId]; exists {
+		ch = r.ch
+	}
+	b.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no price to execute replay order for %s", instrInfo.Ticker)
+	}
+
+	orderPrice := ds.Quotation{}
+	orderPrice.FromFloat64(price)
+
+	commission := ds.Quotation{}
+	commission.FromFloat64(instrInfo.LotsCost(price, lots) * b.cfg.CommissionPercent / 100)
+
+	if ch != nil && !b.cfg.ReplayOrders {
+		now := time.Now()
+		order := &ds.Order{
+			CreatedAt:             &now,
+			CompletionTime:        &now,
+			OrderId:               requestId,
+			Direction:             direction.ToString(),
+			ExecutionReportStatus: ds.Fill.ToString(),
+			OrderPrice:            orderPrice,
+			LotsRequested:         lots,
+			LotsExecuted:          lots,
+			InstrumentUid:         instrInfo.Uid,
+		}
+		if err := supports.SendOrSkipIfMaybeClosed(ch, order); err != nil {
+			b.logger.ErrorfKV("failed sending replay order state", ds.HistoryColError, err.Error())
+		}
+	}
+
+	return &ds.PostOrderResult{
+		ExecutedCommission:    commission,
+		ExecutedOrderPrice:    orderPrice,
+		InstrumentUid:         instrInfo.Uid,
+		ExecutionReportStatus: ds.Fill.ToString(),
+		OrderId:               requestId,
+		LotsExecuted:          lots,
+	}, nil
+}
+
+func (b *ReplayBroker) GetTradingAvailability(instrInfo *ds.InstrumentInfo) (ds.TradingAvailability, error) {
+	return ds.Available, nil
+}
+
+func (b *ReplayBroker) GetTradingSession(instrInfo *ds.InstrumentInfo) (ds.TradingSession, error) {
+	return ds.SessionMain, nil
+}
@@ -12,6 +12,7 @@ const (
 	TopicPriceHistory  = "price_history"
 	TopicOrdersHistory = "orders_history"
 	TopicLogs          = "app_logs"
+	TopicOrdersLatency = "orders_latency"
 )
 
 const (
@@ -30,6 +31,26 @@ const (
 	HistoryColSeconds        = "seconds"
 	HistoryColMessage        = "message"
 	HistoryColDetails        = "details"
+	HistoryColStreams        = "streams"
+	HistoryColSubscriptions  = "subscriptions"
+	HistoryColUtilisation    = "utilisation"
+	HistoryColDecisionMs     = "decision_to_send_ms"
+	HistoryColAckMs          = "send_to_ack_ms"
+	HistoryColFillMs         = "send_to_fill_ms"
+	HistoryColAmount         = "amount"
+	HistoryColCurrency       = "currency"
+	HistoryColAmountBase     = "amount_base"
+	HistoryColBaseCurrency   = "base_currency"
+)
+
+// instrument types of T-Invest
+const (
+	InstrumentTypeShare    = "share"
+	InstrumentTypeEtf      = "etf"
+	InstrumentTypeBond     = "bond"
+	InstrumentTypeFutures  = "futures"
+	InstrumentTypeOption   = "option"
+	InstrumentTypeCurrency = "currency"
 )
 
 type TradingAvailability int8
@@ -41,6 +62,83 @@ const (
 	Available
 )
 
+type TradingSession int8
+
+const (
+	SessionClosed TradingSession = iota
+	SessionOpeningAuction
+	SessionMain
+	SessionBreak
+	SessionClosingAuction
+	SessionEvening
+	SessionWeekend
+)
+
+var (
+	stringSessionMap = map[TradingSession]string{
+		SessionClosed:         "closed",
+		SessionOpeningAuction: "opening_auction",
+		SessionMain:           "main",
+		SessionBreak:          "break",
+		SessionClosingAuction: "closing_auction",
+		SessionEvening:        "evening",
+		SessionWeekend:        "weekend",
+	}
+
+	typeSessionMap = map[string]TradingSession{
+		"opening_auction": SessionOpeningAuction,
+		"main":            SessionMain,
+		"closing_auction": SessionClosingAuction,
+		"evening":         SessionEvening,
+		"weekend":         SessionWeekend,
+	}
+)
+
+func (s TradingSession) ToString() string {
+	return stringSessionMap[s]
+}
+
+func (s TradingSession) IsTrading() bool {
+	return s == SessionMain || s == SessionEvening || s == SessionWeekend
+}
+
+// TradingSessionFromString resolves only sessions trader can opt into
+func TradingSessionFromString(s string) (TradingSession, bool) {
+	v, ok := typeSessionMap[s]
+	return v, ok
+}
+
+func TradingSessionsFromStrings(ss []string) ([]TradingSession, error) {
+	sessions := make([]TradingSession, 0, len(ss))
+	for _, s := range ss {
+		v, ok := TradingSessionFromString(s)
+		if !ok {
+			return nil, fmt.Errorf("incorrect trading session: %s", s)
+		}
+		sessions = append(sessions, v)
+	}
+
+	return sessions, nil
+}
+
+type SessionInterval struct {
+	Session    TradingSession
+	Start, End time.Time
+}
+
+type TradingDay struct {
+	Exchange     string
+	Date         time.Time
+	IsTradingDay bool
+	Sessions     []SessionInterval
+}
+
+type TradingStatus struct {
+	ApiAvailable bool
+	Session      TradingSession
+	UpdatedAt    time.Time
+}
+
 type CandleInterval int32
 
 const (
@@ -172,8 +270,189 @@ type InstrumentInfo struct {
 	Lot             int32  `db:"lot"`
 	AvailableApi    bool   `db:"available_api"`
 	ForQuals        bool   `db:"for_quals"`
+	Currency        string `db:"currency"`
+	Exchange        string `db:"-"`
 	FirstCandleDate time.Time
 	InstanceId      uuid.UUID
+
+	Type       string `db:"instrument_type"`
+	BasicAsset string `db:"basic_asset"`
+	// MinPriceIncrement is a price step in points and MinPriceIncrementAmount is its cost in money,
+	// they differ for futures only
+	MinPriceIncrement       Quotation  `db:"min_price_increment"`
+	MinPriceIncrementAmount Quotation  `db:"min_price_increment_amount"`
+	InitialMarginOnBuy      Quotation  `db:"initial_margin_on_buy"`
+	InitialMarginOnSell     Quotation  `db:"initial_margin_on_sell"`
+	ExpirationDate          *time.Time `db:"expiration_date"`
+
+	// bonds are priced in percents of Nominal, AciValue is accrued interest at the moment of fetching
+	Nominal      Quotation  `db:"nominal"`
+	AciValue     Quotation  `db:"aci_value"`
+	MaturityDate *time.Time `db:"maturity_date"`
+	Coupons      []*Coupon  `db:"-"`
+}
+
+// Coupon is a payment for one bond, coupons of instrument are ordered by date
+type Coupon struct {
+	Date      time.Time `db:"coupon_date"`
+	StartDate time.Time `db:"coupon_start_date"`
+	EndDate   time.Time `db:"coupon_end_date"`
+	Amount    Quotation `db:"pay_one_bond"`
+}
+
+func (i *InstrumentInfo) IsFutures() bool {
+	return i.Type == InstrumentTypeFutures
+}
+
+func (i *InstrumentInfo) IsBond() bool {
+	return i.Type == InstrumentTypeBond
+}
+
+// PriceToMoney converts price of one instrument into money. Futures are priced in points,
+// bonds in percents of nominal.
+func (i *InstrumentInfo) PriceToMoney(price float64) float64 {
+	if i.IsBond() && i.Nominal.ToFloat64() > 0 {
+		return price / 100 * i.Nominal.ToFloat64()
+	}
+
+	step := i.MinPriceIncrement.ToFloat64()
+	amount := i.MinPriceIncrementAmount.ToFloat64()
+	if !i.IsFutures() || step == 0 || amount == 0 {
+		return price
+	}
+
+	return price / step * amount
+}
+
+// LotsCost is money cost of lots at price
+func (i *InstrumentInfo) LotsCost(price float64, lots int64) float64 {
+	return i.PriceToMoney(price) * float64(lots) * float64(i.Lot)
+}
+
+// AccruedInterest returns accrued coupon interest of one bond at the moment.
+// Without coupon period covering the moment it is the last known value.
+func (i *InstrumentInfo) AccruedInterest(at time.Time) float64 {
+	if !i.IsBond() {
+		return 0
+	}
+
+	for _, c := range i.Coupons {
+		if at.Before(c.StartDate) || !at.Before(c.EndDate) {
+			continue
+		}
+		return c.Amount.ToFloat64() * float64(at.Sub(c.StartDate)) / float64(c.EndDate.Sub(c.StartDate))
+	}
+
+	return i.AciValue.ToFloat64()
+}
+
+// YieldToMaturity returns effective annual yield of bond bought at price with accrued interest,
+// held to maturity with coupons paid after the moment
+func (i *InstrumentInfo) YieldToMaturity(price float64, at time.Time) (float64, error) {
+	if !i.IsBond() || i.MaturityDate == nil || i.Nominal.ToFloat64() <= 0 {
+		return 0, fmt.Errorf("no maturity or nominal of '%s'", i.Ticker)
+	}
+	if !i.MaturityDate.After(at) {
+		return 0, fmt.Errorf("bond '%s' is matured", i.Ticker)
+	}
+
+	dirty := i.PriceToMoney(price) + i.AccruedInterest(at)
+	years := func(t time.Time) float64 {
+		return t.Sub(at).Hours() / 24 / 365
+	}
+	presentValue := func(rate float64) float64 {
+		pv := i.Nominal.ToFloat64() / math.Pow(1+rate, years(*i.MaturityDate))
+		for _, c := range i.Coupons {
+			if c.Date.After(at) && !c.Date.After(*i.MaturityDate) {
+				pv += c.Amount.ToFloat64() / math.Pow(1+rate, years(c.Date))
+			}
+		}
+		return pv
+	}
+
+	// present value decreases with rate, so the rate is found by bisection
+	low, high := -0.99, 10.0
+	if presentValue(low) < dirty || presentValue(high) > dirty {
+		return 0, fmt.Errorf("yield of '%s' is out of range at price %f", i.Ticker, price)
+	}
+	for range 100 {
+		mid := (low + high) / 2
+		if presentValue(mid) > dirty {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2, nil
+}
+
+// SelectFutureContract returns the nearest contract which expires later than rollBefore from now
+func SelectFutureContract(contracts []*InstrumentInfo, now time.Time, rollBefore time.Duration) (*InstrumentInfo, error) {
+	var nearest *InstrumentInfo
+	for _, c := range contracts {
+		if c.ExpirationDate == nil || !c.ExpirationDate.After(now.Add(rollBefore)) {
+			continue
+		}
+		if nearest == nil || c.ExpirationDate.Before(*nearest.ExpirationDate) {
+			nearest = c
+		}
+	}
+
+	if nearest == nil {
+		return nil, fmt.Errorf("no futures contract expiring after %s", now.Add(rollBefore).Format(time.DateOnly))
+	}
+
+	return nearest, nil
+}
+
+// SameInstrument reports whether both infos describe one instrument, which uid could be
+// changed by the broker. The same ISIN on another class code is another instrument.
+func (i *InstrumentInfo) SameInstrument(other *InstrumentInfo) bool {
+	if i.ClassCode != other.ClassCode {
+		return false
+	}
+
+	return (i.Ticker != "" && i.Ticker == other.Ticker) || (i.Isin != "" && i.Isin == other.Isin)
+}
+
+// InstrumentSplit is one instrument stored in several rows, ordered by id
+type InstrumentSplit struct {
+	Instruments []*InstrumentInfo
+}
+
+func (s *InstrumentSplit) Uids() []string {
+	uids := make([]string, 0, len(s.Instruments))
+	for _, instr := range s.Instruments {
+		uids = append(uids, instr.Uid)
+	}
+	return uids
+}
+
+// GroupInstrumentSplits returns groups of more than one info of the same instrument
+func GroupInstrumentSplits(instrs []*InstrumentInfo) []*InstrumentSplit {
+	var groups []*InstrumentSplit
+instruments:
+	for _, instr := range instrs {
+		for _, g := range groups {
+			for _, known := range g.Instruments {
+				if known.SameInstrument(instr) {
+					g.Instruments = append(g.Instruments, instr)
+					continue instruments
+				}
+			}
+		}
+		groups = append(groups, &InstrumentSplit{Instruments: []*InstrumentInfo{instr}})
+	}
+
+	splits := make([]*InstrumentSplit, 0)
+	for _, g := range groups {
+		if len(g.Instruments) > 1 {
+			splits = append(splits, g)
+		}
+	}
+
+	return splits
 }
 
 type LastPrice struct {
@@ -225,6 +504,79 @@ type PostOrderResult struct {
 	LotsExecuted          int64
 }
 
+// OrderLatency keeps moments of order life measured on the bot side
+type OrderLatency struct {
+	DecidedAt *time.Time `db:"decided_at"`
+	SentAt    *time.Time `db:"sent_at"`
+	AckedAt   *time.Time `db:"acked_at"`
+	FilledAt  *time.Time `db:"filled_at"`
+}
+
+func (l *OrderLatency) DecisionToSend() time.Duration {
+	return between(l.DecidedAt, l.SentAt)
+}
+
+func (l *OrderLatency) SendToAck() time.Duration {
+	return between(l.SentAt, l.AckedAt)
+}
+
+func (l *OrderLatency) SendToFill() time.Duration {
+	return between(l.SentAt, l.FilledAt)
+}
+
+// Merge fills moments which are not set yet
+func (l *OrderLatency) Merge(other *OrderLatency) {
+	if l.DecidedAt == nil {
+		l.DecidedAt = other.DecidedAt
+	}
+	if l.SentAt == nil {
+		l.SentAt = other.SentAt
+	}
+	if l.AckedAt == nil {
+		l.AckedAt = other.AckedAt
+	}
+	if l.FilledAt == nil {
+		l.FilledAt = other.FilledAt
+	}
+}
+
+func between(from, to *time.Time) time.Duration {
+	if from == nil || to == nil {
+		return 0
+	}
+
+	return to.Sub(*from)
+}
+
+type Position struct {
+	Id           int64     `db:"id"`
+	AccountId    string    `db:"account_id"`
+	InstrumentId int64     `db:"instrument_id"`
+	Lots         int64     `db:"lots"`
+	AveragePrice Quotation `db:"average_price"`
+	RealizedPnl  Quotation `db:"realized_pnl"`
+	Commission   Quotation `db:"commission"`
+	Currency     string    `db:"currency"`
+	// RealizedPnlBase is realized pnl converted to base currency with rates of every fill
+	RealizedPnlBase Quotation `db:"realized_pnl_base"`
+	BaseCurrency    string    `db:"base_currency"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// BacktestRun is a saved result of backtest, Config, Metrics and Trades are json
+type BacktestRun struct {
+	Id        string    `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+	GitCommit string    `db:"git_commit"`
+	TraderId  string    `db:"trader_id"`
+	Strategy  string    `db:"strategy"`
+	Config    []byte    `db:"config"`
+	From      time.Time `db:"from_time"`
+	To        time.Time `db:"to_time"`
+	Metrics   []byte    `db:"metrics"`
+	Trades    []byte    `db:"trades"`
+}
+
 type Order struct {
 	Id                    int64      `db:"id"`
 	CreatedAt             *time.Time `db:"created_at"`
@@ -0,0 +1,128 @@
+package datastruct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupInstrumentSplits(t *testing.T) {
+	t.Parallel()
+
+	instrs := []*InstrumentInfo{
+		{Id: 1, Uid: "old", Ticker: "SBER", ClassCode: "TQBR", Isin: "RU0009029540"},
+		{Id: 2, Uid: "spb", Ticker: "SBER", ClassCode: "SPBXM", Isin: "RU0009029540"},
+		{Id: 3, Uid: "other", Ticker: "GAZP", ClassCode: "TQBR", Isin: "RU0007661625"},
+		{Id: 4, Uid: "new", Ticker: "SBER", ClassCode: "TQBR", Isin: "RU0009029540"},
+		{Id: 5, Uid: "renamed", Ticker: "SBERP", ClassCode: "TQBR", Isin: "RU0009029540"},
+	}
+
+	splits := GroupInstrumentSplits(instrs)
+	require.Len(t, splits, 1)
+	require.Equal(t, []string{"old", "new", "renamed"}, splits[0].Uids())
+
+	require.Empty(t, GroupInstrumentSplits(instrs[:3]))
+}
+
+func TestFutures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("price to money", func(t *testing.T) {
+		t.Parallel()
+
+		future := &InstrumentInfo{Type: InstrumentTypeFutures, Lot: 1}
+		future.MinPriceIncrement.FromFloat64(1)
+		future.MinPriceIncrementAmount.FromFloat64(0.5)
+		require.InDelta(t, 50000.0, future.PriceToMoney(100000), 1e-9)
+		require.InDelta(t, 150000.0, future.LotsCost(100000, 3), 1e-9)
+
+		share := &InstrumentInfo{Type: InstrumentTypeShare, Lot: 10}
+		share.MinPriceIncrement.FromFloat64(0.01)
+		share.MinPriceIncrementAmount.FromFloat64(0.01)
+		require.InDelta(t, 3000.0, share.LotsCost(100, 3), 1e-9)
+	})
+
+	t.Run("select contract", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+		date := func(month time.Month, day int) *time.Time {
+			d := time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+			return &d
+		}
+		contracts := []*InstrumentInfo{
+			{Uid: "dec", ExpirationDate: date(12, 18)},
+			{Uid: "mar", ExpirationDate: date(3, 20)},
+			{Uid: "jun", ExpirationDate: date(6, 19)},
+			{Uid: "perpetual"},
+		}
+
+		c, err := SelectFutureContract(contracts, now, 0)
+		require.NoError(t, err)
+		require.Equal(t, "mar", c.Uid)
+
+		c, err = SelectFutureContract(contracts, now, time.Hour*24*30)
+		require.NoError(t, err)
+		require.Equal(t, "jun", c.Uid)
+
+		_, err = SelectFutureContract(contracts, now, time.Hour*24*365)
+		require.Error(t, err)
+	})
+}
+
+func TestBonds(t *testing.T) {
+	t.Parallel()
+
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	coupon := func(start, end time.Time, amount float64) *Coupon {
+		c := &Coupon{Date: end, StartDate: start, EndDate: end}
+		c.Amount.FromFloat64(amount)
+		return c
+	}
+
+	maturity := date(2028, 1, 1)
+	bond := &InstrumentInfo{Type: InstrumentTypeBond, Lot: 1, MaturityDate: &maturity}
+	bond.Nominal.FromFloat64(1000)
+	bond.AciValue.FromFloat64(7)
+	for year := 2026; year < 2028; year++ {
+		bond.Coupons = append(bond.Coupons,
+			coupon(date(year, 1, 1), date(year, 7, 1), 50),
+			coupon(date(year, 7, 1), date(year+1, 1, 1), 50))
+	}
+
+	t.Run("price in percents of nominal", func(t *testing.T) {
+		t.Parallel()
+
+		require.InDelta(t, 985.0, bond.PriceToMoney(98.5), 1e-9)
+		require.InDelta(t, 1970.0, bond.LotsCost(98.5, 2), 1e-9)
+	})
+
+	t.Run("accrued interest", func(t *testing.T) {
+		t.Parallel()
+
+		start := date(2026, 7, 1)
+		middle := start.Add(date(2027, 1, 1).Sub(start) / 2)
+		require.InDelta(t, 25.0, bond.AccruedInterest(middle), 1e-9)
+		require.InDelta(t, 0.0, bond.AccruedInterest(start), 1e-9)
+		require.InDelta(t, 7.0, bond.AccruedInterest(date(2030, 1, 1)), 1e-9)
+	})
+
+	t.Run("yield to maturity", func(t *testing.T) {
+		t.Parallel()
+
+		// 10% a year paid twice a year at par gives about 10.25% of effective yield
+		ytm, err := bond.YieldToMaturity(100, date(2026, 1, 1))
+		require.NoError(t, err)
+		require.InDelta(t, 0.1025, ytm, 1e-3)
+
+		cheap, err := bond.YieldToMaturity(95, date(2026, 1, 1))
+		require.NoError(t, err)
+		require.Greater(t, cheap, ytm)
+
+		_, err = bond.YieldToMaturity(100, date(2029, 1, 1))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,89 @@
+package datastruct
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const classCodeSeparator = "@"
+
+// InstrumentLookup selects one instrument among instruments found by identifier
+type InstrumentLookup struct {
+	// ClassCodes are preferred class codes when ticker is traded on several boards, the first wins
+	ClassCodes []string
+	// Types are allowed instrument types like share, etf, bond, futures. Any type if empty
+	Types []string
+}
+
+// ParseInstrumentIdentifier splits identifier like 'TICKER@CLASS_CODE'. Class code is empty
+// if identifier has no separator.
+func ParseInstrumentIdentifier(identifier string) (id, classCode string) {
+	id, classCode, _ = strings.Cut(identifier, classCodeSeparator)
+	return id, classCode
+}
+
+// JoinInstrumentIdentifier makes identifier like 'TICKER@CLASS_CODE'
+func JoinInstrumentIdentifier(id, classCode string) string {
+	if classCode == "" {
+		return id
+	}
+	return id + classCodeSeparator + classCode
+}
+
+// Select returns the only instrument matching identifier. Identifier is uid, figi, isin,
+// ticker or 'TICKER@CLASS_CODE'.
+func (l *InstrumentLookup) Select(identifier string, instrs []*InstrumentInfo) (*InstrumentInfo, error) {
+	id, classCode := ParseInstrumentIdentifier(identifier)
+
+	var matched []*InstrumentInfo
+	for _, instr := range instrs {
+		// uid and figi are unique, no need in preferences
+		if instr.Uid == id || instr.Figi == id {
+			return instr, nil
+		}
+
+		if !strings.EqualFold(instr.Ticker, id) && instr.Isin != id {
+			continue
+		}
+		if classCode != "" && !strings.EqualFold(instr.ClassCode, classCode) {
+			continue
+		}
+		if len(l.Types) > 0 && !slices.ContainsFunc(l.Types, func(t string) bool { return strings.EqualFold(t, instr.Type) }) {
+			continue
+		}
+		matched = append(matched, instr)
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("not found instrument '%s'", identifier)
+	case 1:
+		return matched[0], nil
+	}
+
+	for _, preferred := range l.ClassCodes {
+		var onBoard []*InstrumentInfo
+		for _, instr := range matched {
+			if strings.EqualFold(instr.ClassCode, preferred) {
+				onBoard = append(onBoard, instr)
+			}
+		}
+
+		if len(onBoard) == 1 {
+			return onBoard[0], nil
+		}
+		if len(onBoard) > 1 {
+			matched = onBoard
+			break
+		}
+	}
+
+	candidates := make([]string, 0, len(matched))
+	for _, instr := range matched {
+		candidates = append(candidates, fmt.Sprintf("%s%s%s (%s, uid: %s)", instr.Ticker, classCodeSeparator, instr.ClassCode, instr.Type, instr.Uid))
+	}
+
+	return nil, fmt.Errorf("ambiguous instrument '%s', use uid or TICKER%sCLASS_CODE of: %s",
+		identifier, classCodeSeparator, strings.Join(candidates, ", "))
+}
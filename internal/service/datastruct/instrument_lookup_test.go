@@ -0,0 +1,48 @@
+package datastruct
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentLookup(t *testing.T) {
+	t.Parallel()
+
+	instrs := []*InstrumentInfo{
+		{Uid: "sber_spb", Figi: "figi_spb", Ticker: "SBER", ClassCode: "SPBXM", Isin: "RU0009029540", Type: "share"},
+		{Uid: "sber_moex", Figi: "figi_moex", Ticker: "SBER", ClassCode: "TQBR", Isin: "RU0009029540", Type: "share"},
+		{Uid: "sber_fut", Figi: "figi_fut", Ticker: "SBER", ClassCode: "SPBFUT", Type: "futures"},
+	}
+
+	tests := []struct {
+		name       string
+		lookup     *InstrumentLookup
+		identifier string
+		uid        string
+		err        string
+	}{
+		{name: "by uid", lookup: &InstrumentLookup{}, identifier: "sber_moex", uid: "sber_moex"},
+		{name: "by figi", lookup: &InstrumentLookup{}, identifier: "figi_spb", uid: "sber_spb"},
+		{name: "by ticker and class code", lookup: &InstrumentLookup{}, identifier: "sber@tqbr", uid: "sber_moex"},
+		{name: "by preferred class code", lookup: &InstrumentLookup{ClassCodes: []string{"TQBR", "SPBXM"}}, identifier: "SBER", uid: "sber_moex"},
+		{name: "by type", lookup: &InstrumentLookup{Types: []string{"futures"}}, identifier: "SBER", uid: "sber_fut"},
+		{name: "ambiguous ticker", lookup: &InstrumentLookup{}, identifier: "SBER", err: "ambiguous instrument 'SBER'"},
+		{name: "ambiguous isin", lookup: &InstrumentLookup{ClassCodes: []string{"SPBFUT"}}, identifier: "RU0009029540", err: "SBER@SPBXM (share, uid: sber_spb), SBER@TQBR"},
+		{name: "not found", lookup: &InstrumentLookup{}, identifier: "SBER@SMAL", err: "not found instrument 'SBER@SMAL'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			instr, err := tt.lookup.Select(tt.identifier, instrs)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.uid, instr.Uid)
+		})
+	}
+}
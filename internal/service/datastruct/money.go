@@ -0,0 +1,171 @@
+package datastruct
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const CurrencyRub = "rub"
+
+// Money is an amount in currency, currencies are lower case ISO names as T-Invest returns them.
+// Amounts of different currencies are not added, they are converted with ExchangeRates first
+type Money struct {
+	Amount   Quotation `db:"amount"`
+	Currency string    `db:"currency"`
+}
+
+func NewMoney(amount float64, currency string) Money {
+	m := Money{Currency: NormalizeCurrency(currency)}
+	m.Amount.FromFloat64(amount)
+	return m
+}
+
+func (m *Money) ToFloat64() float64 {
+	return m.Amount.ToFloat64()
+}
+
+func (m *Money) ToString() string {
+	return fmt.Sprintf("%.2f %s", m.Amount.ToFloat64(), strings.ToUpper(NormalizeCurrency(m.Currency)))
+}
+
+func (m *Money) Add(other Money) (Money, error) {
+	if NormalizeCurrency(m.Currency) != NormalizeCurrency(other.Currency) {
+		return Money{}, fmt.Errorf("failed adding %s to %s: different currencies", other.ToString(), m.ToString())
+	}
+
+	return NewMoney(m.ToFloat64()+other.ToFloat64(), m.Currency), nil
+}
+
+func (m *Money) Sub(other Money) (Money, error) {
+	other.Amount.FromFloat64(-other.ToFloat64())
+	return m.Add(other)
+}
+
+func (m *Money) Mul(k float64) Money {
+	return NewMoney(m.ToFloat64()*k, m.Currency)
+}
+
+// NormalizeCurrency lowers currency name, empty currency is rub
+func NormalizeCurrency(currency string) string {
+	if currency == "" {
+		return CurrencyRub
+	}
+
+	return strings.ToLower(currency)
+}
+
+// ExchangeRates keeps prices of currency units in rubles
+type ExchangeRates map[string]float64
+
+func (r ExchangeRates) rate(currency string) (float64, error) {
+	currency = NormalizeCurrency(currency)
+	if currency == CurrencyRub {
+		return 1, nil
+	}
+
+	rate, ok := r[currency]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+
+	return rate, nil
+}
+
+// Rate returns how many units of currency to cost one unit of currency from
+func (r ExchangeRates) Rate(from, to string) (float64, error) {
+	fromRate, err := r.rate(from)
+	if err != nil {
+		return 0, err
+	}
+
+	toRate, err := r.rate(to)
+	if err != nil {
+		return 0, err
+	}
+
+	return fromRate / toRate, nil
+}
+
+func (r ExchangeRates) Convert(m Money, to string) (Money, error) {
+	rate, err := r.Rate(m.Currency, to)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return NewMoney(m.ToFloat64()*rate, to), nil
+}
+
+// RatePoint is rub price of currency unit known from the moment
+type RatePoint struct {
+	Time time.Time
+	Rate float64
+}
+
+// RateHistory keeps rates ordered by time
+type RateHistory []RatePoint
+
+// At returns the last rate known at the moment, the first rate is used before history starts
+func (h RateHistory) At(t time.Time) (float64, bool) {
+	if len(h) == 0 {
+		return 0, false
+	}
+
+	i := sort.Search(len(h), func(i int) bool { return h[i].Time.After(t) })
+	if i == 0 {
+		return h[0].Rate, true
+	}
+
+	return h[i-1].Rate, true
+}
+
+// RateHistories keeps rate histories of currencies
+type RateHistories map[string]RateHistory
+
+// At returns exchange rates known at the moment
+func (r RateHistories) At(t time.Time) ExchangeRates {
+	rates := make(ExchangeRates, len(r))
+	for currency, h := range r {
+		if rate, ok := h.At(t); ok {
+			rates[currency] = rate
+		}
+	}
+
+	return rates
+}
+
+// Rate returns history of how many units of currency to cost one unit of currency from,
+// it has a point for every change of both currencies
+func (r RateHistories) Rate(from, to string) (RateHistory, error) {
+	from, to = NormalizeCurrency(from), NormalizeCurrency(to)
+	if from == to {
+		return RateHistory{{Rate: 1}}, nil
+	}
+
+	var times []time.Time
+	for _, currency := range []string{from, to} {
+		for _, p := range r[currency] {
+			times = append(times, p.Time)
+		}
+	}
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+	times = slices.CompactFunc(times, func(a, b time.Time) bool { return a.Equal(b) })
+
+	if len(times) == 0 {
+		_, err := ExchangeRates{}.Rate(from, to)
+		return nil, err
+	}
+
+	history := make(RateHistory, 0, len(times))
+	for _, t := range times {
+		rate, err := r.At(t).Rate(from, to)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, RatePoint{Time: t, Rate: rate})
+	}
+
+	return history, nil
+}
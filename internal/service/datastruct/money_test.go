@@ -0,0 +1,103 @@
+package datastruct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeRates(t *testing.T) {
+	t.Parallel()
+
+	rates := ExchangeRates{"usd": 90, "cny": 12.5}
+
+	rate, err := rates.Rate("USD", CurrencyRub)
+	require.NoError(t, err)
+	require.InDelta(t, 90.0, rate, 1e-9)
+
+	rate, err = rates.Rate("", "usd")
+	require.NoError(t, err)
+	require.InDelta(t, 1.0/90, rate, 1e-9)
+
+	rate, err = rates.Rate("usd", "cny")
+	require.NoError(t, err)
+	require.InDelta(t, 7.2, rate, 1e-9)
+
+	_, err = rates.Rate("eur", CurrencyRub)
+	require.Error(t, err)
+}
+
+func TestMoney(t *testing.T) {
+	t.Parallel()
+
+	m := NewMoney(100, "USD")
+	require.Equal(t, "usd", m.Currency)
+	require.Equal(t, "100.00 USD", m.ToString())
+
+	sum, err := m.Add(NewMoney(50.5, "usd"))
+	require.NoError(t, err)
+	require.InDelta(t, 150.5, sum.ToFloat64(), 1e-9)
+
+	diff, err := m.Sub(NewMoney(150, "usd"))
+	require.NoError(t, err)
+	require.InDelta(t, -50.0, diff.ToFloat64(), 1e-9)
+
+	_, err = m.Add(NewMoney(1, CurrencyRub))
+	require.Error(t, err)
+	_, err = m.Sub(NewMoney(1, CurrencyRub))
+	require.Error(t, err)
+
+	half := m.Mul(0.5)
+	require.InDelta(t, 50.0, half.ToFloat64(), 1e-9)
+	require.Equal(t, "usd", half.Currency)
+
+	rub, err := ExchangeRates{"usd": 90}.Convert(m, "")
+	require.NoError(t, err)
+	require.Equal(t, NewMoney(9000, CurrencyRub), rub)
+
+	_, err = ExchangeRates{}.Convert(m, CurrencyRub)
+	require.Error(t, err)
+}
+
+func TestRateHistories(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2022, 3, d, 0, 0, 0, 0, time.UTC) }
+	histories := RateHistories{
+		"usd": {{Time: day(1), Rate: 90}, {Time: day(3), Rate: 120}},
+		"cny": {{Time: day(2), Rate: 15}},
+	}
+
+	usd, err := histories.Rate("USD", CurrencyRub)
+	require.NoError(t, err)
+	require.Len(t, usd, 2)
+
+	cases := map[time.Time]float64{
+		day(1).Add(-time.Hour): 90,
+		day(2):                 90,
+		day(3):                 120,
+		day(10):                120,
+	}
+	for tm, expected := range cases {
+		rate, ok := usd.At(tm)
+		require.True(t, ok)
+		require.InDelta(t, expected, rate, 1e-9)
+	}
+
+	cross, err := histories.Rate("usd", "cny")
+	require.NoError(t, err)
+	require.Len(t, cross, 3)
+	rate, _ := cross.At(day(3))
+	require.InDelta(t, 8.0, rate, 1e-9)
+
+	same, err := histories.Rate("rub", "")
+	require.NoError(t, err)
+	rate, _ = same.At(day(3))
+	require.InDelta(t, 1.0, rate, 1e-9)
+
+	_, err = histories.Rate("eur", CurrencyRub)
+	require.Error(t, err)
+	_, ok := RateHistory{}.At(day(1))
+	require.False(t, ok)
+}
@@ -0,0 +1,126 @@
+package datastruct
+
+import (
+	"math"
+	"time"
+)
+
+type OrderBookLevel struct {
+	Price    Quotation
+	Quantity int64
+}
+
+// OrderBook keeps bids sorted from the best (highest) price
+// and asks sorted from the best (lowest) price
+type OrderBook struct {
+	Figi, Uid    string
+	Depth        int32
+	IsConsistent bool
+	Bids         []OrderBookLevel
+	Asks         []OrderBookLevel
+	Time         time.Time
+}
+
+func (ob *OrderBook) BestBid() (float64, bool) {
+	if len(ob.Bids) == 0 {
+		return 0, false
+	}
+
+	return ob.Bids[0].Price.ToFloat64(), true
+}
+
+func (ob *OrderBook) BestAsk() (float64, bool) {
+	if len(ob.Asks) == 0 {
+		return 0, false
+	}
+
+	return ob.Asks[0].Price.ToFloat64(), true
+}
+
+// Spread is a difference between best ask and best bid prices
+func (ob *OrderBook) Spread() (float64, bool) {
+	bid, okBid := ob.BestBid()
+	ask, okAsk := ob.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+
+	return ask - bid, true
+}
+
+// SpreadPercent is a spread related to mid price
+func (ob *OrderBook) SpreadPercent() (float64, bool) {
+	spread, ok := ob.Spread()
+	if !ok {
+		return 0, false
+	}
+
+	mid, _ := ob.Mid()
+	if mid == 0 {
+		return 0, false
+	}
+
+	return spread / mid * 100, true
+}
+
+func (ob *OrderBook) Mid() (float64, bool) {
+	bid, okBid := ob.BestBid()
+	ask, okAsk := ob.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+
+	return (ask + bid) / 2, true
+}
+
+// Imbalance returns value in [-1, 1] calculated on first levels of both sides.
+// Positive value means prevalence of bids. Zero or negative levels take all book.
+func (ob *OrderBook) Imbalance(levels int) float64 {
+	bids := sumQuantity(ob.Bids, levels)
+	asks := sumQuantity(ob.Asks, levels)
+	if bids+asks == 0 {
+		return 0
+	}
+
+	return float64(bids-asks) / float64(bids+asks)
+}
+
+// DepthWithin returns lots of both sides which prices are not further
+// than percent from mid price
+func (ob *OrderBook) DepthWithin(percent float64) (bidLots, askLots int64) {
+	mid, ok := ob.Mid()
+	if !ok {
+		return 0, 0
+	}
+
+	maxDiff := mid * percent / 100
+
+	for _, v := range ob.Bids {
+		if math.Abs(mid-v.Price.ToFloat64()) > maxDiff {
+			break
+		}
+		bidLots += v.Quantity
+	}
+
+	for _, v := range ob.Asks {
+		if math.Abs(v.Price.ToFloat64()-mid) > maxDiff {
+			break
+		}
+		askLots += v.Quantity
+	}
+
+	return bidLots, askLots
+}
+
+func sumQuantity(levels []OrderBookLevel, amount int) int64 {
+	if amount <= 0 || amount > len(levels) {
+		amount = len(levels)
+	}
+
+	var sum int64
+	for _, v := range levels[:amount] {
+		sum += v.Quantity
+	}
+
+	return sum
+}
@@ -0,0 +1,69 @@
+package datastruct
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func level(price float64, quantity int64) OrderBookLevel {
+	l := OrderBookLevel{Quantity: quantity}
+	l.Price.FromFloat64(price)
+	return l
+}
+
+func TestOrderBook(t *testing.T) {
+	t.Parallel()
+
+	ob := &OrderBook{
+		Bids: []OrderBookLevel{level(99.5, 10), level(99, 20), level(97, 100)},
+		Asks: []OrderBookLevel{level(100.5, 5), level(101, 15), level(103, 50)},
+	}
+
+	t.Run("spread and mid", func(t *testing.T) {
+		t.Parallel()
+
+		spread, ok := ob.Spread()
+		require.True(t, ok)
+		require.InDelta(t, 1.0, spread, 1e-9)
+
+		mid, ok := ob.Mid()
+		require.True(t, ok)
+		require.InDelta(t, 100.0, mid, 1e-9)
+
+		percent, ok := ob.SpreadPercent()
+		require.True(t, ok)
+		require.InDelta(t, 1.0, percent, 1e-9)
+	})
+
+	t.Run("imbalance", func(t *testing.T) {
+		t.Parallel()
+
+		require.InDelta(t, (10.0-5.0)/15.0, ob.Imbalance(1), 1e-9)
+		require.InDelta(t, (130.0-70.0)/200.0, ob.Imbalance(0), 1e-9)
+	})
+
+	t.Run("depth within", func(t *testing.T) {
+		t.Parallel()
+
+		bids, asks := ob.DepthWithin(1)
+		require.Equal(t, int64(30), bids)
+		require.Equal(t, int64(20), asks)
+	})
+
+	t.Run("empty side", func(t *testing.T) {
+		t.Parallel()
+
+		empty := &OrderBook{Bids: ob.Bids}
+
+		_, ok := empty.Spread()
+		require.False(t, ok)
+		_, ok = empty.Mid()
+		require.False(t, ok)
+		require.Equal(t, 1.0, empty.Imbalance(0))
+
+		bids, asks := empty.DepthWithin(1)
+		require.Zero(t, bids)
+		require.Zero(t, asks)
+	})
+}
@@ -3,13 +3,17 @@ package trader
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 	ds "trading_bot/internal/service/datastruct"
 	"trading_bot/internal/supports"
 )
 
-//go:generate mockgen -source=trader.go -destination=trader_mock.go -package=trader IStrategy,ILogger,IBroker,IStorage,IHistoryWriter
+// orders which are never filled or cancelled are forgotten after it
+const orderLatencyTTL = time.Hour * 24
+
+//go:generate mockgen -source=trader.go -destination=trader_mock.go -package=trader IStrategy,ILogger,IBroker,IStorage,IHistoryWriter,IExchangeRates
 
 type IStrategy interface {
 	GetActionDecision(ctx context.Context, trId string, instrInfo *ds.InstrumentInfo, lp *ds.LastPrice) ([]*ds.StrategyAction, error)
@@ -30,15 +34,24 @@ type IBroker interface {
 	RecieveOrdersUpdate(ctx context.Context, instrInfo *ds.InstrumentInfo, accountId string) (*ds.Order, error)
 	RegisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error
 	RegisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error
+	RegisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error
+	RegisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error
+	RecieveCandle(ctx context.Context, instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) (*ds.Candle, error)
+	RecieveOrderBook(ctx context.Context, instrInfo *ds.InstrumentInfo, depth int32) (*ds.OrderBook, error)
 	UnregisterOrderStateRecipient(instrInfo *ds.InstrumentInfo, accountId string) error
 	UnregisterLastPriceRecipient(instrInfo *ds.InstrumentInfo) error
+	UnregisterOrderBookRecipient(instrInfo *ds.InstrumentInfo, depth int32) error
+	UnregisterCandleRecipient(instrInfo *ds.InstrumentInfo, interval ds.CandleInterval) error
 	GetTradingAvailability(instrInfo *ds.InstrumentInfo) (ds.TradingAvailability, error)
+	GetTradingSession(instrInfo *ds.InstrumentInfo) (ds.TradingSession, error)
 	FindInstrument(identifier string) (*ds.InstrumentInfo, error)
+	FindFutures(basicAsset string) ([]*ds.InstrumentInfo, error)
 }
 
 type IStorage interface {
 	PutOrder(trId string, instrInfo *ds.InstrumentInfo, order *ds.Order) error
 	UpdateOrder(trId string, instrInfo *ds.InstrumentInfo, order *ds.Order) error
+	UpdateOrderLatency(trId string, instrInfo *ds.InstrumentInfo, orderId string, latency *ds.OrderLatency) error
 	AddInstrumentInfo(instrInfo *ds.InstrumentInfo) (dbId int64, err error)
 }
 
@@ -46,6 +59,11 @@ type IHistoryWriter interface {
 	WriteInTopicKV(string, ...any) error
 }
 
+// IExchangeRates is implemented by brokers which know current exchange rates
+type IExchangeRates interface {
+	GetExchangeRates(currencies ...string) (ds.ExchangeRates, error)
+}
+
 type TraderCfg struct {
 	InstrInfo                   *ds.InstrumentInfo
 	TraderId                    string
@@ -53,6 +71,8 @@ type TraderCfg struct {
 	OnTradingErrorDelay         time.Duration
 	OnOrdersOperatingErrorDelay time.Duration
 	AccountId                   string
+	Sessions                    []ds.TradingSession
+	BaseCurrency                string
 }
 
 type TraderService struct {
@@ -67,6 +87,14 @@ type TraderService struct {
 	strategy IStrategy
 	storage  IStorage
 	history  IHistoryWriter
+
+	latencyMu sync.Mutex
+	latencies map[string]*trackedLatency
+}
+
+type trackedLatency struct {
+	latency   *ds.OrderLatency
+	trackedAt time.Time
 }
 
 func NewTraderService(ctx context.Context, broker IBroker, logger ILogger,
@@ -105,6 +133,7 @@ func buildTraderService(ctx context.Context, cancelCtx func(), b IBroker, l ILog
 		storage:   store,
 		history:   hw,
 		cfg:       cfg,
+		latencies: make(map[string]*trackedLatency),
 	}
 }
 
@@ -135,6 +164,14 @@ func (s *TraderService) runOrdersOperating() {
 					operateError(err)
 				}
 			}
+
+			switch order.ExecutionReportStatus {
+			case ds.Fill.ToString():
+				filledAt := time.Now()
+				s.trackLatency(config, order.OrderId, &ds.OrderLatency{FilledAt: &filledAt})
+			case ds.Cancelled.ToString():
+				s.forgetLatency(order.OrderId)
+			}
 		}
 	}
 }
@@ -189,7 +226,19 @@ mainLoop:
 				continue
 			}
 
-			if status == ds.NotAvailableNow {
+			if len(config.Sessions) > 0 {
+				var session ds.TradingSession
+				session, err = s.broker.GetTradingSession(config.InstrInfo)
+				if err != nil {
+					s.logger.ErrorfKV("failed getting trading session",
+						ds.HistoryColInstrumentUID, config.InstrInfo.Uid, ds.HistoryColError, err.Error())
+					continue
+				}
+
+				if !slices.Contains(config.Sessions, session) {
+					continue
+				}
+			} else if status == ds.NotAvailableNow {
 				continue
 			}
 
@@ -200,10 +249,13 @@ mainLoop:
 					ds.HistoryColInstrumentUID, config.InstrInfo.Uid, ds.HistoryColError, err.Error())
 				continue
 			}
+			decidedAt := time.Now()
 
 			for _, action := range actions {
 				var res *ds.PostOrderResult
+				sentAt := time.Now()
 				res, err = s.MakeAction(lastPrice, action)
+				ackedAt := time.Now()
 				if err != nil {
 					s.logger.ErrorfKV("failed executing action",
 						ds.HistoryColAction, action.Action.ToString(), ds.HistoryColLots, action.Lots,
@@ -221,24 +273,108 @@ mainLoop:
 					continue
 				}
 
-				s.logger.InfofKV("Executed order", ds.HistoryColAction, action.Action.ToString(), ds.HistoryColLots, action.Lots,
+				message := "Executed order"
+				if res.ExecutionReportStatus == ds.New.ToString() {
+					message = "Placed order"
+				}
+
+				s.logger.InfofKV(message, ds.HistoryColAction, action.Action.ToString(), ds.HistoryColLots, action.Lots,
 					ds.HistoryColPrice, res.ExecutedOrderPrice.ToFloat64(), ds.HistoryColCommission, res.ExecutedCommission.ToFloat64(),
 					ds.HistoryColInstrumentUID, res.InstrumentUid, ds.HistoryColTicker, config.InstrInfo.Ticker,
 					ds.HistoryColTimestamp, lastPrice.Time.Unix(), ds.HistoryColExecDurationMs, time.Since(start).Milliseconds())
 
-				writeErr := s.history.WriteInTopicKV(ds.TopicOrdersHistory, ds.HistoryColAction, action.Action.ToString(), ds.HistoryColLots, action.Lots,
-					ds.HistoryColPrice, res.ExecutedOrderPrice.ToFloat64(), ds.HistoryColRequestId, action.RequestId, ds.HistoryColTraderId, config.TraderId,
-					ds.HistoryColTimestamp, time.Now().Unix())
+				amount := ds.NewMoney(config.InstrInfo.LotsCost(res.ExecutedOrderPrice.ToFloat64(), res.LotsExecuted), config.InstrInfo.Currency)
+				kvs := []any{ds.HistoryColAction, action.Action.ToString(), ds.HistoryColLots, action.Lots,
+					ds.HistoryColPrice, res.ExecutedOrderPrice.ToFloat64(), ds.HistoryColAmount, amount.ToFloat64(), ds.HistoryColCurrency, amount.Currency,
+					ds.HistoryColBaseCurrency, ds.NormalizeCurrency(config.BaseCurrency), ds.HistoryColRequestId, action.RequestId,
+					ds.HistoryColTraderId, config.TraderId, ds.HistoryColTimestamp, time.Now().Unix()}
+
+				if base, err := s.toBaseCurrency(amount, config.BaseCurrency); err != nil {
+					s.logger.ErrorfKV("failed converting order amount to base currency",
+						ds.HistoryColRequestId, action.RequestId, ds.HistoryColError, err.Error())
+				} else {
+					kvs = append(kvs, ds.HistoryColAmountBase, base.ToFloat64())
+				}
+
+				writeErr := s.history.WriteInTopicKV(ds.TopicOrdersHistory, kvs...)
 
 				if writeErr != nil {
 					s.logger.ErrorfKV("failed write orders history", ds.HistoryColError, writeErr)
 				}
 
+				s.trackLatency(config, action.RequestId, &ds.OrderLatency{DecidedAt: &decidedAt, SentAt: &sentAt, AckedAt: &ackedAt})
+
 			}
 		}
 	}
 }
 
+// toBaseCurrency converts amount with current rates of broker, amounts in base currency need no rates
+func (s *TraderService) toBaseCurrency(amount ds.Money, baseCurrency string) (ds.Money, error) {
+	baseCurrency = ds.NormalizeCurrency(baseCurrency)
+	if amount.Currency == baseCurrency {
+		return amount, nil
+	}
+
+	r, ok := s.broker.(IExchangeRates)
+	if !ok {
+		return ds.Money{}, fmt.Errorf("broker has no exchange rates")
+	}
+
+	rates, err := r.GetExchangeRates(amount.Currency, baseCurrency)
+	if err != nil {
+		return ds.Money{}, fmt.Errorf("failed getting exchange rates: %s", err.Error())
+	}
+
+	return rates.Convert(amount, baseCurrency)
+}
+
+// trackLatency merges moments of order from trading and orders loops, they may come in any order.
+// History is written once when the order is both acked and filled.
+func (s *TraderService) trackLatency(config *TraderCfg, requestId string, latency *ds.OrderLatency) {
+	now := time.Now()
+
+	s.latencyMu.Lock()
+	for id, v := range s.latencies {
+		if now.Sub(v.trackedAt) > orderLatencyTTL {
+			delete(s.latencies, id)
+		}
+	}
+	if known, ok := s.latencies[requestId]; ok {
+		latency.Merge(known.latency)
+	}
+	completed := latency.AckedAt != nil && latency.FilledAt != nil
+	if completed {
+		delete(s.latencies, requestId)
+	} else {
+		s.latencies[requestId] = &trackedLatency{latency: latency, trackedAt: now}
+	}
+	s.latencyMu.Unlock()
+
+	if err := s.storage.UpdateOrderLatency(config.TraderId, config.InstrInfo, requestId, latency); err != nil {
+		s.logger.ErrorfKV("failed updating order latency",
+			ds.HistoryColRequestId, requestId, ds.HistoryColTraderId, config.TraderId, ds.HistoryColError, err.Error())
+	}
+
+	if !completed {
+		return
+	}
+
+	writeErr := s.history.WriteInTopicKV(ds.TopicOrdersLatency, ds.HistoryColRequestId, requestId, ds.HistoryColTraderId, config.TraderId,
+		ds.HistoryColDecisionMs, latency.DecisionToSend().Milliseconds(), ds.HistoryColAckMs, latency.SendToAck().Milliseconds(),
+		ds.HistoryColFillMs, latency.SendToFill().Milliseconds(), ds.HistoryColTimestamp, time.Now().Unix())
+	if writeErr != nil {
+		s.logger.ErrorfKV("failed write orders latency", ds.HistoryColError, writeErr)
+	}
+}
+
+func (s *TraderService) forgetLatency(requestId string) {
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+
+	delete(s.latencies, requestId)
+}
+
 func (s *TraderService) MakeAction(lastPrice *ds.LastPrice, action *ds.StrategyAction) (res *ds.PostOrderResult, err error) {
 	if action.Action == ds.Sell {
 		return s.broker.MakeSellOrder(s.cfg.InstrInfo, action.Lots, action.RequestId, s.cfg.AccountId)
@@ -175,6 +175,21 @@ func (m *MockIBroker) EXPECT() *MockIBrokerMockRecorder {
 	return m.recorder
 }
 
+// FindFutures mocks base method.
+func (m *MockIBroker) FindFutures(basicAsset string) ([]*datastruct.InstrumentInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindFutures", basicAsset)
+	ret0, _ := ret[0].([]*datastruct.InstrumentInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindFutures indicates an expected call of FindFutures.
+func (mr *MockIBrokerMockRecorder) FindFutures(basicAsset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindFutures", reflect.TypeOf((*MockIBroker)(nil).FindFutures), basicAsset)
+}
+
 // FindInstrument mocks base method.
 func (m *MockIBroker) FindInstrument(identifier string) (*datastruct.InstrumentInfo, error) {
 	m.ctrl.T.Helper()
@@ -205,6 +220,21 @@ func (mr *MockIBrokerMockRecorder) GetTradingAvailability(instrInfo interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTradingAvailability", reflect.TypeOf((*MockIBroker)(nil).GetTradingAvailability), instrInfo)
 }
 
+// GetTradingSession mocks base method.
+func (m *MockIBroker) GetTradingSession(instrInfo *datastruct.InstrumentInfo) (datastruct.TradingSession, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTradingSession", instrInfo)
+	ret0, _ := ret[0].(datastruct.TradingSession)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTradingSession indicates an expected call of GetTradingSession.
+func (mr *MockIBrokerMockRecorder) GetTradingSession(instrInfo interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTradingSession", reflect.TypeOf((*MockIBroker)(nil).GetTradingSession), instrInfo)
+}
+
 // MakeBuyOrder mocks base method.
 func (m *MockIBroker) MakeBuyOrder(instrInfo *datastruct.InstrumentInfo, lots int64, requestId, accountId string) (*datastruct.PostOrderResult, error) {
 	m.ctrl.T.Helper()
@@ -235,6 +265,21 @@ func (mr *MockIBrokerMockRecorder) MakeSellOrder(instrInfo, lots, requestId, acc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeSellOrder", reflect.TypeOf((*MockIBroker)(nil).MakeSellOrder), instrInfo, lots, requestId, accountId)
 }
 
+// RecieveCandle mocks base method.
+func (m *MockIBroker) RecieveCandle(ctx context.Context, instrInfo *datastruct.InstrumentInfo, interval datastruct.CandleInterval) (*datastruct.Candle, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecieveCandle", ctx, instrInfo, interval)
+	ret0, _ := ret[0].(*datastruct.Candle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecieveCandle indicates an expected call of RecieveCandle.
+func (mr *MockIBrokerMockRecorder) RecieveCandle(ctx, instrInfo, interval interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecieveCandle", reflect.TypeOf((*MockIBroker)(nil).RecieveCandle), ctx, instrInfo, interval)
+}
+
 // RecieveLastPrice mocks base method.
 func (m *MockIBroker) RecieveLastPrice(ctx context.Context, instrInfo *datastruct.InstrumentInfo) (*datastruct.LastPrice, error) {
 	m.ctrl.T.Helper()
@@ -250,6 +295,21 @@ func (mr *MockIBrokerMockRecorder) RecieveLastPrice(ctx, instrInfo interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecieveLastPrice", reflect.TypeOf((*MockIBroker)(nil).RecieveLastPrice), ctx, instrInfo)
 }
 
+// RecieveOrderBook mocks base method.
+func (m *MockIBroker) RecieveOrderBook(ctx context.Context, instrInfo *datastruct.InstrumentInfo, depth int32) (*datastruct.OrderBook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecieveOrderBook", ctx, instrInfo, depth)
+	ret0, _ := ret[0].(*datastruct.OrderBook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecieveOrderBook indicates an expected call of RecieveOrderBook.
+func (mr *MockIBrokerMockRecorder) RecieveOrderBook(ctx, instrInfo, depth interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecieveOrderBook", reflect.TypeOf((*MockIBroker)(nil).RecieveOrderBook), ctx, instrInfo, depth)
+}
+
 // RecieveOrdersUpdate mocks base method.
 func (m *MockIBroker) RecieveOrdersUpdate(ctx context.Context, instrInfo *datastruct.InstrumentInfo, accountId string) (*datastruct.Order, error) {
 	m.ctrl.T.Helper()
@@ -265,6 +325,20 @@ func (mr *MockIBrokerMockRecorder) RecieveOrdersUpdate(ctx, instrInfo, accountId
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecieveOrdersUpdate", reflect.TypeOf((*MockIBroker)(nil).RecieveOrdersUpdate), ctx, instrInfo, accountId)
 }
 
+// RegisterCandleRecipient mocks base method.
+func (m *MockIBroker) RegisterCandleRecipient(instrInfo *datastruct.InstrumentInfo, interval datastruct.CandleInterval) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterCandleRecipient", instrInfo, interval)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegisterCandleRecipient indicates an expected call of RegisterCandleRecipient.
+func (mr *MockIBrokerMockRecorder) RegisterCandleRecipient(instrInfo, interval interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterCandleRecipient", reflect.TypeOf((*MockIBroker)(nil).RegisterCandleRecipient), instrInfo, interval)
+}
+
 // RegisterLastPriceRecipient mocks base method.
 func (m *MockIBroker) RegisterLastPriceRecipient(instrInfo *datastruct.InstrumentInfo) error {
 	m.ctrl.T.Helper()
@@ -279,6 +353,20 @@ func (mr *MockIBrokerMockRecorder) RegisterLastPriceRecipient(instrInfo interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterLastPriceRecipient", reflect.TypeOf((*MockIBroker)(nil).RegisterLastPriceRecipient), instrInfo)
 }
 
+// RegisterOrderBookRecipient mocks base method.
+func (m *MockIBroker) RegisterOrderBookRecipient(instrInfo *datastruct.InstrumentInfo, depth int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterOrderBookRecipient", instrInfo, depth)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegisterOrderBookRecipient indicates an expected call of RegisterOrderBookRecipient.
+func (mr *MockIBrokerMockRecorder) RegisterOrderBookRecipient(instrInfo, depth interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterOrderBookRecipient", reflect.TypeOf((*MockIBroker)(nil).RegisterOrderBookRecipient), instrInfo, depth)
+}
+
 // RegisterOrderStateRecipient mocks base method.
 func (m *MockIBroker) RegisterOrderStateRecipient(instrInfo *datastruct.InstrumentInfo, accountId string) error {
 	m.ctrl.T.Helper()
@@ -293,6 +381,20 @@ func (mr *MockIBrokerMockRecorder) RegisterOrderStateRecipient(instrInfo, accoun
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterOrderStateRecipient", reflect.TypeOf((*MockIBroker)(nil).RegisterOrderStateRecipient), instrInfo, accountId)
 }
 
+// UnregisterCandleRecipient mocks base method.
+func (m *MockIBroker) UnregisterCandleRecipient(instrInfo *datastruct.InstrumentInfo, interval datastruct.CandleInterval) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnregisterCandleRecipient", instrInfo, interval)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnregisterCandleRecipient indicates an expected call of UnregisterCandleRecipient.
+func (mr *MockIBrokerMockRecorder) UnregisterCandleRecipient(instrInfo, interval interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnregisterCandleRecipient", reflect.TypeOf((*MockIBroker)(nil).UnregisterCandleRecipient), instrInfo, interval)
+}
+
 // UnregisterLastPriceRecipient mocks base method.
 func (m *MockIBroker) UnregisterLastPriceRecipient(instrInfo *datastruct.InstrumentInfo) error {
 	m.ctrl.T.Helper()
@@ -307,6 +409,20 @@ func (mr *MockIBrokerMockRecorder) UnregisterLastPriceRecipient(instrInfo interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnregisterLastPriceRecipient", reflect.TypeOf((*MockIBroker)(nil).UnregisterLastPriceRecipient), instrInfo)
 }
 
+// UnregisterOrderBookRecipient mocks base method.
+func (m *MockIBroker) UnregisterOrderBookRecipient(instrInfo *datastruct.InstrumentInfo, depth int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnregisterOrderBookRecipient", instrInfo, depth)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnregisterOrderBookRecipient indicates an expected call of UnregisterOrderBookRecipient.
+func (mr *MockIBrokerMockRecorder) UnregisterOrderBookRecipient(instrInfo, depth interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnregisterOrderBookRecipient", reflect.TypeOf((*MockIBroker)(nil).UnregisterOrderBookRecipient), instrInfo, depth)
+}
+
 // UnregisterOrderStateRecipient mocks base method.
 func (m *MockIBroker) UnregisterOrderStateRecipient(instrInfo *datastruct.InstrumentInfo, accountId string) error {
 	m.ctrl.T.Helper()
@@ -387,6 +503,20 @@ func (mr *MockIStorageMockRecorder) UpdateOrder(trId, instrInfo, order interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockIStorage)(nil).UpdateOrder), trId, instrInfo, order)
 }
 
+// UpdateOrderLatency mocks base method.
+func (m *MockIStorage) UpdateOrderLatency(trId string, instrInfo *datastruct.InstrumentInfo, orderId string, latency *datastruct.OrderLatency) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrderLatency", trId, instrInfo, orderId, latency)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrderLatency indicates an expected call of UpdateOrderLatency.
+func (mr *MockIStorageMockRecorder) UpdateOrderLatency(trId, instrInfo, orderId, latency interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderLatency", reflect.TypeOf((*MockIStorage)(nil).UpdateOrderLatency), trId, instrInfo, orderId, latency)
+}
+
 // MockIHistoryWriter is a mock of IHistoryWriter interface.
 type MockIHistoryWriter struct {
 	ctrl     *gomock.Controller
@@ -428,3 +558,45 @@ func (mr *MockIHistoryWriterMockRecorder) WriteInTopicKV(arg0 interface{}, arg1
 	varargs := append([]interface{}{arg0}, arg1...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteInTopicKV", reflect.TypeOf((*MockIHistoryWriter)(nil).WriteInTopicKV), varargs...)
 }
+
+// MockIExchangeRates is a mock of IExchangeRates interface.
+type MockIExchangeRates struct {
+	ctrl     *gomock.Controller
+	recorder *MockIExchangeRatesMockRecorder
+}
+
+// MockIExchangeRatesMockRecorder is the mock recorder for MockIExchangeRates.
+type MockIExchangeRatesMockRecorder struct {
+	mock *MockIExchangeRates
+}
+
+// NewMockIExchangeRates creates a new mock instance.
+func NewMockIExchangeRates(ctrl *gomock.Controller) *MockIExchangeRates {
+	mock := &MockIExchangeRates{ctrl: ctrl}
+	mock.recorder = &MockIExchangeRatesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIExchangeRates) EXPECT() *MockIExchangeRatesMockRecorder {
+	return m.recorder
+}
+
+// GetExchangeRates mocks base method.
+func (m *MockIExchangeRates) GetExchangeRates(currencies ...string) (datastruct.ExchangeRates, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range currencies {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetExchangeRates", varargs...)
+	ret0, _ := ret[0].(datastruct.ExchangeRates)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExchangeRates indicates an expected call of GetExchangeRates.
+func (mr *MockIExchangeRatesMockRecorder) GetExchangeRates(currencies ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExchangeRates", reflect.TypeOf((*MockIExchangeRates)(nil).GetExchangeRates), currencies...)
+}
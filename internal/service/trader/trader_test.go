@@ -264,6 +264,50 @@ func TestTraderService(t *testing.T) {
 		ts.service.RunTrading()
 	})
 
+	t.Run("RunTrading session not opted", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		ts := newTestService(ctx, t)
+
+		ts.service.cfg.Sessions = []ds.TradingSession{ds.SessionMain}
+
+		ts.mockBrocker.EXPECT().RecieveLastPrice(gomock.Any(), gomock.Any()).Return(&ds.LastPrice{}, nil).MinTimes(1)
+
+		ts.mockBrocker.EXPECT().GetTradingAvailability(gomock.Any()).Return(ds.Available, nil).MinTimes(1)
+
+		ts.mockBrocker.EXPECT().GetTradingSession(gomock.Any()).Return(ds.SessionEvening, nil).MinTimes(1)
+
+		ts.mockLogger.EXPECT().InfofKV(gomock.Any(), gomock.All()).MaxTimes(1).MinTimes(1)
+
+		ts.mockHistory.EXPECT().WriteInTopicKV(gomock.Any(), gomock.All()).MinTimes(1)
+
+		ts.service.RunTrading()
+	})
+
+	t.Run("RunTrading opted auction session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		ts := newTestService(ctx, t)
+
+		ts.service.cfg.Sessions = []ds.TradingSession{ds.SessionOpeningAuction}
+
+		ts.mockBrocker.EXPECT().RecieveLastPrice(gomock.Any(), gomock.Any()).Return(&ds.LastPrice{}, nil).MinTimes(1)
+
+		ts.mockBrocker.EXPECT().GetTradingAvailability(gomock.Any()).Return(ds.NotAvailableNow, nil).MinTimes(1)
+
+		ts.mockBrocker.EXPECT().GetTradingSession(gomock.Any()).Return(ds.SessionOpeningAuction, nil).MinTimes(1)
+
+		ts.mockStrategy.EXPECT().GetActionDecision(gomock.Any(), gomock.Any(), ts.service.cfg.InstrInfo, gomock.Any()).Return([]*ds.StrategyAction{{Action: ds.Hold}}, nil).MinTimes(1)
+
+		ts.mockLogger.EXPECT().InfofKV(gomock.Any(), gomock.All()).MaxTimes(1).MinTimes(1)
+
+		ts.mockHistory.EXPECT().WriteInTopicKV(gomock.Any(), gomock.All()).MinTimes(1)
+
+		ts.service.RunTrading()
+	})
+
 	t.Run("RunTrading error on MakeBuyOrder", func(t *testing.T) {
 		ctx, _ := context.WithTimeout(context.Background(), time.Millisecond*100)
 
@@ -405,4 +449,115 @@ func TestTraderService(t *testing.T) {
 		require.Equal(t, strategy, newStrategy)
 		require.NotNil(t, ts)
 	})
+
+	t.Run("trackLatency fill before ack", func(t *testing.T) {
+		ctx := context.Background()
+		ts := newTestService(ctx, t)
+		cfg := ts.service.GetConfig()
+
+		now := time.Now()
+		decidedAt, sentAt, filledAt, ackedAt := now, now.Add(time.Millisecond*5), now.Add(time.Millisecond*20), now.Add(time.Millisecond*30)
+
+		fill := ts.mockStorage.EXPECT().UpdateOrderLatency(cfg.TraderId, cfg.InstrInfo, "request", &ds.OrderLatency{FilledAt: &filledAt}).Return(nil)
+		ts.mockStorage.EXPECT().UpdateOrderLatency(cfg.TraderId, cfg.InstrInfo, "request", gomock.Any()).Return(nil).After(fill)
+
+		ts.mockHistory.EXPECT().WriteInTopicKV(ds.TopicOrdersLatency, ds.HistoryColRequestId, "request", ds.HistoryColTraderId, cfg.TraderId,
+			ds.HistoryColDecisionMs, int64(5), ds.HistoryColAckMs, int64(25), ds.HistoryColFillMs, int64(15), ds.HistoryColTimestamp, gomock.Any()).Return(nil)
+
+		ts.service.trackLatency(cfg, "request", &ds.OrderLatency{FilledAt: &filledAt})
+		ts.service.trackLatency(cfg, "request", &ds.OrderLatency{DecidedAt: &decidedAt, SentAt: &sentAt, AckedAt: &ackedAt})
+
+		require.Empty(t, ts.service.latencies)
+	})
+
+	t.Run("trackLatency ack before fill", func(t *testing.T) {
+		ctx := context.Background()
+		ts := newTestService(ctx, t)
+		cfg := ts.service.GetConfig()
+
+		now := time.Now()
+		sentAt, ackedAt, filledAt := now, now.Add(time.Millisecond*10), now.Add(time.Millisecond*40)
+
+		ts.mockStorage.EXPECT().UpdateOrderLatency(cfg.TraderId, cfg.InstrInfo, "request", gomock.Any()).Return(nil).Times(2)
+
+		ts.mockHistory.EXPECT().WriteInTopicKV(ds.TopicOrdersLatency, ds.HistoryColRequestId, "request", ds.HistoryColTraderId, cfg.TraderId,
+			ds.HistoryColDecisionMs, int64(0), ds.HistoryColAckMs, int64(10), ds.HistoryColFillMs, int64(40), ds.HistoryColTimestamp, gomock.Any()).Return(nil)
+
+		ts.service.trackLatency(cfg, "request", &ds.OrderLatency{SentAt: &sentAt, AckedAt: &ackedAt})
+		require.Len(t, ts.service.latencies, 1)
+
+		ts.service.trackLatency(cfg, "request", &ds.OrderLatency{FilledAt: &filledAt})
+		require.Empty(t, ts.service.latencies)
+	})
+
+	t.Run("trackLatency evicts expired orders", func(t *testing.T) {
+		ctx := context.Background()
+		ts := newTestService(ctx, t)
+		cfg := ts.service.GetConfig()
+
+		sentAt := time.Now().Add(-orderLatencyTTL * 2)
+		ts.service.latencies["lost"] = &trackedLatency{latency: &ds.OrderLatency{SentAt: &sentAt, AckedAt: &sentAt}, trackedAt: sentAt}
+
+		ts.mockStorage.EXPECT().UpdateOrderLatency(cfg.TraderId, cfg.InstrInfo, "request", gomock.Any()).Return(nil)
+
+		ackedAt := time.Now()
+		ts.service.trackLatency(cfg, "request", &ds.OrderLatency{SentAt: &ackedAt, AckedAt: &ackedAt})
+		require.Len(t, ts.service.latencies, 1)
+		require.Contains(t, ts.service.latencies, "request")
+	})
+
+	t.Run("cancelled order forgets latency", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ts := newTestService(ctx, t)
+
+		sentAt := time.Now()
+		ts.service.latencies["request"] = &trackedLatency{latency: &ds.OrderLatency{SentAt: &sentAt, AckedAt: &sentAt}, trackedAt: sentAt}
+
+		ts.mockBrocker.EXPECT().RecieveOrdersUpdate(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&ds.Order{OrderId: "request", ExecutionReportStatus: ds.Cancelled.ToString()}, nil)
+		ts.mockBrocker.EXPECT().RecieveOrdersUpdate(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, _ *ds.InstrumentInfo, _ string) (*ds.Order, error) {
+				cancel()
+				<-ctx.Done()
+				return nil, errors.New("context done")
+			})
+		ts.mockLogger.EXPECT().ErrorfKV(gomock.Any(), gomock.All()).AnyTimes()
+		ts.mockLogger.EXPECT().InfofKV(gomock.Any(), gomock.All()).AnyTimes()
+
+		ts.service.runOrdersOperating()
+
+		require.Empty(t, ts.service.latencies)
+	})
+}
+
+type mockBrokerWithRates struct {
+	*MockIBroker
+	*MockIExchangeRates
+}
+
+func TestTraderServiceBaseCurrency(t *testing.T) {
+	t.Parallel()
+
+	mc := gomock.NewController(t)
+	rates := NewMockIExchangeRates(mc)
+	s := buildTraderService(context.Background(), func() {}, &mockBrokerWithRates{NewMockIBroker(mc), rates},
+		NewMockILogger(mc), NewMockIStrategy(mc), NewMockIStorage(mc), NewMockIHistoryWriter(mc), &TraderCfg{})
+
+	// amount in base currency needs no rates
+	base, err := s.toBaseCurrency(ds.NewMoney(100, "rub"), "")
+	require.NoError(t, err)
+	require.InDelta(t, 100.0, base.ToFloat64(), 1e-9)
+
+	rates.EXPECT().GetExchangeRates("usd", "rub").Return(ds.ExchangeRates{"usd": 90}, nil)
+	base, err = s.toBaseCurrency(ds.NewMoney(10, "USD"), "rub")
+	require.NoError(t, err)
+	require.Equal(t, "rub", base.Currency)
+	require.InDelta(t, 900.0, base.ToFloat64(), 1e-9)
+
+	// broker without rates can not convert
+	s = buildTraderService(context.Background(), func() {}, NewMockIBroker(mc),
+		NewMockILogger(mc), NewMockIStrategy(mc), NewMockIStorage(mc), NewMockIHistoryWriter(mc), &TraderCfg{})
+	_, err = s.toBaseCurrency(ds.NewMoney(10, "usd"), "rub")
+	require.Error(t, err)
 }
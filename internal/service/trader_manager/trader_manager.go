@@ -3,6 +3,7 @@ package tradermanager
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 	"trading_bot/internal/config"
@@ -13,13 +14,28 @@ import (
 	"github.com/google/uuid"
 )
 
-//go:generate mockgen -source=trader_manager.go -destination=trader_manager_mock.go -package=tradermanager . IStrategyResolver
+//go:generate mockgen -source=trader_manager.go -destination=trader_manager_mock.go -package=tradermanager . IStrategyResolver,IInstrumentStorage,IPositionStorage
 
 type TraderId string
 
 type IStrategyResolver interface {
 	ResolveStrategy(cfg map[string]any, db any, broker any, traderId string) (strategy trader.IStrategy, err error)
 }
+
+// IInstrumentStorage is implemented by storages which keep one row per instrument
+// when the broker changes its uid
+type IInstrumentStorage interface {
+	GetInstrumentInfo(uid string) (*ds.InstrumentInfo, error)
+	ResolveInstrument(instrInfo *ds.InstrumentInfo) (dbId int64, oldUids []string, err error)
+}
+
+// IPositionStorage is implemented by storages which keep orders of traders,
+// lots bought on expiring futures contract are sold before rolling
+type IPositionStorage interface {
+	GetUnsoldOrders(trId string, instrInfo *ds.InstrumentInfo) ([]*ds.Order, error)
+	RemoveOrder(instrInfo *ds.InstrumentInfo, order *ds.Order) error
+}
+
 type TraderManager struct {
 	sync.RWMutex
 
@@ -34,6 +50,7 @@ type TraderManager struct {
 	traderLogger     trader.ILogger
 	strategyResolver IStrategyResolver
 	history          trader.IHistoryWriter
+	cfg              *config.TraderCfg
 }
 
 func NewTraderManager(ctx context.Context, onTraderPanicDelay time.Duration, broker trader.IBroker,
@@ -58,14 +75,18 @@ func (tm *TraderManager) UpdateTradersWithConfig(cfg *config.TraderCfg) {
 		return
 	}
 
+	tm.Lock()
+	tm.cfg = cfg
+	tm.Unlock()
+
 	for _, traderCfg := range cfg.Traders {
-		instrInfo, err := tm.broker.FindInstrument(traderCfg.Uid)
+		instrInfo, err := tm.findTraderInstrument(traderCfg, time.Now())
 		if err != nil {
 			tm.managerLogger.ErrorfKV("failed getting instrument from broker: %s", err.Error())
 			continue
 		}
 
-		dbId, err := tm.storage.AddInstrumentInfo(instrInfo)
+		dbId, err := tm.addInstrument(instrInfo)
 		if err != nil {
 			tm.managerLogger.ErrorfKV("failed adding instrument to database: %s", err.Error())
 			continue
@@ -73,6 +94,12 @@ func (tm *TraderManager) UpdateTradersWithConfig(cfg *config.TraderCfg) {
 		instrInfo.Id = dbId
 		instrInfo.InstanceId = uuid.New()
 
+		sessions, err := ds.TradingSessionsFromStrings(traderCfg.Sessions)
+		if err != nil {
+			tm.managerLogger.ErrorfKV("failed resolving trading sessions: %s", err.Error())
+			continue
+		}
+
 		strategyInstance, err := tm.strategyResolver.ResolveStrategy(traderCfg.StrategyCfg, tm.storage, tm.broker, traderCfg.UniqueTraderId)
 		if err != nil {
 			tm.managerLogger.ErrorfKV("failed resolving strategy: %s", err.Error())
@@ -86,6 +113,8 @@ func (tm *TraderManager) UpdateTradersWithConfig(cfg *config.TraderCfg) {
 			TradingDelay:                cfg.TradingDelay,
 			OnTradingErrorDelay:         cfg.OnTradingErrorDelay,
 			OnOrdersOperatingErrorDelay: cfg.OnOrdersOperatingErrorDelay,
+			Sessions:                    sessions,
+			BaseCurrency:                cfg.BaseCurrency,
 		}
 
 		if tr, ok := tm.findTrader(TraderId(traderCfg.UniqueTraderId)); ok {
@@ -135,6 +164,216 @@ func (tm *TraderManager) UpdateTradersWithConfig(cfg *config.TraderCfg) {
 	tm.stopMissingTraders(cfg)
 }
 
+// findTraderInstrument returns the nearest futures contract if trader is configured with basic asset
+func (tm *TraderManager) findTraderInstrument(traderCfg *config.OneTraderCfg, now time.Time) (*ds.InstrumentInfo, error) {
+	if traderCfg.BasicAsset == "" {
+		return tm.findInstrument(traderCfg.Uid)
+	}
+
+	contracts, err := tm.broker.FindFutures(traderCfg.BasicAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	contract, err := ds.SelectFutureContract(contracts, now, traderCfg.RollBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	return tm.broker.FindInstrument(contract.Uid)
+}
+
+// RunFuturesRolling moves traders configured with basic asset to the next contract
+// when the current one is about to expire
+func (tm *TraderManager) RunFuturesRolling(delay time.Duration) {
+	for {
+		select {
+		case <-tm.ctx.Done():
+			return
+		case <-time.After(delay):
+			tm.rollFutures(time.Now())
+		}
+	}
+}
+
+func (tm *TraderManager) rollFutures(now time.Time) {
+	tm.RLock()
+	cfg := tm.cfg
+	tm.RUnlock()
+
+	if cfg == nil {
+		return
+	}
+
+	for _, traderCfg := range cfg.Traders {
+		if traderCfg.BasicAsset == "" {
+			continue
+		}
+
+		tr, ok := tm.findTrader(TraderId(traderCfg.UniqueTraderId))
+		if !ok {
+			continue
+		}
+
+		instrInfo := tr.GetConfig().InstrInfo
+		if instrInfo.ExpirationDate != nil && instrInfo.ExpirationDate.After(now.Add(traderCfg.RollBefore)) {
+			continue
+		}
+
+		tm.managerLogger.InfofKV("futures contract expires, rolling to the next one",
+			ds.HistoryColTraderId, traderCfg.UniqueTraderId, ds.HistoryColTicker, instrInfo.Ticker)
+		if err := tm.rollTrader(tr, traderCfg, now); err != nil {
+			tm.managerLogger.ErrorfKV("failed rolling futures contract",
+				ds.HistoryColTraderId, traderCfg.UniqueTraderId, ds.HistoryColError, err.Error())
+		}
+	}
+}
+
+// rollTrader moves only this trader to the next contract keeping its strategy and subscriptions
+// instance. Lots of the expiring contract are sold first, so nothing is left on it
+func (tm *TraderManager) rollTrader(tr *trader.TraderService, traderCfg *config.OneTraderCfg, now time.Time) error {
+	oldCfg := tr.GetConfig()
+
+	next, err := tm.findTraderInstrument(traderCfg, now)
+	if err != nil {
+		return err
+	}
+	if next.Uid == oldCfg.InstrInfo.Uid {
+		return fmt.Errorf("no next contract of '%s'", traderCfg.BasicAsset)
+	}
+
+	dbId, err := tm.addInstrument(next)
+	if err != nil {
+		return err
+	}
+	next.Id = dbId
+	next.InstanceId = oldCfg.InstrInfo.InstanceId
+
+	if err := tm.closeContract(tr); err != nil {
+		return err
+	}
+
+	newCfg := *oldCfg
+	newCfg.InstrInfo = next
+	if err := tr.UpdateConfig(&newCfg); err != nil {
+		return err
+	}
+
+	tm.managerLogger.InfofKV("futures contract rolled",
+		ds.HistoryColTraderId, oldCfg.TraderId, ds.HistoryColTicker, next.Ticker)
+
+	return nil
+}
+
+// closeContract sells lots bought by trader on its current contract. Sell orders are linked
+// to the bought ones as strategy does. Filled sell is stored at once, because the trader
+// does not listen order states of the contract after rolling
+func (tm *TraderManager) closeContract(tr *trader.TraderService) error {
+	storage, ok := tm.storage.(IPositionStorage)
+	if !ok {
+		return fmt.Errorf("storage does not keep orders, lots of expiring contract are unknown")
+	}
+
+	cfg := tr.GetConfig()
+	bought, err := storage.GetUnsoldOrders(cfg.TraderId, cfg.InstrInfo)
+	if err != nil {
+		return fmt.Errorf("failed getting unsold orders: %s", err.Error())
+	}
+
+	for _, order := range bought {
+		ref := order.OrderId
+		sell := &ds.Order{
+			Direction:             ds.Sell.ToString(),
+			ExecutionReportStatus: ds.New.ToString(),
+			OrderPrice:            order.OrderPrice,
+			LotsRequested:         order.LotsExecuted,
+			TraderId:              cfg.TraderId,
+			OrderId:               uuid.NewString(),
+			OrderIdRef:            &ref,
+		}
+
+		if err := tm.storage.PutOrder(cfg.TraderId, cfg.InstrInfo, sell); err != nil {
+			return fmt.Errorf("failed storing sell order: %s", err.Error())
+		}
+
+		res, err := tr.MakeAction(nil, &ds.StrategyAction{Action: ds.Sell, Lots: sell.LotsRequested, RequestId: sell.OrderId})
+		if err != nil {
+			if rmErr := storage.RemoveOrder(cfg.InstrInfo, sell); rmErr != nil {
+				return fmt.Errorf("failed selling lots of expiring contract: %s; failed removing sell order: %s", err.Error(), rmErr.Error())
+			}
+			return fmt.Errorf("failed selling lots of expiring contract: %s", err.Error())
+		}
+
+		// not filled order is updated by order states, rolling is retried later
+		if res.ExecutionReportStatus != ds.Fill.ToString() {
+			return fmt.Errorf("sell order '%s' of expiring contract is not filled yet", sell.OrderId)
+		}
+
+		completedAt := time.Now()
+		sell.CreatedAt, sell.CompletionTime = &completedAt, &completedAt
+		sell.ExecutionReportStatus = res.ExecutionReportStatus
+		sell.OrderPrice = res.ExecutedOrderPrice
+		sell.LotsExecuted = sell.LotsRequested
+		if err := tm.storage.UpdateOrder(cfg.TraderId, cfg.InstrInfo, sell); err != nil {
+			return fmt.Errorf("failed updating sell order: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// findInstrument looks for instrument by the stored ticker and ISIN when its uid is not known
+// to the broker anymore
+func (tm *TraderManager) findInstrument(uid string) (*ds.InstrumentInfo, error) {
+	instrInfo, err := tm.broker.FindInstrument(uid)
+	if err == nil {
+		return instrInfo, nil
+	}
+
+	storage, ok := tm.storage.(IInstrumentStorage)
+	if !ok {
+		return nil, err
+	}
+
+	known, dbErr := storage.GetInstrumentInfo(uid)
+	if dbErr != nil {
+		return nil, err
+	}
+
+	for _, id := range []string{known.Isin, known.Ticker} {
+		if id == "" {
+			continue
+		}
+
+		found, findErr := tm.broker.FindInstrument(ds.JoinInstrumentIdentifier(id, known.ClassCode))
+		if findErr == nil && found.SameInstrument(known) {
+			return found, nil
+		}
+	}
+
+	return nil, err
+}
+
+func (tm *TraderManager) addInstrument(instrInfo *ds.InstrumentInfo) (int64, error) {
+	storage, ok := tm.storage.(IInstrumentStorage)
+	if !ok {
+		return tm.storage.AddInstrumentInfo(instrInfo)
+	}
+
+	dbId, oldUids, err := storage.ResolveInstrument(instrInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(oldUids) > 0 {
+		tm.managerLogger.InfofKV("instrument uid changed, instrument relinked",
+			ds.HistoryColTicker, instrInfo.Ticker, ds.HistoryColInstrumentUID, instrInfo.Uid,
+			ds.HistoryColDetails, fmt.Sprintf("old uids: %s", strings.Join(oldUids, ", ")))
+	}
+
+	return dbId, nil
+}
+
 func (tm *TraderManager) findTrader(trId TraderId) (*trader.TraderService, bool) {
 	tm.RLock()
 	defer tm.RUnlock()
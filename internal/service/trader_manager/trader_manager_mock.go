@@ -6,6 +6,7 @@ package tradermanager
 
 import (
 	reflect "reflect"
+	datastruct "trading_bot/internal/service/datastruct"
 	trader "trading_bot/internal/service/trader"
 
 	gomock "github.com/golang/mock/gomock"
@@ -48,3 +49,109 @@ func (mr *MockIStrategyResolverMockRecorder) ResolveStrategy(cfg, db, broker, tr
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveStrategy", reflect.TypeOf((*MockIStrategyResolver)(nil).ResolveStrategy), cfg, db, broker, traderId)
 }
+
+// MockIInstrumentStorage is a mock of IInstrumentStorage interface.
+type MockIInstrumentStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockIInstrumentStorageMockRecorder
+}
+
+// MockIInstrumentStorageMockRecorder is the mock recorder for MockIInstrumentStorage.
+type MockIInstrumentStorageMockRecorder struct {
+	mock *MockIInstrumentStorage
+}
+
+// NewMockIInstrumentStorage creates a new mock instance.
+func NewMockIInstrumentStorage(ctrl *gomock.Controller) *MockIInstrumentStorage {
+	mock := &MockIInstrumentStorage{ctrl: ctrl}
+	mock.recorder = &MockIInstrumentStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIInstrumentStorage) EXPECT() *MockIInstrumentStorageMockRecorder {
+	return m.recorder
+}
+
+// GetInstrumentInfo mocks base method.
+func (m *MockIInstrumentStorage) GetInstrumentInfo(uid string) (*datastruct.InstrumentInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInstrumentInfo", uid)
+	ret0, _ := ret[0].(*datastruct.InstrumentInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInstrumentInfo indicates an expected call of GetInstrumentInfo.
+func (mr *MockIInstrumentStorageMockRecorder) GetInstrumentInfo(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstrumentInfo", reflect.TypeOf((*MockIInstrumentStorage)(nil).GetInstrumentInfo), uid)
+}
+
+// ResolveInstrument mocks base method.
+func (m *MockIInstrumentStorage) ResolveInstrument(instrInfo *datastruct.InstrumentInfo) (int64, []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveInstrument", instrInfo)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].([]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ResolveInstrument indicates an expected call of ResolveInstrument.
+func (mr *MockIInstrumentStorageMockRecorder) ResolveInstrument(instrInfo interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveInstrument", reflect.TypeOf((*MockIInstrumentStorage)(nil).ResolveInstrument), instrInfo)
+}
+
+// MockIPositionStorage is a mock of IPositionStorage interface.
+type MockIPositionStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockIPositionStorageMockRecorder
+}
+
+// MockIPositionStorageMockRecorder is the mock recorder for MockIPositionStorage.
+type MockIPositionStorageMockRecorder struct {
+	mock *MockIPositionStorage
+}
+
+// NewMockIPositionStorage creates a new mock instance.
+func NewMockIPositionStorage(ctrl *gomock.Controller) *MockIPositionStorage {
+	mock := &MockIPositionStorage{ctrl: ctrl}
+	mock.recorder = &MockIPositionStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIPositionStorage) EXPECT() *MockIPositionStorageMockRecorder {
+	return m.recorder
+}
+
+// GetUnsoldOrders mocks base method.
+func (m *MockIPositionStorage) GetUnsoldOrders(trId string, instrInfo *datastruct.InstrumentInfo) ([]*datastruct.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnsoldOrders", trId, instrInfo)
+	ret0, _ := ret[0].([]*datastruct.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnsoldOrders indicates an expected call of GetUnsoldOrders.
+func (mr *MockIPositionStorageMockRecorder) GetUnsoldOrders(trId, instrInfo interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnsoldOrders", reflect.TypeOf((*MockIPositionStorage)(nil).GetUnsoldOrders), trId, instrInfo)
+}
+
+// RemoveOrder mocks base method.
+func (m *MockIPositionStorage) RemoveOrder(instrInfo *datastruct.InstrumentInfo, order *datastruct.Order) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveOrder", instrInfo, order)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveOrder indicates an expected call of RemoveOrder.
+func (mr *MockIPositionStorageMockRecorder) RemoveOrder(instrInfo, order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveOrder", reflect.TypeOf((*MockIPositionStorage)(nil).RemoveOrder), instrInfo, order)
+}
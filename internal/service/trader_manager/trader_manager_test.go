@@ -11,6 +11,7 @@ import (
 	"trading_bot/internal/strategy/btdstf"
 
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -262,3 +263,182 @@ func TestTraderManager(t *testing.T) {
 		require.NotNil(t, ts.service)
 	})
 }
+
+type MockInstrumentStorageCombined struct {
+	*trader.MockIStorage
+	*MockIInstrumentStorage
+}
+
+func TestTraderManagerInstrumentResolution(t *testing.T) {
+	t.Parallel()
+
+	newService := func(t *testing.T) (*TraderManager, *trader.MockIBroker, *trader.MockILogger, *MockIInstrumentStorage, *MockIStrategyResolver) {
+		mc := gomock.NewController(t)
+		mockBrocker := trader.NewMockIBroker(mc)
+		mockLogger := trader.NewMockILogger(mc)
+		mockStrategyResolver := NewMockIStrategyResolver(mc)
+		mockStorage := &MockInstrumentStorageCombined{
+			MockIStorage:           trader.NewMockIStorage(mc),
+			MockIInstrumentStorage: NewMockIInstrumentStorage(mc),
+		}
+
+		tm := NewTraderManager(context.Background(), time.Second*1, mockBrocker, mockStorage, mockLogger, mockLogger,
+			mockStrategyResolver, trader.NewMockIHistoryWriter(mc))
+
+		return tm, mockBrocker, mockLogger, mockStorage.MockIInstrumentStorage, mockStrategyResolver
+	}
+
+	t.Run("uid changed by broker", func(t *testing.T) {
+		t.Parallel()
+
+		tm, broker, logger, storage, resolver := newService(t)
+		cfg := getTestTraderConfig()
+
+		known := &ds.InstrumentInfo{Id: 1, Uid: "uid", Ticker: "TICK", ClassCode: "TQBR", Isin: "ISIN"}
+		actual := &ds.InstrumentInfo{Uid: "new_uid", Ticker: "TICK", ClassCode: "TQBR", Isin: "ISIN"}
+
+		broker.EXPECT().FindInstrument("uid").Return(nil, errors.New("not found"))
+		storage.EXPECT().GetInstrumentInfo("uid").Return(known, nil)
+		broker.EXPECT().FindInstrument("ISIN@TQBR").Return(actual, nil)
+		storage.EXPECT().ResolveInstrument(actual).Return(int64(1), []string{"uid"}, nil)
+		logger.EXPECT().InfofKV("instrument uid changed, instrument relinked", gomock.Any())
+		resolver.EXPECT().ResolveStrategy(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("error"))
+		logger.EXPECT().ErrorfKV(gomock.Any(), gomock.All())
+
+		tm.UpdateTradersWithConfig(cfg)
+
+		require.Equal(t, int64(1), actual.Id)
+	})
+
+	t.Run("instrument of another class code is skipped", func(t *testing.T) {
+		t.Parallel()
+
+		tm, broker, logger, storage, _ := newService(t)
+		cfg := getTestTraderConfig()
+
+		known := &ds.InstrumentInfo{Id: 1, Uid: "uid", Ticker: "TICK", ClassCode: "TQBR", Isin: "ISIN"}
+
+		broker.EXPECT().FindInstrument("uid").Return(nil, errors.New("not found"))
+		storage.EXPECT().GetInstrumentInfo("uid").Return(known, nil)
+		broker.EXPECT().FindInstrument("ISIN@TQBR").Return(&ds.InstrumentInfo{Uid: "spb", Ticker: "TICK", ClassCode: "SPBXM", Isin: "ISIN"}, nil)
+		broker.EXPECT().FindInstrument("TICK@TQBR").Return(nil, errors.New("not found"))
+		logger.EXPECT().ErrorfKV("failed getting instrument from broker: %s", "not found")
+
+		tm.UpdateTradersWithConfig(cfg)
+	})
+}
+
+func TestTraderManagerFutures(t *testing.T) {
+	t.Parallel()
+
+	ts := newTraderManagerTestService(t)
+
+	cfg := getTestTraderConfig()
+	cfg.Traders[0].Uid = ""
+	cfg.Traders[0].BasicAsset = "SBER"
+	cfg.Traders[0].RollBefore = time.Hour * 24 * 7
+
+	soon := time.Now().Add(time.Hour * 24)
+	later := time.Now().Add(time.Hour * 24 * 90)
+	contract := &ds.InstrumentInfo{Uid: "later", Type: ds.InstrumentTypeFutures, ExpirationDate: &later}
+
+	ts.mockBrocker.EXPECT().FindFutures("SBER").Return([]*ds.InstrumentInfo{
+		{Uid: "soon", Type: ds.InstrumentTypeFutures, ExpirationDate: &soon},
+		{Uid: "later", Type: ds.InstrumentTypeFutures, ExpirationDate: &later},
+	}, nil)
+	ts.mockBrocker.EXPECT().FindInstrument("later").Return(contract, nil)
+	ts.mockStorage.MockIStorage.EXPECT().AddInstrumentInfo(contract).Return(int64(1), nil)
+	rs := ts.mockStrategyResolver.EXPECT().ResolveStrategy(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("error"))
+	ts.mockLogger.EXPECT().ErrorfKV(gomock.Any(), gomock.All()).After(rs)
+
+	ts.service.UpdateTradersWithConfig(cfg)
+
+	require.Equal(t, int64(1), contract.Id)
+}
+
+type MockPositionStorageCombined struct {
+	*trader.MockIStorage
+	*MockIPositionStorage
+}
+
+func TestTraderManagerFuturesRolling(t *testing.T) {
+	t.Parallel()
+
+	mc := gomock.NewController(t)
+	broker := trader.NewMockIBroker(mc)
+	logger := trader.NewMockILogger(mc)
+	storage := &MockPositionStorageCombined{
+		MockIStorage:         trader.NewMockIStorage(mc),
+		MockIPositionStorage: NewMockIPositionStorage(mc),
+	}
+	tm := NewTraderManager(context.Background(), time.Second, broker, storage, logger, logger,
+		NewMockIStrategyResolver(mc), trader.NewMockIHistoryWriter(mc))
+
+	now := time.Now()
+	soon := now.Add(time.Hour * 24)
+	later := now.Add(time.Hour * 24 * 90)
+	current := &ds.InstrumentInfo{Id: 1, Uid: "soon", Ticker: "SRH6", Type: ds.InstrumentTypeFutures, ExpirationDate: &soon, InstanceId: uuid.New()}
+	next := &ds.InstrumentInfo{Uid: "later", Ticker: "SRM6", Type: ds.InstrumentTypeFutures, ExpirationDate: &later}
+	stock := &ds.InstrumentInfo{Id: 3, Uid: "uid", Ticker: "SBER", InstanceId: uuid.New()}
+
+	cfg := getTestTraderConfig()
+	cfg.Traders = append(cfg.Traders, &config.OneTraderCfg{
+		UniqueTraderId: "futures_tr_id",
+		BasicAsset:     "SBER",
+		RollBefore:     time.Hour * 24 * 7,
+		AccountId:      "account_id",
+	})
+	tm.cfg = cfg
+
+	broker.EXPECT().RegisterOrderStateRecipient(gomock.Any(), "account_id").Return(nil).Times(3)
+	broker.EXPECT().RegisterLastPriceRecipient(gomock.Any()).Return(nil).Times(3)
+	broker.EXPECT().RecieveOrdersUpdate(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("error")).AnyTimes()
+	logger.EXPECT().ErrorfKV("error on operating orders update", gomock.Any()).AnyTimes()
+	logger.EXPECT().InfofKV(gomock.Any(), gomock.Any()).AnyTimes()
+
+	newTrader := func(id string, instrInfo *ds.InstrumentInfo) *trader.TraderService {
+		tr, err := trader.NewTraderService(context.Background(), broker, logger, trader.NewMockIStrategy(mc), storage, nil,
+			&trader.TraderCfg{TraderId: id, InstrInfo: instrInfo, AccountId: "account_id", OnOrdersOperatingErrorDelay: time.Hour})
+		require.NoError(t, err)
+		require.NoError(t, tm.addTrader(tr))
+		t.Cleanup(func() { tr.Stop() })
+		return tr
+	}
+	stockTrader := newTrader("tr_id", stock)
+	futuresTrader := newTrader("futures_tr_id", current)
+	stockCfg := stockTrader.GetConfig()
+
+	broker.EXPECT().FindFutures("SBER").Return([]*ds.InstrumentInfo{current, {Uid: "later", ExpirationDate: &later}}, nil)
+	broker.EXPECT().FindInstrument("later").Return(next, nil)
+	storage.MockIStorage.EXPECT().AddInstrumentInfo(next).Return(int64(2), nil)
+
+	bought := &ds.Order{OrderId: "buy", LotsExecuted: 3}
+	storage.MockIPositionStorage.EXPECT().GetUnsoldOrders("futures_tr_id", current).Return([]*ds.Order{bought}, nil)
+	put := storage.MockIStorage.EXPECT().PutOrder("futures_tr_id", current, gomock.Any()).DoAndReturn(
+		func(_ string, _ *ds.InstrumentInfo, order *ds.Order) error {
+			require.Equal(t, "buy", *order.OrderIdRef)
+			return nil
+		})
+	sell := broker.EXPECT().MakeSellOrder(current, int64(3), gomock.Any(), "account_id").Return(
+		&ds.PostOrderResult{ExecutionReportStatus: ds.Fill.ToString()}, nil).After(put)
+	storage.MockIStorage.EXPECT().UpdateOrder("futures_tr_id", current, gomock.Any()).DoAndReturn(
+		func(_ string, _ *ds.InstrumentInfo, order *ds.Order) error {
+			require.Equal(t, int64(3), order.LotsExecuted)
+			return nil
+		}).After(sell)
+	broker.EXPECT().UnregisterOrderStateRecipient(current, "account_id").Return(nil)
+	broker.EXPECT().UnregisterLastPriceRecipient(current).Return(nil)
+	broker.EXPECT().UnregisterOrderStateRecipient(gomock.Any(), "account_id").Return(nil).AnyTimes()
+	broker.EXPECT().UnregisterLastPriceRecipient(gomock.Any()).Return(nil).AnyTimes()
+
+	tm.rollFutures(now)
+
+	rolled := futuresTrader.GetConfig().InstrInfo
+	require.Equal(t, "later", rolled.Uid)
+	require.Equal(t, int64(2), rolled.Id)
+	require.Equal(t, current.InstanceId, rolled.InstanceId)
+
+	// other traders keep their config and instance
+	require.Same(t, stockCfg, stockTrader.GetConfig())
+	require.Equal(t, stock.InstanceId, stockTrader.GetConfig().InstrInfo.InstanceId)
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS orders_latency_kafka (
+request_id String,
+trader_id String,
+decision_to_send_ms Int64,
+send_to_ack_ms Int64,
+send_to_fill_ms Int64,
+timestamp UInt64
+) ENGINE = Kafka()
+SETTINGS  kafka_broker_list = 'kafka_broker:9092',
+        kafka_topic_list = 'orders_latency',
+        kafka_group_name = 'trader_group',
+        kafka_format = 'JSONEachRow',
+        kafka_num_consumers = 1;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS orders_latency_kafka;
+
+-- +goose StatementEnd
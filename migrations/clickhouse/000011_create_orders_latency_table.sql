@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS orders_latency (
+request_id String,
+trader_id String,
+decision_to_send_ms Int64,
+send_to_ack_ms Int64,
+send_to_fill_ms Int64,
+timestamp DateTime64(3, 'UTC'),
+) ENGINE = ReplacingMergeTree(timestamp)
+ORDER BY (trader_id, request_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS orders_latency;
+
+-- +goose StatementEnd
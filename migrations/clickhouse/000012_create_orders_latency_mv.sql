@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE MATERIALIZED VIEW orders_latency_mv
+TO orders_latency
+AS
+SELECT
+    request_id,
+    trader_id,
+    decision_to_send_ms,
+    send_to_ack_ms,
+    send_to_fill_ms,
+    toDateTime64(timestamp, 3, 'UTC') AS timestamp
+FROM orders_latency_kafka;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP VIEW IF EXISTS orders_latency_mv;
+
+-- +goose StatementEnd
@@ -0,0 +1,121 @@
+-- +goose Up
+-- +goose StatementBegin
+
+DROP VIEW IF EXISTS orders_history_mv;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS orders_history_kafka;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS orders_history_kafka (
+action String,
+lots UInt64,
+price Float64,
+amount Float64,
+currency String,
+amount_base Nullable(Float64),
+base_currency String,
+request_id String,
+trader_id String,
+timestamp UInt64
+) ENGINE = Kafka()
+SETTINGS  kafka_broker_list = 'kafka_broker:9092',
+        kafka_topic_list = 'orders_history',
+        kafka_group_name = 'trader_group',
+        kafka_format = 'JSONEachRow',
+        kafka_num_consumers = 1;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE orders_history
+    ADD COLUMN IF NOT EXISTS amount Float64 AFTER price,
+    ADD COLUMN IF NOT EXISTS currency String AFTER amount,
+    ADD COLUMN IF NOT EXISTS amount_base Nullable(Float64) AFTER currency,
+    ADD COLUMN IF NOT EXISTS base_currency String AFTER amount_base;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE MATERIALIZED VIEW orders_history_mv
+TO orders_history
+AS
+SELECT
+    action,
+    lots,
+    price,
+    amount,
+    currency,
+    amount_base,
+    base_currency,
+    request_id,
+    trader_id,
+    toDateTime64(timestamp, 3, 'UTC') AS timestamp
+FROM orders_history_kafka;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP VIEW IF EXISTS orders_history_mv;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS orders_history_kafka;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS orders_history_kafka (
+action String,
+lots UInt64,
+price Float64,
+request_id String,
+trader_id String,
+timestamp UInt64
+) ENGINE = Kafka()
+SETTINGS  kafka_broker_list = 'kafka_broker:9092',
+        kafka_topic_list = 'orders_history',
+        kafka_group_name = 'trader_group',
+        kafka_format = 'JSONEachRow',
+        kafka_num_consumers = 1;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE orders_history
+    DROP COLUMN IF EXISTS base_currency,
+    DROP COLUMN IF EXISTS amount_base,
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS amount;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE MATERIALIZED VIEW orders_history_mv
+TO orders_history
+AS
+SELECT
+    action,
+    lots,
+    price,
+    request_id,
+    trader_id,
+    toDateTime64(timestamp, 3, 'UTC') AS timestamp
+FROM orders_history_kafka;
+
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE SCHEMA IF NOT EXISTS paper;
+
+CREATE TABLE IF NOT EXISTS paper.orders (
+    id SERIAL PRIMARY KEY,
+    instrument_id INT NOT NULL REFERENCES public.instruments(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NULL,
+    completed_at TIMESTAMPTZ DEFAULT NULL,
+    order_id TEXT NOT NULL,
+    order_id_ref TEXT DEFAULT NULL,
+    direction TEXT NOT NULL,
+    exec_report_status TEXT NOT NULL,
+    price_units BIGINT NOT NULL,
+    price_nano INT NOT NULL,
+    lots_requested BIGINT NOT NULL,
+    lots_executed BIGINT NOT NULL,
+    trader_id TEXT NOT NULL,
+    additional_info TEXT,
+
+    UNIQUE(instrument_id, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_paper_orders_order_id ON paper.orders USING hash (order_id);
+
+CREATE TABLE IF NOT EXISTS paper.positions (
+    id SERIAL PRIMARY KEY,
+    account_id TEXT NOT NULL,
+    instrument_id INT NOT NULL REFERENCES public.instruments(id) ON DELETE CASCADE,
+    lots BIGINT NOT NULL,
+    average_price_units BIGINT NOT NULL,
+    average_price_nano INT NOT NULL,
+    realized_pnl_units BIGINT NOT NULL,
+    realized_pnl_nano INT NOT NULL,
+    commission_units BIGINT NOT NULL,
+    commission_nano INT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+
+    UNIQUE(account_id, instrument_id)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP SCHEMA IF EXISTS paper CASCADE;
+
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS decided_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS sent_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS acked_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS filled_at TIMESTAMPTZ DEFAULT NULL;
+
+ALTER TABLE paper.orders
+    ADD COLUMN IF NOT EXISTS decided_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS sent_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS acked_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS filled_at TIMESTAMPTZ DEFAULT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE paper.orders
+    DROP COLUMN IF EXISTS decided_at,
+    DROP COLUMN IF EXISTS sent_at,
+    DROP COLUMN IF EXISTS acked_at,
+    DROP COLUMN IF EXISTS filled_at;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS decided_at,
+    DROP COLUMN IF EXISTS sent_at,
+    DROP COLUMN IF EXISTS acked_at,
+    DROP COLUMN IF EXISTS filled_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE INDEX IF NOT EXISTS idx_instruments_class_code_ticker ON instruments USING btree (class_code, ticker);
+CREATE INDEX IF NOT EXISTS idx_instruments_isin ON instruments USING btree (isin);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_instruments_isin;
+DROP INDEX IF EXISTS idx_instruments_class_code_ticker;
+
+-- +goose StatementEnd
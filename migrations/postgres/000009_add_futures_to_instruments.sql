@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE instruments
+    ADD COLUMN IF NOT EXISTS instrument_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS basic_asset TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS min_price_increment_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS min_price_increment_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS min_price_increment_amount_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS min_price_increment_amount_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS initial_margin_on_buy_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS initial_margin_on_buy_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS initial_margin_on_sell_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS initial_margin_on_sell_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS expiration_date TIMESTAMPTZ DEFAULT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE instruments
+    DROP COLUMN IF EXISTS instrument_type,
+    DROP COLUMN IF EXISTS basic_asset,
+    DROP COLUMN IF EXISTS min_price_increment_units,
+    DROP COLUMN IF EXISTS min_price_increment_nano,
+    DROP COLUMN IF EXISTS min_price_increment_amount_units,
+    DROP COLUMN IF EXISTS min_price_increment_amount_nano,
+    DROP COLUMN IF EXISTS initial_margin_on_buy_units,
+    DROP COLUMN IF EXISTS initial_margin_on_buy_nano,
+    DROP COLUMN IF EXISTS initial_margin_on_sell_units,
+    DROP COLUMN IF EXISTS initial_margin_on_sell_nano,
+    DROP COLUMN IF EXISTS expiration_date;
+
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE instruments
+    ADD COLUMN IF NOT EXISTS nominal_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS nominal_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS aci_value_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS aci_value_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS maturity_date TIMESTAMPTZ DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS coupons (
+    id SERIAL PRIMARY KEY,
+    instrument_id INT NOT NULL REFERENCES instruments(id) ON DELETE CASCADE,
+    coupon_date TIMESTAMPTZ NOT NULL,
+    coupon_start_date TIMESTAMPTZ NOT NULL,
+    coupon_end_date TIMESTAMPTZ NOT NULL,
+    pay_one_bond_units BIGINT NOT NULL,
+    pay_one_bond_nano INT NOT NULL,
+
+    UNIQUE(instrument_id, coupon_date)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS coupons;
+
+ALTER TABLE instruments
+    DROP COLUMN IF EXISTS nominal_units,
+    DROP COLUMN IF EXISTS nominal_nano,
+    DROP COLUMN IF EXISTS aci_value_units,
+    DROP COLUMN IF EXISTS aci_value_nano,
+    DROP COLUMN IF EXISTS maturity_date;
+
+-- +goose StatementEnd
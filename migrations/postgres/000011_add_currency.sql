@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE instruments
+    ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'rub';
+
+ALTER TABLE paper.positions
+    ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'rub';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE paper.positions
+    DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE instruments
+    DROP COLUMN IF EXISTS currency;
+
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS backtest_runs (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    git_commit TEXT NOT NULL DEFAULT '',
+    trader_id TEXT NOT NULL,
+    strategy TEXT NOT NULL,
+    config JSONB NOT NULL,
+    from_time TIMESTAMPTZ NOT NULL,
+    to_time TIMESTAMPTZ NOT NULL,
+    metrics JSONB NOT NULL,
+    trades JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_backtest_runs_trader_id ON backtest_runs (trader_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS backtest_runs;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE paper.positions
+    ADD COLUMN IF NOT EXISTS realized_pnl_base_units BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS realized_pnl_base_nano INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS base_currency TEXT NOT NULL DEFAULT 'rub';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE paper.positions
+    DROP COLUMN IF EXISTS base_currency,
+    DROP COLUMN IF EXISTS realized_pnl_base_nano,
+    DROP COLUMN IF EXISTS realized_pnl_base_units;
+
+-- +goose StatementEnd